@@ -3,7 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
-	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -14,8 +14,30 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+
+	"helm-auditor/internal/cache"
+	"helm-auditor/internal/reports"
+	"helm-auditor/internal/types"
 )
 
+// scan is what has to run for an image and where the results go, as
+// seen from the jobs.
+type scan struct {
+	sbom, vulns, prov          string
+	runSBOM, runVulns, runProv bool
+}
+
+// cached is an image whose results are copied from the scan cache to
+// the chart folder once the jobs are done.
+type cached struct {
+	image string
+	entry *cache.Entry // shared by the references of a digest
+	paths cache.Paths
+	scan  scan
+	dest  reports.ImagePaths // where the reporter reads them
+}
+
 func main() {
 	ctx := context.Background()
 	config, err := rest.InClusterConfig()
@@ -28,16 +50,40 @@ func main() {
 		panic(err)
 	}
 
-        reportsPath := os.Getenv("OUTPUT_FOLDER")
-        imagesFile := filepath.Join(reportsPath, "images.txt")
+	reportsPath := os.Getenv("OUTPUT_FOLDER")
+	imagesFile := filepath.Join(reportsPath, "images.txt")
 	namespace := "default"
 
+	// The jobs mount the reports volume at reportsPath, this pod at
+	// reports.Root.
+	inJob := func(p string) string {
+		rel, _ := filepath.Rel(reports.Root, p)
+		return filepath.Join(reportsPath, rel)
+	}
+
 	file, err := os.Open(imagesFile)
 	if err != nil {
 		panic(err)
 	}
 	defer file.Close()
 
+	sc := openCache()
+	var dbUpdated time.Time
+	if sc != nil {
+		dbUpdated = downloadDB(ctx, clientset, namespace, reportsPath, inJob(sc.TrivyDir()))
+		if !dbUpdated.IsZero() {
+			fmt.Println("Trivy DB updated at", dbUpdated.Format(time.RFC3339))
+		}
+	}
+	provenanceTTL := cache.DefaultProvenanceTTL
+	if ttl, err := time.ParseDuration(os.Getenv("PROVENANCE_TTL")); err == nil {
+		provenanceTTL = ttl
+	}
+
+	stats := types.ScanCacheStats{DBUpdated: dbUpdated}
+	var pending []*cached
+	entries := map[string]*cache.Entry{} // digests seen by this run
+
 	scanner := bufio.NewScanner(file)
 
 	jobs := []*batchv1.Job{}
@@ -48,130 +94,93 @@ func main() {
 			continue
 		}
 
-		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(img)))
-
-		//sbomFile := filepath.Join(reportsPath, hash+".cdx.json")
-		//vulnFile := filepath.Join(reportsPath, hash+".vulns.json")
-		//provFile := filepath.Join(reportsPath, hash+".prov.json")
-                promChart := os.Getenv("PROM_CHART")
-		chartFolder := filepath.Join(reportsPath, promChart) // e.g., kube-prometheus-stack
-                os.MkdirAll(reportsPath, 0755)
-                
-                sbomFile := filepath.Join(chartFolder, hash+".cdx.json")
-                vulnFile := filepath.Join(chartFolder, hash+".vulns.json")
-                provFile := filepath.Join(chartFolder, hash+".prov.json")
+		hash := reports.ImageHash(img)
+		os.MkdirAll(reportsPath, 0755)
 
-		jobName := "trivy-" + hash[:8]
+		// Where the reporter and auditor read the results, as seen from
+		// the jobs.
+		paths := reports.PathsFor(reportsPath, img)
+		sbomFile := inJob(paths.SBOM)
+		vulnFile := inJob(paths.Vulns)
+		provFile := inJob(paths.Provenance)
 
-		job := &batchv1.Job{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      jobName,
-				Namespace: namespace,
-			},
-			Spec: batchv1.JobSpec{
-				Template: corev1.PodTemplateSpec{
-					Spec: corev1.PodSpec{
-						RestartPolicy: corev1.RestartPolicyNever,
-						InitContainers: []corev1.Container{
-							{
-								Name:    "trivy-sbom",
-								Image:   "aquasec/trivy:0.68.1",
-								Command: []string{"trivy", "image"},
-								Args: []string{
-									"--format", "cyclonedx",
-									"--output", sbomFile,
-									img,
-								},
-								VolumeMounts: []corev1.VolumeMount{
-									{Name: "reports", MountPath: reportsPath},
-								},
-							},
-						},
-						Containers: []corev1.Container{
-							{
-								Name:    "trivy",
-								Image:   "aquasec/trivy:0.68.1",
-								Command: []string{"trivy", "sbom"},
-								Args: []string{
-									"--format", "json",
-									"--output", vulnFile,
-									sbomFile,
-								},
-								VolumeMounts: []corev1.VolumeMount{
-									{Name: "reports", MountPath: reportsPath},
-								},
-							},
-						},
-						Volumes: []corev1.Volume{
-							{
-								Name: "reports",
-								VolumeSource: corev1.VolumeSource{
-									PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-										ClaimName: "reports-pvc",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
+		s := scan{sbom: sbomFile, vulns: vulnFile, prov: provFile, runSBOM: true, runVulns: true, runProv: true}
+		ci := types.CachedImage{Image: img, Scan: cache.Uncached, Provenance: cache.Miss}
+		if sc != nil {
+			if digest, err := cache.Resolve(ctx, img); err != nil {
+				fmt.Println("Scanning without cache:", err)
+			} else {
+				entry, seen := entries[digest]
+				if !seen {
+					entry = sc.Load(digest)
+					entries[digest] = entry
+				}
+				cp := sc.PathsFor(digest)
+				ci.Digest = digest
+				ci.Scan = entry.Plan(dbUpdated)
+				s = scan{
+					sbom:     inJob(cp.SBOM),
+					vulns:    inJob(cp.Vulns),
+					prov:     inJob(cp.Provenance),
+					runSBOM:  ci.Scan == cache.Miss,
+					runVulns: ci.Scan != cache.Hit,
+					runProv:  !entry.ProvenanceFresh(provenanceTTL, time.Now()),
+				}
+				if !s.runProv {
+					ci.Provenance = cache.Hit
+				}
+				if seen {
+					// Same image under another reference, scanned once.
+					s.runSBOM, s.runVulns, s.runProv = false, false, false
+				} else {
+					entry.Image = img
+				}
+				pending = append(pending, &cached{
+					image: img,
+					entry: entry,
+					paths: cp,
+					scan:  s,
+					dest:  paths,
+				})
+			}
+		}
+		switch ci.Scan {
+		case cache.Hit:
+			stats.Hits++
+		case cache.Rescan:
+			stats.Rescans++
+		case cache.Miss:
+			stats.Misses++
+		default:
+			stats.Uncached++
 		}
+		if ci.Provenance == cache.Hit {
+			stats.ProvenanceHits++
+		}
+		stats.Images = append(stats.Images, ci)
+		fmt.Printf("Image %s: scan %s, provenance %s\n", img, ci.Scan, ci.Provenance)
 
-		// Provenance job
-
-                // Provenance job
-                provJob := &batchv1.Job{
-                    ObjectMeta: metav1.ObjectMeta{
-                        Name:      "prov-" + hash[:8],
-                        Namespace: namespace,
-                    },
-                    Spec: batchv1.JobSpec{
-                        Template: corev1.PodTemplateSpec{
-                            Spec: corev1.PodSpec{
-                                RestartPolicy: corev1.RestartPolicyNever,
-                                Containers: []corev1.Container{
-                                    {
-                                        Name:            "provenor",
-                                        Image:           "helm-auditor:latest",
-                                        ImagePullPolicy: corev1.PullNever,
-                                        Command:         []string{"/auditor-provenor"},
-                                        Env: []corev1.EnvVar{
-                                            {Name: "PROV_IMAGE", Value: img},
-                                            {Name: "OUTPUT_FOLDER", Value: provFile},
-                                        },
-                                        VolumeMounts: []corev1.VolumeMount{
-                                            {Name: "reports", MountPath: reportsPath},
-                                        },
-                                    },
-                                },
-                                Volumes: []corev1.Volume{
-                                    {
-                                        Name: "reports",
-                                        VolumeSource: corev1.VolumeSource{
-                                            PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-                                                ClaimName: "reports-pvc",
-                                            },
-                                        },
-                                    },
-                                },
-                            },
-                        },
-                    },
-                }
-		_, err = clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
-		if err != nil {
-			fmt.Printf("Failed to create job for %s: %v\n", img, err)
-		} else {
-			fmt.Printf("Job %s dispatched for image %s\n", jobName, img)
-			jobs = append(jobs, job)
+		if s.runVulns {
+			jobName := "trivy-" + hash[:8]
+			job := scanJob(jobName, namespace, reportsPath, img, s, sc, inJob, !dbUpdated.IsZero())
+			_, err = clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+			if err != nil {
+				fmt.Printf("Failed to create job for %s: %v\n", img, err)
+			} else {
+				fmt.Printf("Job %s dispatched for image %s\n", jobName, img)
+				jobs = append(jobs, job)
+			}
 		}
 
-		_, err = clientset.BatchV1().Jobs(namespace).Create(ctx, provJob, metav1.CreateOptions{})
-		if err != nil {
-			fmt.Printf("Failed to create provenance job for %s: %v\n", img, err)
-		} else {
-			fmt.Printf("Prov job prov-%s dispatched\n", hash[:8])
-			jobs = append(jobs, provJob)
+		if s.runProv {
+			provJob := provenanceJob("prov-"+hash[:8], namespace, reportsPath, img, s.prov)
+			_, err = clientset.BatchV1().Jobs(namespace).Create(ctx, provJob, metav1.CreateOptions{})
+			if err != nil {
+				fmt.Printf("Failed to create provenance job for %s: %v\n", img, err)
+			} else {
+				fmt.Printf("Prov job prov-%s dispatched\n", hash[:8])
+				jobs = append(jobs, provJob)
+			}
 		}
 	}
 
@@ -191,5 +200,249 @@ func main() {
 			time.Sleep(2 * time.Second)
 		}
 	}
+
+	now := time.Now().UTC()
+	for _, c := range pending {
+		restore(sc, c, dbUpdated, now)
+	}
+	if sc != nil {
+		if err := os.RemoveAll(sc.JobsDir()); err != nil {
+			fmt.Println("Cannot remove trivy job caches:", err)
+		}
+		out, _ := json.MarshalIndent(stats, "", "  ")
+		if err := os.WriteFile(filepath.Join(reportsPath, "scan-cache.json"), out, 0644); err != nil {
+			fmt.Println("Cannot write scan cache stats:", err)
+		}
+		fmt.Printf("Scan cache: %d hits, %d rescans, %d misses, %d uncached, %d provenance hits\n",
+			stats.Hits, stats.Rescans, stats.Misses, stats.Uncached, stats.ProvenanceHits)
+	}
+}
+
+// openCache opens the scan cache (SCAN_CACHE_DIR, cache/ at the root of
+// the reports volume by default), nil when SCAN_CACHE is false.
+func openCache() *cache.Cache {
+	if os.Getenv("SCAN_CACHE") == "false" {
+		return nil
+	}
+	dir := os.Getenv("SCAN_CACHE_DIR")
+	if dir == "" {
+		dir = filepath.Join(reports.Root, "cache")
+	}
+	sc, err := cache.New(dir)
+	if err != nil {
+		fmt.Println("Scanning without cache:", err)
+		return nil
+	}
+	return sc
+}
+
+// restore records what the jobs produced in the cache entry and copies
+// the cached results to the chart folder, where the reporter reads them.
+func restore(sc *cache.Cache, c *cached, dbUpdated, now time.Time) {
+	ok := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	if c.scan.runSBOM && ok(c.paths.SBOM) {
+		c.entry.SBOM = now
+	}
+	if c.scan.runVulns && ok(c.paths.Vulns) {
+		c.entry.Scanned, c.entry.DBUpdated = now, dbUpdated
+	}
+	if c.scan.runProv && ok(filepath.Join(c.paths.Provenance, "provenance.json")) {
+		c.entry.Provenanced = now
+	}
+	if c.scan.runSBOM || c.scan.runVulns || c.scan.runProv {
+		if err := sc.Save(c.entry); err != nil {
+			fmt.Printf("Cannot update scan cache for %s: %v\n", c.image, err)
+		}
+	}
+
+	for _, cp := range [][2]string{{c.paths.SBOM, c.dest.SBOM}, {c.paths.Vulns, c.dest.Vulns}, {c.paths.Provenance, c.dest.Provenance}} {
+		if !ok(cp[0]) {
+			continue
+		}
+		if err := cache.Copy(cp[0], cp[1]); err != nil {
+			fmt.Printf("Cannot copy cached results of %s: %v\n", c.image, err)
+		}
+	}
+}
+
+// downloadDB runs a job updating the trivy vulnerability DB in the
+// cache, so the scan jobs share it, and returns when it was built.
+func downloadDB(ctx context.Context, clientset *kubernetes.Clientset, namespace, reportsPath, trivyDir string) time.Time {
+	name := fmt.Sprintf("trivy-db-%d", time.Now().Unix())
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "trivy-db",
+							Image:   "aquasec/trivy:0.68.1",
+							Command: []string{"trivy", "image"},
+							Args:    []string{"--download-db-only", "--cache-dir", trivyDir},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "reports", MountPath: reportsPath},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{reportsVolume()},
+				},
+			},
+		},
+	}
+	if _, err := clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		fmt.Println("Failed to create trivy DB job:", err)
+		return time.Time{}
+	}
+	for {
+		j, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			fmt.Printf("Error fetching job %s: %v\n", name, err)
+			return time.Time{}
+		}
+		if j.Status.Failed > 0 {
+			fmt.Println("Trivy DB download failed, every image is matched again")
+			return time.Time{}
+		}
+		if j.Status.Succeeded > 0 {
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	rel, _ := filepath.Rel(reportsPath, trivyDir)
+	updated, err := cache.DBUpdated(filepath.Join(reports.Root, rel))
+	if err != nil {
+		fmt.Println("Cannot read trivy DB metadata:", err)
+	}
+	return updated
+}
+
+// scanJob generates the CycloneDX SBOM of img, unless it is cached, and
+// matches it against the vulnerability DB. With a cache, the job copies
+// the shared DB into a cache dir of its own: trivy holds a lock on its
+// cache dir while it scans, which fails the jobs running alongside.
+func scanJob(name, namespace, reportsPath, img string, s scan, sc *cache.Cache, inJob func(string) string, sharedDB bool) *batchv1.Job {
+	sbomArgs := []string{"--format", "cyclonedx", "--output", s.sbom, img}
+	vulnArgs := []string{"--format", "json", "--output", s.vulns, s.sbom}
+	mounts := []corev1.VolumeMount{{Name: "reports", MountPath: reportsPath}}
+
+	var initContainers []corev1.Container
+	if sc != nil {
+		jobDir := inJob(sc.JobDir(name))
+		sbomArgs = append([]string{"--cache-dir", jobDir}, sbomArgs...)
+		vulnArgs = append([]string{"--cache-dir", jobDir}, vulnArgs...)
+		if sharedDB {
+			vulnArgs = append([]string{"--skip-db-update"}, vulnArgs...)
+			initContainers = append(initContainers, corev1.Container{
+				Name:         "trivy-db",
+				Image:        "aquasec/trivy:0.68.1",
+				Command:      []string{"sh", "-c"},
+				Args:         []string{fmt.Sprintf("rm -rf %[2]s && mkdir -p %[2]s && cp -r %[1]s/db %[2]s/", inJob(sc.TrivyDir()), jobDir)},
+				VolumeMounts: mounts,
+			})
+		}
+	}
+	if s.runSBOM {
+		initContainers = append(initContainers, corev1.Container{
+			Name:         "trivy-sbom",
+			Image:        "aquasec/trivy:0.68.1",
+			Command:      []string{"trivy", "image"},
+			Args:         sbomArgs,
+			VolumeMounts: mounts,
+		})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:  corev1.RestartPolicyNever,
+					InitContainers: initContainers,
+					Containers: []corev1.Container{
+						{
+							Name:         "trivy",
+							Image:        "aquasec/trivy:0.68.1",
+							Command:      []string{"trivy", "sbom"},
+							Args:         vulnArgs,
+							VolumeMounts: mounts,
+						},
+					},
+					Volumes: []corev1.Volume{reportsVolume()},
+				},
+			},
+		},
+	}
 }
 
+// rekorKeyDir is where provenance jobs mount the rekor-key ConfigMap,
+// REKOR_PUBLIC_KEY names a file in it.
+const rekorKeyDir = "/rekor"
+
+// provenanceJob verifies the signatures and attestations of img into the
+// folder output.
+func provenanceJob(name, namespace, reportsPath, img, output string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:            "provenor",
+							Image:           "helm-auditor:latest",
+							ImagePullPolicy: corev1.PullNever,
+							Command:         []string{"/auditor-provenor"},
+							Env: []corev1.EnvVar{
+								{Name: "PROV_IMAGE", Value: img},
+								{Name: "OUTPUT_FOLDER", Value: output},
+								{Name: "REKOR_URL", Value: os.Getenv("REKOR_URL")},
+								{Name: "REKOR_PUBLIC_KEY", Value: os.Getenv("REKOR_PUBLIC_KEY")},
+								{Name: "NOTATION_TRUST_STORE", Value: os.Getenv("NOTATION_TRUST_STORE")},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "reports", MountPath: reportsPath},
+								{Name: "rekor-key", MountPath: rekorKeyDir, ReadOnly: true},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{reportsVolume(), {
+						Name: "rekor-key",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "rekor-key"},
+								Optional:             ptr.To(true),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func reportsVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: "reports",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: "reports-pvc",
+			},
+		},
+	}
+}
@@ -5,6 +5,16 @@ import (
     "fmt"
     "os"
     "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/Masterminds/semver/v3"
+
+    "helm-auditor/internal/audit"
+    "helm-auditor/internal/policy"
+    "helm-auditor/internal/reports"
+    "helm-auditor/internal/types"
+    "helm-auditor/internal/values"
 )
 
 type TrivyReport struct {
@@ -25,12 +35,6 @@ type TrivyReport struct {
     } `json:"Results"`
 }
 
-type VulnReport struct {
-    Results []struct {
-        Vulnerabilities []json.RawMessage `json:"Vulnerabilities"`
-    } `json:"Results"`
-}
-
 // CycloneDX flexible structure
 type Sbom struct {
     Components []struct {
@@ -59,6 +63,7 @@ func main() {
     reportsPath := os.Getenv("OUTPUT_FOLDER")
 
     summary := AuditSummary{}
+    misconfigs := map[string]int{}
     sbomComponents := 0
     sbomVulns := 0
 
@@ -82,6 +87,7 @@ func main() {
 
         for _, m := range r.Misconfigurations {
             summary.TotalMisconfigs++
+            misconfigs[m.Severity]++
             switch m.Severity {
             case "CRITICAL":
                 summary.Criticals++
@@ -124,17 +130,12 @@ func main() {
     // Load vuln reports
     vulnFiles, _ := filepath.Glob(filepath.Join(chartFolder, "*.vulns.json"))
     for _, f := range vulnFiles {
-        data, _ := os.ReadFile(f)
-
-        var vr VulnReport
-        if err := json.Unmarshal(data, &vr); err != nil {
+        vulns, err := reports.LoadVulnerabilities(f)
+        if err != nil {
             fmt.Println("Skipping invalid vuln report:", f, err)
             continue
         }
-
-        for _, r := range vr.Results {
-            sbomVulns += len(r.Vulnerabilities)
-        }
+        sbomVulns += len(vulns)
     }
 
     summary.Vulns = sbomVulns
@@ -150,12 +151,234 @@ func main() {
     fmt.Println("Audit report written to", resultPath)
     fmt.Println(string(out))
 
-    if summary.Criticals > 0 {
-        fmt.Println("Critical issues detected. Failing stage.")
+    templatesDir := "/templates"
+    if len(os.Args) > 1 {
+        templatesDir = os.Args[1]
+    }
+    chartsDir := os.Getenv("CHARTS_DIR")
+    if chartsDir == "" {
+        chartsDir = "/charts"
+    }
+    kubeVersion := os.Getenv("KUBE_VERSION")
+    if kubeVersion == "" {
+        kubeVersion = audit.DefaultKubeVersion
+    }
+    manifestAudit := auditManifests(templatesDir, filepath.Join(chartsDir, promChart), reportsPath, kubeVersion)
+    maOut, _ := json.MarshalIndent(manifestAudit, "", "  ")
+    maPath := filepath.Join(reportsPath, "manifest-audit.json")
+    if err := os.WriteFile(maPath, maOut, 0644); err != nil {
+        panic(err)
+    }
+    fmt.Println("Manifest audit written to", maPath, "findings:", len(manifestAudit.Findings))
+
+    pol := policy.Default()
+    if policyFile := os.Getenv("POLICY_FILE"); policyFile != "" {
+        pol, err = policy.Load(policyFile)
+        if err != nil {
+            panic(err)
+        }
+    }
+
+    gate := policy.Evaluate(pol, gateInput(reportsPath, misconfigs), time.Now().UTC())
+
+    gateOut, _ := json.MarshalIndent(gate, "", "  ")
+    gatePath := filepath.Join(reportsPath, "gate-result.json")
+    if err := os.WriteFile(gatePath, gateOut, 0644); err != nil {
+        panic(err)
+    }
+    fmt.Println("Gate result written to", gatePath)
+    if err := reports.MarkAuditorDone(reportsPath, os.Getenv("RUN_ID")); err != nil {
+        fmt.Println("Cannot signal the reporter:", err)
+    }
+
+    if !gate.Passed {
+        fmt.Println("Policy gate failed:")
+        for _, f := range gate.Failures {
+            fmt.Println(" -", f)
+        }
         os.Exit(1)
     }
 
-    fmt.Println("No critical issues. Continue.")
+    fmt.Println("Policy gate passed. Continue.")
     os.Exit(0)
 }
 
+// auditManifests runs the native checks over the rendered templates and
+// the chart values, and writes the resource graph next to the reports.
+// kubeVersion is the cluster version the chart is meant for.
+func auditManifests(templatesDir, chartDir, reportsPath, kubeVersion string) *reports.ManifestAudit {
+    manifests, warnings, err := audit.LoadManifests(templatesDir)
+    if err != nil {
+        fmt.Println("Cannot load rendered templates:", err)
+    }
+
+    graph := audit.BuildGraph(manifests)
+    if err := graph.Write(filepath.Join(reportsPath, "graph")); err != nil {
+        fmt.Println("Cannot write resource graph:", err)
+    }
+
+    findings := audit.Check(manifests, audit.DefaultRules)
+    rbac := audit.AnalyzeRBAC(manifests)
+    findings = append(findings, rbac.Findings...)
+    findings = append(findings, audit.CorrelateRBAC(graph, findings, rbac.Workloads)...)
+    network := audit.AnalyzeNetwork(manifests, graph)
+    findings = append(findings, network.Findings...)
+    pss := audit.EvaluatePSS(manifests)
+    findings = append(findings, pss.Findings...)
+
+    apis, err := audit.CheckAPIVersions(manifests, kubeVersion)
+    if err != nil {
+        fmt.Println("Cannot check API versions:", err)
+    }
+    findings = append(findings, apis...)
+
+    schemas := validateSchemas(manifests, chartDir, kubeVersion)
+    findings = append(findings, schemas.Findings...)
+
+    var chart *types.ChartMetadata
+    if lint, err := audit.LintChart(chartDir, kubeVersion); err != nil {
+        fmt.Println("Cannot lint chart metadata:", err)
+    } else {
+        chart = lint.Metadata
+        findings = append(findings, lint.Findings...)
+    }
+    if chart != nil {
+        findings = append(findings, valuesDrift(chartDir, reportsPath, chart)...)
+    }
+
+    values, err := audit.LoadValues(chartDir)
+    if err != nil {
+        fmt.Println("Cannot load chart values:", err)
+    }
+    findings = append(findings, audit.ScanSecrets(manifests, values).Findings...)
+
+    deps, err := audit.AuditDependencies(chartDir, audit.DependencyOptions{
+        RepositoryConfig: os.Getenv("HELM_REPOSITORY_CONFIG"),
+        RepositoryCache:  os.Getenv("HELM_REPOSITORY_CACHE"),
+        MaxLockAge:       audit.DefaultMaxLockAge,
+    })
+    var tree *types.ChartNode
+    if err != nil {
+        fmt.Println("Cannot audit chart dependencies:", err)
+    } else {
+        tree = deps.Tree
+        findings = append(findings, deps.Findings...)
+    }
+    audit.AttributeCharts(tree, manifests, findings)
+
+    return &reports.ManifestAudit{
+        Findings:     findings,
+        RBAC:         rbac.Workloads,
+        Network:      network.Report,
+        PSS:          pss.Report,
+        Chart:        chart,
+        Dependencies: tree,
+        KubeVersion:  kubeVersion,
+        Unvalidated:  schemas.Unvalidated,
+        Warnings:     warnings,
+    }
+}
+
+// valuesDrift stores the schema inferred from the chart defaults under
+// values-schema/<version>.json in the reports folder and compares it with
+// the one of the closest older chart version audited before.
+func valuesDrift(chartDir, reportsPath string, chart *types.ChartMetadata) []types.Finding {
+    defaults, err := values.Load(filepath.Join(chartDir, "values.yaml"))
+    if err != nil {
+        fmt.Println("Cannot read chart values:", err)
+        return nil
+    }
+    inferred := values.Infer(defaults.Values)
+
+    dir := filepath.Join(reportsPath, "values-schema")
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        fmt.Println("Cannot store values schema:", err)
+        return nil
+    }
+    out, _ := json.MarshalIndent(inferred, "", "  ")
+    if err := os.WriteFile(filepath.Join(dir, chart.Version+".json"), out, 0644); err != nil {
+        fmt.Println("Cannot store values schema:", err)
+        return nil
+    }
+
+    current, err := semver.NewVersion(chart.Version)
+    if err != nil {
+        return nil
+    }
+    entries, _ := os.ReadDir(dir)
+    var previous *semver.Version
+    var from string
+    for _, e := range entries {
+        name := strings.TrimSuffix(e.Name(), ".json")
+        v, err := semver.NewVersion(name)
+        if err != nil || v.Compare(current) >= 0 || (from != "" && v.Compare(previous) <= 0) {
+            continue
+        }
+        previous, from = v, name
+    }
+    if from == "" {
+        return nil
+    }
+    old, err := values.LoadSchema(filepath.Join(dir, from+".json"))
+    if err != nil {
+        fmt.Println("Cannot read previous values schema:", err)
+        return nil
+    }
+    return values.DriftFindings(values.Drift(old, inferred), defaults, chart.Name, from)
+}
+
+// validateSchemas checks the rendered documents against the bundled
+// OpenAPI schemas (SCHEMA_DIR) of kubeVersion and, unless CRD_SCHEMAS is
+// false, the CRDs rendered or shipped in the crds/ directories of the chart.
+func validateSchemas(manifests []*audit.Manifest, chartDir, kubeVersion string) *audit.Validation {
+    schemaDir := os.Getenv("SCHEMA_DIR")
+    if schemaDir == "" {
+        schemaDir = audit.DefaultSchemaDir
+    }
+    validator, err := audit.NewValidator(schemaDir, kubeVersion)
+    if err != nil {
+        fmt.Println("WARNING: skipping schema validation:", err)
+        return &audit.Validation{Findings: []types.Finding{audit.SchemasUnavailable(schemaDir, kubeVersion, err)}}
+    }
+
+    if os.Getenv("CRD_SCHEMAS") != "false" {
+        crds, err := audit.LoadCRDs(chartDir)
+        if err != nil {
+            fmt.Println("Cannot load chart CRDs:", err)
+        }
+        validator.AddCRDs(crds)
+        validator.AddCRDs(manifests)
+    }
+    return validator.Validate(manifests)
+}
+
+// gateInput gathers the per image evidence left by the aggregator jobs.
+func gateInput(reportsPath string, misconfigs map[string]int) policy.Input {
+    in := policy.Input{Misconfigurations: misconfigs}
+
+    images, err := reports.ReadImages(reportsPath)
+    if err != nil {
+        fmt.Println("Cannot read images.txt:", err)
+        return in
+    }
+
+    for _, img := range images {
+        paths := reports.PathsFor(reportsPath, img)
+        pi := policy.Image{Name: img}
+
+        if vulns, err := reports.LoadVulnerabilities(paths.Vulns); err == nil {
+            pi.Vulns = reports.CountBySeverity(vulns)
+        }
+        if prov, err := reports.LoadProvenance(paths); err == nil {
+            pi.Signed = prov.Signed
+            pi.SignedBy = prov.VerifiedBy
+            pi.Created = prov.Created
+            if prov.SLSA != nil {
+                pi.SLSALevel = prov.SLSA.Level
+            }
+        }
+
+        in.Images = append(in.Images, pi)
+    }
+    return in
+}
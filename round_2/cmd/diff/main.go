@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm-auditor/internal/diff"
+	"helm-auditor/internal/render"
+	"helm-auditor/internal/reports"
+)
+
+// Compares two audits and writes audit-diff.json and audit-diff.md to
+// OUTPUT_FOLDER:
+//
+//	auditor-diff OLD NEW
+//
+// OLD and NEW are audit result directories, audit-images.json files or
+// chart versions audited before into OUTPUT_FOLDER.
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Println("usage: auditor-diff OLD NEW")
+		fmt.Println("OLD and NEW are audit result directories, audit-images.json files or chart versions")
+		os.Exit(2)
+	}
+	reportsPath := os.Getenv("OUTPUT_FOLDER")
+
+	old, err := load(os.Args[1], reportsPath)
+	if err != nil {
+		fmt.Println("Cannot read audit:", err)
+		os.Exit(1)
+	}
+	cur, err := load(os.Args[2], reportsPath)
+	if err != nil {
+		fmt.Println("Cannot read audit:", err)
+		os.Exit(1)
+	}
+
+	r := diff.Compare(old, cur)
+	md := render.DiffMarkdown(r, render.DefaultMarkdownOptions())
+	fmt.Print(md)
+
+	if reportsPath == "" {
+		return
+	}
+	outData, _ := json.MarshalIndent(r, "", "  ")
+	outFile := filepath.Join(reportsPath, "audit-diff.json")
+	if err := os.WriteFile(outFile, outData, 0644); err != nil {
+		fmt.Println("Error writing audit diff:", err)
+		os.Exit(1)
+	}
+	mdFile := filepath.Join(reportsPath, "audit-diff.md")
+	if err := os.WriteFile(mdFile, []byte(md), 0644); err != nil {
+		fmt.Println("Error writing audit diff:", err)
+		os.Exit(1)
+	}
+	fmt.Println("\nAudit diff written to", outFile, "and", mdFile)
+}
+
+// load reads the audit arg names: a directory holding audit-images.json,
+// the file itself or a chart version archived under reportsPath.
+func load(arg, reportsPath string) (*reports.ExtendedAudit, error) {
+	info, err := os.Stat(arg)
+	switch {
+	case err == nil && info.IsDir():
+		return reports.LoadAudit(filepath.Join(arg, "audit-images.json"))
+	case err == nil:
+		return reports.LoadAudit(arg)
+	case reportsPath != "":
+		if a, err := reports.LoadAudit(reports.ArchivePath(reportsPath, arg)); err == nil {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is neither an audit nor a chart version audited in %q", arg, reportsPath)
+}
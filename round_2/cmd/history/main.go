@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"helm-auditor/internal/history"
+	"helm-auditor/internal/policy"
+	"helm-auditor/internal/reports"
+	"helm-auditor/internal/types"
+)
+
+// Queries the audit history database (HISTORY_DB):
+//
+//	auditor-history                            charts and values variants recorded
+//	auditor-history CHART [VARIANT]            counts of every audit and time to fix
+//	auditor-history CHART VARIANT VERSION      counts of the audits of one version
+func main() {
+	path := os.Getenv("HISTORY_DB")
+	if path == "" {
+		path = filepath.Join(reports.Root, "history.db")
+	}
+	store, err := history.Open(path, 5*time.Second)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	if len(os.Args) < 2 {
+		charts, err := store.Charts()
+		if err != nil {
+			fmt.Println("Cannot read history:", err)
+			os.Exit(1)
+		}
+		names := make([]string, 0, len(charts))
+		for c := range charts {
+			names = append(names, c)
+		}
+		sort.Strings(names)
+		for _, c := range names {
+			fmt.Printf("%s\t%s\n", c, strings.Join(charts[c], ", "))
+		}
+		return
+	}
+
+	chart, variant := os.Args[1], history.DefaultVariant
+	if len(os.Args) > 2 {
+		variant = os.Args[2]
+	}
+	version := ""
+	if len(os.Args) > 3 {
+		version = os.Args[3]
+	}
+	var trend []types.TrendPoint
+	if version != "" {
+		records, err := store.VersionRecords(chart, variant, version)
+		if err != nil {
+			fmt.Println("Cannot read history:", err)
+			os.Exit(1)
+		}
+		for _, r := range records {
+			trend = append(trend, r.Point())
+		}
+	} else if trend, err = store.Trend(chart, variant, time.Time{}); err != nil {
+		fmt.Println("Cannot read history:", err)
+		os.Exit(1)
+	}
+	if len(trend) == 0 {
+		fmt.Printf("No audit of %s (%s) recorded.\n", strings.TrimSpace(chart+" "+version), variant)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tVERSION\tCRITICAL\tHIGH\tMEDIUM\tLOW\tMISCONFIGS\tFINDINGS")
+	for _, p := range trend {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n", p.Time.Format(time.RFC3339), p.Version,
+			p.Vulns["CRITICAL"], p.Vulns["HIGH"], p.Vulns["MEDIUM"], p.Vulns["LOW"],
+			p.Misconfigurations, p.Findings)
+	}
+	w.Flush()
+	if version != "" {
+		return
+	}
+
+	ttf, err := store.TimeToFix(chart, variant, time.Time{})
+	if err != nil {
+		fmt.Println("Cannot read history:", err)
+		os.Exit(1)
+	}
+	if len(ttf) == 0 {
+		return
+	}
+	fmt.Println("\nMean time to fix:")
+	for _, sev := range policy.Severities {
+		if d, ok := ttf[sev]; ok {
+			fmt.Printf("  %-8s %.1f days\n", sev, d)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"helm-auditor/internal/osv"
+	"helm-auditor/internal/trivy"
+)
+
+// Matches an SBOM against the offline OSV export at OSV_DB:
+//
+//	auditor-osv SBOM               vulnerabilities of the SBOM components
+//	auditor-osv SBOM TRIVY_REPORT  compared with a trivy report of the image
+func main() {
+	path := os.Getenv("OSV_DB")
+	if path == "" || len(os.Args) < 2 {
+		fmt.Println("usage: OSV_DB=<dir> auditor-osv <sbom.cdx.json> [trivy report]")
+		os.Exit(2)
+	}
+	comps, err := osv.LoadSBOM(os.Args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	db, err := osv.Load(path, comps)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	matches := db.Match(comps)
+
+	if len(os.Args) < 3 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSEVERITY\tPACKAGE\tINSTALLED\tFIXED")
+		for _, m := range matches {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.ID, m.Severity, m.Package, m.InstalledVersion, m.FixedVersion)
+		}
+		w.Flush()
+		fmt.Printf("\n%d vulnerabilities in %d components, %d OSV entries loaded\n", len(matches), len(comps), db.Entries)
+		return
+	}
+
+	report, err := trivy.Load(os.Args[2])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	check := osv.CrossCheck(db, matches, report.Vulnerabilities())
+	fmt.Printf("%d found by both, %d only in OSV, %d only in trivy\n",
+		check.Both, len(check.OSVOnly), len(check.TrivyOnly))
+	for _, v := range check.OSVOnly {
+		fmt.Printf("  OSV only:   %s %s %s\n", v.ID, v.Package, v.InstalledVersion)
+	}
+	for _, v := range check.TrivyOnly {
+		fmt.Printf("  trivy only: %s %s %s\n", v.ID, v.Package, v.InstalledVersion)
+	}
+	if len(check.OSVOnly)+len(check.TrivyOnly) > 0 {
+		os.Exit(3)
+	}
+}
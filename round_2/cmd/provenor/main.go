@@ -10,9 +10,15 @@ import (
 func main() {
     image := os.Getenv("PROV_IMAGE")
     output := os.Getenv("OUTPUT_FOLDER")
+    cfg := provenance.Config{
+        RekorURL:           os.Getenv("REKOR_URL"),
+        RekorPublicKey:     os.Getenv("REKOR_PUBLIC_KEY"),
+        NotationTrustStore: os.Getenv("NOTATION_TRUST_STORE"),
+    }
 
     fmt.Printf("[provenor] PROV_IMAGE=%s\n", image)
     fmt.Printf("[provenor] OUTPUT_FOLDER=%s\n", output)
+    fmt.Printf("[provenor] REKOR_URL=%s\n", cfg.RekorURL)
 
     if image == "" {
         panic("PROV_IMAGE empty")
@@ -21,7 +27,7 @@ func main() {
         panic("OUTPUT_FOLDER empty")
     }
 
-    if err := provenance.Run(image, output); err != nil {
+    if err := provenance.Run(image, output, cfg); err != nil {
         panic(err)
     }
 
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"helm-auditor/internal/history"
+	"helm-auditor/internal/reports"
+	"helm-auditor/internal/types"
+)
+
+// recordHistory stores the audit in the history database (HISTORY_DB,
+// history.db at the root of the reports volume by default) under the
+// values variant VALUES_VARIANT, and marks what is new since the last
+// audit of the chart.
+func recordHistory(extended *reports.ExtendedAudit) *types.AuditHistory {
+	path := os.Getenv("HISTORY_DB")
+	if path == "" {
+		path = filepath.Join(reports.Root, "history.db")
+	}
+	store, err := history.Open(path, 30*time.Second)
+	if err != nil {
+		fmt.Println("Cannot open audit history:", err)
+		return nil
+	}
+	defer store.Close()
+
+	h, err := store.Annotate(extended, os.Getenv("VALUES_VARIANT"), time.Now().UTC())
+	if err != nil {
+		fmt.Println("Cannot record audit history:", err)
+		return nil
+	}
+	if h.Previous != nil {
+		fmt.Printf("Since the audit of %s %s: %d new, %d existing, %d resolved\n",
+			extended.Chart.Name, h.Previous.Version, h.New, h.Existing, len(h.Resolved))
+	}
+	return h
+}
@@ -6,36 +6,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-)
-
-type ImageSummary struct {
-	Name            string `json:"name"`
-	Digest          string `json:"digest"`
-	Signed          bool   `json:"signed"`
-	Components      int    `json:"components"`
-	Vulnerabilities int    `json:"vulnerabilities"`
-}
+	"time"
 
-type ExtendedAudit struct {
-	Chart struct {
-		Name    string `json:"name"`
-		URL     string `json:"url"`
-		Version string `json:"version"`
-	} `json:"chart"`
-
-	ImagesSummary struct {
-		Total  int            `json:"total_images"`
-		Images []ImageSummary `json:"images"`
-	} `json:"images_summary"`
-
-	TotalMisconfigs int `json:"total_misconfigs"`
-	TotalFailures   int `json:"total_failures"`
-	TotalSuccesses  int `json:"total_successes"`
-	Criticals       int `json:"criticals"`
-	Highs           int `json:"highs"`
-	Components      int `json:"components"`
-	Vulns           int `json:"vulns"`
-}
+	"helm-auditor/internal/remediation"
+	"helm-auditor/internal/render"
+	"helm-auditor/internal/reports"
+	"helm-auditor/internal/trivy"
+	"helm-auditor/internal/types"
+)
 
 func countComponents(sbomData []byte) int {
 	compCount := 0
@@ -68,22 +46,6 @@ func countComponents(sbomData []byte) int {
 	return compCount
 }
 
-func countVulns(vulnData []byte) int {
-	vCount := 0
-	var raw struct {
-		Results []struct {
-			Vulnerabilities []any `json:"Vulnerabilities"`
-		} `json:"Results"`
-	}
-	if err := json.Unmarshal(vulnData, &raw); err != nil {
-		return 0
-	}
-	for _, r := range raw.Results {
-		vCount += len(r.Vulnerabilities)
-	}
-	return vCount
-}
-
 func main() {
 	chartName := os.Getenv("PROM_CHART")
 	chartRepo := os.Getenv("PROM_REPO")
@@ -91,7 +53,7 @@ func main() {
 	reportsPath := os.Getenv("OUTPUT_FOLDER")
 	imagesFile := filepath.Join(reportsPath, "images.txt")
 
-	extended := ExtendedAudit{}
+	extended := reports.ExtendedAudit{}
 	extended.Chart.Name = chartName
 	extended.Chart.URL = fmt.Sprintf("%s%s", chartRepo, chartName)
 	extended.Chart.Version = chartVersion
@@ -108,35 +70,74 @@ func main() {
 	totalComponents := 0
 	totalVulns := 0
 
-	sbomFiles, _ := filepath.Glob(filepath.Join(reportsPath, "*.cdx.json"))
-        vulnFiles, _ := filepath.Glob(filepath.Join(reportsPath, "*.vulns.json"))
-        provFiles, _ := filepath.Glob(filepath.Join(reportsPath, "*.prov.json"))
+        matcher := openOSV(reportsPath, images)
         
-        for i, img := range images {
+        for _, img := range images {
             compCount := 0
-            vCount := 0
             signed := false
-        
-            if i < len(sbomFiles) {
-                data, _ := os.ReadFile(sbomFiles[i])
+
+            paths := reports.PathsFor(reportsPath, img)
+            if data, err := os.ReadFile(paths.SBOM); err == nil {
                 compCount = countComponents(data)
                 totalComponents += compCount
             }
-            if i < len(vulnFiles) {
-                data, _ := os.ReadFile(vulnFiles[i])
-                vCount = countVulns(data)
-                totalVulns += vCount
+            var cves []types.Vulnerability
+            vr, err := trivy.Load(paths.Vulns)
+            if err == nil {
+                cves = vr.Vulnerabilities()
+            } else if !os.IsNotExist(err) {
+                fmt.Println("Cannot read vuln report for", img, err)
             }
-            if i < len(provFiles) {
-                signed = true
+            var osvScan *types.OSVScan
+            if matcher != nil {
+                cves, osvScan = matcher.scan(img, cves, vr != nil)
+            }
+            remediation.Annotate(cves)
+            rem := remediation.Analyze(cves, remediation.DetectBase(paths.SBOM, vr))
+            vCount := len(cves)
+            totalVulns += vCount
+
+            var signers []types.SignerIdentity
+            var signedBy []string
+            var artifacts []types.ReferrerArtifact
+            var slsa *types.SLSAProvenance
+            var created time.Time
+            digest := ""
+            unlogged := 0
+            if prov, err := reports.LoadProvenance(paths); err == nil {
+                signed = prov.Signed
+                signedBy = prov.VerifiedBy
+                artifacts = prov.Artifacts
+                digest = prov.Digest
+                slsa = prov.SLSA
+                created = prov.Created
+                for _, s := range prov.Signatures {
+                    if s.Signer != nil {
+                        signers = append(signers, *s.Signer)
+                    }
+                    if s.Scheme == "cosign" && (s.Tlog == nil || !s.Tlog.Present) {
+                        unlogged++
+                    }
+                }
             }
         
-            extended.ImagesSummary.Images = append(extended.ImagesSummary.Images, ImageSummary{
+            extended.ImagesSummary.Images = append(extended.ImagesSummary.Images, reports.ImageSummary{
                 Name:            img,
-                Digest:          "", // opcional: puedes leer digest desde SBOM si quieres
+                Digest:          digest,
                 Signed:          signed,
                 Components:      compCount,
                 Vulnerabilities: vCount,
+                VulnsBySeverity: reports.CountBySeverity(cves),
+                CVEs:            cves,
+                Remediation:     rem,
+                OSV:             osvScan,
+                SignedBy:        signedBy,
+                Signers:         signers,
+
+                UnloggedSignatures: unlogged,
+                Artifacts:          artifacts,
+                SLSA:               slsa,
+                Created:            created,
             })
         
             fmt.Println("SBOM loaded for", img, "components:", compCount)
@@ -176,7 +177,7 @@ func main() {
 	//		signed = true
 	//	}
 
-	//	extended.ImagesSummary.Images = append(extended.ImagesSummary.Images, ImageSummary{
+	//	extended.ImagesSummary.Images = append(extended.ImagesSummary.Images, reports.ImageSummary{
 	//		Name:            img,
 	//		Digest:          hash,
 	//		Signed:          signed,
@@ -189,31 +190,31 @@ func main() {
 	//}
 
 	// Parte auditor Trivy
-	trivyFile := filepath.Join(reportsPath, chartName, chartName+".report.trivy.json")
-	if data, err := os.ReadFile(trivyFile); err == nil {
-		var trivy struct {
-			Results []struct {
-				MisconfSummary struct {
-					Successes int `json:"Successes"`
-					Failures  int `json:"Failures"`
-				} `json:"MisconfSummary"`
-				Misconfigurations []struct {
-					Severity string `json:"Severity"`
-				} `json:"Misconfigurations"`
-			} `json:"Results"`
-		}
-		if err := json.Unmarshal(data, &trivy); err == nil {
-			for _, r := range trivy.Results {
-				extended.TotalFailures += r.MisconfSummary.Failures
-				extended.TotalSuccesses += r.MisconfSummary.Successes
-				for _, m := range r.Misconfigurations {
-					extended.TotalMisconfigs++
-					switch m.Severity {
-					case "CRITICAL":
-						extended.Criticals++
-					case "HIGH":
-						extended.Highs++
-					}
+	configReport, err := trivy.Load(reports.TrivyConfigPath(chartName))
+	if err != nil {
+		fmt.Println("Cannot read trivy config report:", err)
+	} else {
+		for _, r := range configReport.Results {
+			extended.TotalFailures += r.MisconfSummary.Failures
+			extended.TotalSuccesses += r.MisconfSummary.Successes
+			for _, m := range r.Misconfigurations {
+				extended.TotalMisconfigs++
+				extended.Misconfigurations = append(extended.Misconfigurations, reports.Misconfiguration{
+					ID:         m.ID,
+					Title:      m.Title,
+					Severity:   m.Severity,
+					Message:    m.Message,
+					Resolution: m.Resolution,
+					URL:        m.PrimaryURL,
+					Resource:   m.CauseMetadata.Resource,
+					File:       r.Target,
+					StartLine:  m.CauseMetadata.StartLine,
+				})
+				switch m.Severity {
+				case "CRITICAL":
+					extended.Criticals++
+				case "HIGH":
+					extended.Highs++
 				}
 			}
 		}
@@ -222,6 +223,35 @@ func main() {
 	extended.Components = totalComponents
 	extended.Vulns = totalVulns
 
+	// The auditor runs next to the reporter, wait for this run's gate.
+	auditorTimeout := 30 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("AUDITOR_TIMEOUT")); err == nil {
+		auditorTimeout = d
+	}
+	auditorDone := true
+	if err := reports.WaitAuditor(reportsPath, os.Getenv("RUN_ID"), auditorTimeout); err != nil {
+		fmt.Println("Reporting without the auditor results:", err)
+		auditorDone = false
+	}
+	if gate, err := reports.LoadGate(reportsPath); err == nil && auditorDone {
+		extended.Gate = gate
+	}
+	if stats, err := reports.LoadScanCache(reportsPath); err == nil {
+		extended.ScanCache = stats
+	}
+	if ma, err := reports.LoadManifestAudit(reportsPath); err == nil && auditorDone {
+		extended.Manifests = ma
+		extended.Chart.Metadata = ma.Chart
+		for i := range extended.ImagesSummary.Images {
+			extended.ImagesSummary.Images[i].Charts = chartsDeploying(ma.Dependencies, extended.ImagesSummary.Images[i].Name)
+		}
+	}
+
+	// Without this run's manifest audit every finding would look resolved.
+	if auditorDone {
+		extended.History = recordHistory(&extended)
+	}
+
 	outFile := filepath.Join(reportsPath, "audit-images.json")
 	outData, _ := json.MarshalIndent(extended, "", "  ")
 	if err := os.WriteFile(outFile, outData, 0644); err != nil {
@@ -230,5 +260,68 @@ func main() {
 	}
 
 	fmt.Println("Extended audit report written to", outFile)
+
+	if chartVersion != "" && auditorDone {
+		archive := reports.ArchivePath(reportsPath, chartVersion)
+		err := os.MkdirAll(filepath.Dir(archive), 0755)
+		if err == nil {
+			err = os.WriteFile(archive, outData, 0644)
+		}
+		if err != nil {
+			fmt.Println("Cannot archive audit report:", err)
+		}
+	}
+
+	htmlFile := filepath.Join(reportsPath, "audit-report.html")
+	if err := render.WriteHTML(htmlFile, &extended); err != nil {
+		fmt.Println("Error writing HTML report:", err)
+		os.Exit(1)
+	}
+	fmt.Println("HTML report written to", htmlFile)
+
+	var prev *reports.ExtendedAudit
+	if prevFile := os.Getenv("PREVIOUS_AUDIT"); prevFile != "" {
+		if prev, err = reports.LoadAudit(prevFile); err != nil {
+			fmt.Println("Cannot read previous audit, summary without deltas:", err)
+		}
+	}
+	mdFile := filepath.Join(reportsPath, "audit-summary.md")
+	if err := render.WriteMarkdown(mdFile, &extended, prev, render.DefaultMarkdownOptions()); err != nil {
+		fmt.Println("Error writing Markdown summary:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Markdown summary written to", mdFile)
+
+	templatesDir := os.Getenv("TEMPLATES_DIR")
+	if templatesDir == "" {
+		templatesDir = "/templates"
+	}
+	sarifFile := filepath.Join(reportsPath, "audit.sarif")
+	var findings []types.Finding
+	if extended.Manifests != nil {
+		findings = extended.Manifests.Findings
+	}
+	if err := writeSARIF(sarifFile, reportsPath, templatesDir, images, configReport, findings); err != nil {
+		fmt.Println("Error writing SARIF report:", err)
+		os.Exit(1)
+	}
+	fmt.Println("SARIF report written to", sarifFile)
 }
 
+// chartsDeploying lists the charts of the dependency tree rendering image.
+func chartsDeploying(node *types.ChartNode, image string) []string {
+	if node == nil {
+		return nil
+	}
+	var out []string
+	for _, img := range node.Images {
+		if img == image {
+			out = append(out, node.ID)
+			break
+		}
+	}
+	for _, d := range node.Dependencies {
+		out = append(out, chartsDeploying(d, image)...)
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"helm-auditor/internal/osv"
+	"helm-auditor/internal/reports"
+	"helm-auditor/internal/types"
+)
+
+// osvScanner matches the image SBOMs against the offline OSV export at
+// OSV_DB.
+type osvScanner struct {
+	db    *osv.DB
+	sboms map[string][]osv.Component
+}
+
+// openOSV loads the OSV entries affecting the components of the image
+// SBOMs, once for all images. It returns nil when OSV_DB is not set or
+// cannot be read.
+func openOSV(reportsPath string, images []string) *osvScanner {
+	path := os.Getenv("OSV_DB")
+	if path == "" {
+		return nil
+	}
+	s := &osvScanner{sboms: map[string][]osv.Component{}}
+	all := []osv.Component{}
+	for _, img := range images {
+		comps, err := osv.LoadSBOM(reports.PathsFor(reportsPath, img).SBOM)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Println("Cannot read SBOM for OSV matching of", img, err)
+			}
+			continue
+		}
+		s.sboms[img] = comps
+		all = append(all, comps...)
+	}
+	db, err := osv.Load(path, all)
+	if err != nil {
+		fmt.Println("Cannot load OSV database:", err)
+		return nil
+	}
+	fmt.Printf("OSV database %s: %d entries for %d components\n", path, db.Entries, len(all))
+	s.db = db
+	return s
+}
+
+// scan matches the SBOM of img. The matches replace the CVEs of images
+// trivy did not scan and are compared with trivy's otherwise.
+func (s *osvScanner) scan(img string, cves []types.Vulnerability, trivyScanned bool) ([]types.Vulnerability, *types.OSVScan) {
+	comps, ok := s.sboms[img]
+	if !ok {
+		return cves, nil
+	}
+	matches := s.db.Match(comps)
+	if !trivyScanned {
+		return osv.Vulnerabilities(matches), &types.OSVScan{Database: s.db.Path, Matched: len(matches)}
+	}
+	check := osv.CrossCheck(s.db, matches, cves)
+	if len(check.OSVOnly)+len(check.TrivyOnly) > 0 {
+		fmt.Printf("OSV and trivy disagree on %s: %d only in OSV, %d only in trivy\n",
+			img, len(check.OSVOnly), len(check.TrivyOnly))
+	}
+	return cves, check
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"helm-auditor/internal/audit"
+	"helm-auditor/internal/reports"
+	"helm-auditor/internal/sarif"
+	"helm-auditor/internal/trivy"
+	"helm-auditor/internal/types"
+)
+
+// writeSARIF exports template misconfigurations, native findings and
+// image CVEs as SARIF. CVEs are located at the workloads referencing the
+// image, found in the rendered templates.
+func writeSARIF(path, reportsPath, templatesDir string, images []string, configReport *trivy.Report, findings []types.Finding) error {
+	log := sarif.NewLog()
+	run := log.AddRun("helm-auditor", "", "")
+
+	if configReport != nil {
+		sarif.AddMisconfigurations(run, configReport)
+	}
+	sarif.AddFindings(run, findings)
+
+	manifests, warnings, err := audit.LoadManifests(templatesDir)
+	if err != nil {
+		fmt.Println("Cannot load rendered templates, CVEs will not be located:", err)
+	}
+	for _, w := range warnings {
+		fmt.Println("Skipping template:", w)
+	}
+	users := audit.ImageUsers(audit.Workloads(manifests))
+
+	for _, img := range images {
+		if img == "" {
+			continue
+		}
+		report, err := trivy.Load(reports.PathsFor(reportsPath, img).Vulns)
+		if err != nil {
+			continue
+		}
+		sarif.AddVulnerabilities(run, img, report, users[img])
+	}
+
+	return log.Write(path)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm-auditor/internal/values"
+)
+
+// Validates the values overrides in VALUES_FILES against the chart
+// values.schema.json before the chart is rendered. Charts without a
+// schema are checked against the schema inferred from their defaults,
+// mismatches are then only warnings.
+func main() {
+	chartsDir := os.Getenv("CHARTS_DIR")
+	if chartsDir == "" {
+		chartsDir = "/charts"
+	}
+	chartDir := filepath.Join(chartsDir, os.Getenv("PROM_CHART"))
+
+	var files []*values.File
+	for _, path := range strings.Split(os.Getenv("VALUES_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		f, err := values.Load(path)
+		if err != nil {
+			fmt.Println("Invalid values file:", err)
+			os.Exit(1)
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		fmt.Println("No values overrides to validate.")
+		return
+	}
+
+	defaults, err := values.Load(filepath.Join(chartDir, "values.yaml"))
+	if err != nil {
+		fmt.Println("Cannot read chart defaults:", err)
+		defaults = &values.File{Values: map[string]any{}}
+	}
+
+	strict := true
+	schema, err := values.LoadSchema(filepath.Join(chartDir, "values.schema.json"))
+	if os.IsNotExist(err) {
+		fmt.Println("Chart has no values.schema.json, checking against the types of its defaults.")
+		schema, strict = values.Infer(defaults.Values), false
+	} else if err != nil {
+		fmt.Println("Invalid values.schema.json:", err)
+		os.Exit(1)
+	}
+
+	errs := values.Validate(schema, values.Merge(defaults.Values, files...))
+	if len(errs) == 0 {
+		fmt.Println("Values overrides are valid.")
+		return
+	}
+
+	for _, e := range errs {
+		fmt.Printf(" - %s: %s\n", origin(e.Path, files), e)
+	}
+	if strict {
+		fmt.Printf("%d values do not match values.schema.json, not rendering the chart.\n", len(errs))
+		os.Exit(1)
+	}
+	fmt.Printf("%d values differ from the type of the chart defaults.\n", len(errs))
+}
+
+// origin names the last values file setting path, as file:line.
+func origin(path []string, files []*values.File) string {
+	for i := len(files) - 1; i >= 0; i-- {
+		for p := path; len(p) > 0; p = p[:len(p)-1] {
+			if line := files[i].LineOf(p); line > 0 {
+				return fmt.Sprintf("%s:%d", files[i].Path, line)
+			}
+		}
+	}
+	return "chart defaults"
+}
@@ -1,6 +1,7 @@
 package audit
 
 import (
+    "fmt"
     "strings"
 
     "gopkg.in/yaml.v3"
@@ -36,10 +37,14 @@ func AuditYAML(yamlText string, chartPath string) (*types.AuditResult, error) {
         if kind != "" {
             result.Kinds[kind]++
         }
+
+        apiVersion, _ := obj["apiVersion"].(string)
+        if d, ok := lookupDeprecation(apiVersion, kind); ok {
+            result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s is removed in 1.%d, %s", apiVersion, kind, d.Removed, migration(d)))
+        }
     }
 
     result.Resources = len(result.AST)
 
     return result, nil
 }
-
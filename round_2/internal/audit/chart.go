@@ -0,0 +1,283 @@
+package audit
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/Masterminds/semver/v3"
+
+    "helm-auditor/internal/types"
+)
+
+// chartFile is the part of Chart.yaml (and of requirements.yaml for
+// apiVersion v1 charts) the linter reads.
+type chartFile struct {
+    APIVersion   string                  `yaml:"apiVersion"`
+    Name         string                  `yaml:"name"`
+    Version      string                  `yaml:"version"`
+    AppVersion   string                  `yaml:"appVersion"`
+    Description  string                  `yaml:"description"`
+    Type         string                  `yaml:"type"`
+    KubeVersion  string                  `yaml:"kubeVersion"`
+    Home         string                  `yaml:"home"`
+    Icon         string                  `yaml:"icon"`
+    Sources      []string                `yaml:"sources"`
+    Maintainers  []types.Maintainer      `yaml:"maintainers"`
+    Dependencies []types.ChartDependency `yaml:"dependencies"`
+    Deprecated   bool                    `yaml:"deprecated"`
+}
+
+// ChartLint is the outcome of LintChart.
+type ChartLint struct {
+    Metadata *types.ChartMetadata
+    Findings []types.Finding
+}
+
+// chartLinter collects the findings on one Chart.yaml.
+type chartLinter struct {
+    m   *Manifest
+    out []types.Finding
+}
+
+func (l *chartLinter) add(key []string, id, title, sev, msg, resolution string) {
+    l.out = append(l.out, types.Finding{
+        RuleID:     id,
+        Title:      title,
+        Severity:   sev,
+        Message:    msg,
+        Resolution: resolution,
+        Resource:   "Chart/" + str(l.m.Object, "name"),
+        Kind:       "Chart",
+        Name:       str(l.m.Object, "name"),
+        File:       l.m.File,
+        Line:       l.m.LineOf(key...),
+        Path:       FieldPath(key),
+    })
+}
+
+// LintChart reads Chart.yaml and the chart tree under chartDir and flags
+// missing or suspicious metadata. kubeVersion is the target cluster, the
+// kubeVersion constraint of the chart is checked against it.
+func LintChart(chartDir, kubeVersion string) (*ChartLint, error) {
+    data, err := os.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+    if err != nil {
+        return nil, fmt.Errorf("reading chart metadata: %w", err)
+    }
+    docs, err := ParseManifests(data, "Chart.yaml")
+    if err != nil || len(docs) == 0 {
+        return nil, fmt.Errorf("parsing Chart.yaml: %v", err)
+    }
+    m := docs[0]
+    var cf chartFile
+    if err := m.node.Decode(&cf); err != nil {
+        return nil, fmt.Errorf("parsing Chart.yaml: %w", err)
+    }
+    if cf.APIVersion == "v1" && len(cf.Dependencies) == 0 {
+        cf.Dependencies = legacyRequirements(chartDir)
+    }
+
+    meta := &types.ChartMetadata{
+        APIVersion:   cf.APIVersion,
+        Name:         cf.Name,
+        Version:      cf.Version,
+        AppVersion:   cf.AppVersion,
+        Description:  cf.Description,
+        Type:         cf.Type,
+        KubeVersion:  cf.KubeVersion,
+        Home:         cf.Home,
+        Sources:      cf.Sources,
+        Maintainers:  cf.Maintainers,
+        Dependencies: cf.Dependencies,
+        Deprecated:   cf.Deprecated,
+        ValuesSchema: exists(filepath.Join(chartDir, "values.schema.json")),
+        Notes:        exists(filepath.Join(chartDir, "templates", "NOTES.txt")),
+        Readme:       exists(filepath.Join(chartDir, "README.md")),
+        Tests:        listFiles(filepath.Join(chartDir, "templates", "tests")),
+        CRDs:         len(listFiles(filepath.Join(chartDir, "crds"))),
+    }
+
+    l := &chartLinter{m: m}
+    l.metadata(cf)
+    l.urls(cf)
+    l.dependencies(cf, chartDir)
+    l.kubeVersion(cf, kubeVersion)
+    l.tree(cf, meta)
+    return &ChartLint{Metadata: meta, Findings: l.out}, nil
+}
+
+func (l *chartLinter) metadata(cf chartFile) {
+    switch cf.APIVersion {
+    case "v2":
+    case "v1":
+        l.add([]string{"apiVersion"}, "HA802", "Legacy chart apiVersion", "LOW",
+            "Chart.yaml uses apiVersion v1, the Helm 2 format",
+            "Move to apiVersion v2 and declare dependencies in Chart.yaml.")
+    default:
+        l.add([]string{"apiVersion"}, "HA802", "Invalid chart apiVersion", "HIGH",
+            fmt.Sprintf("Chart.yaml apiVersion is %q", cf.APIVersion),
+            "Set apiVersion to v2.")
+    }
+
+    if _, err := semver.StrictNewVersion(cf.Version); err != nil {
+        l.add([]string{"version"}, "HA801", "Invalid chart version", "HIGH",
+            fmt.Sprintf("chart version %q is not a SemVer 2 version", cf.Version),
+            "Version the chart as MAJOR.MINOR.PATCH.")
+    }
+    if cf.Deprecated {
+        l.add([]string{"deprecated"}, "HA810", "Deprecated chart", "MEDIUM",
+            fmt.Sprintf("chart %s is marked as deprecated", cf.Name),
+            "Move to the chart that replaces it, deprecated charts get no fixes.")
+    }
+
+    missing := func(key, what string) {
+        l.add([]string{key}, "HA803", "Missing chart metadata", "LOW",
+            fmt.Sprintf("Chart.yaml has no %s", what),
+            "Fill in the field so users can trace the chart and what it deploys.")
+    }
+    if cf.AppVersion == "" && cf.Type != "library" {
+        missing("appVersion", "appVersion")
+    }
+    if cf.Description == "" {
+        missing("description", "description")
+    }
+    if cf.Home == "" && len(cf.Sources) == 0 {
+        missing("sources", "home or sources URL")
+    }
+    if len(cf.Maintainers) == 0 {
+        missing("maintainers", "maintainers")
+    }
+    for i, mt := range cf.Maintainers {
+        if mt.Email == "" && mt.URL == "" {
+            l.add([]string{"maintainers", fmt.Sprint(i)}, "HA811", "Maintainer without contact", "LOW",
+                fmt.Sprintf("maintainer %q has no email or url", mt.Name),
+                "Add an email or url so security issues can be reported.")
+        }
+    }
+}
+
+// urls flags plain HTTP links, which can be tampered with in transit.
+func (l *chartLinter) urls(cf chartFile) {
+    check := func(key []string, what, u string) {
+        if strings.HasPrefix(strings.ToLower(u), "http://") {
+            l.add(key, "HA804", "Insecure chart URL", "MEDIUM",
+                fmt.Sprintf("%s %s uses plain HTTP", what, u),
+                "Use an https:// or oci:// URL.")
+        }
+    }
+    check([]string{"home"}, "home", cf.Home)
+    check([]string{"icon"}, "icon", cf.Icon)
+    for i, s := range cf.Sources {
+        check([]string{"sources", fmt.Sprint(i)}, "source", s)
+    }
+    for i, mt := range cf.Maintainers {
+        check([]string{"maintainers", fmt.Sprint(i), "url"}, "maintainer url", mt.URL)
+    }
+    for i, d := range cf.Dependencies {
+        check([]string{"dependencies", fmt.Sprint(i), "repository"}, "repository of "+d.Name, d.Repository)
+    }
+}
+
+func (l *chartLinter) dependencies(cf chartFile, chartDir string) {
+    for i, d := range cf.Dependencies {
+        key := []string{"dependencies", fmt.Sprint(i)}
+        switch _, err := semver.NewConstraint(d.Version); {
+        case d.Version == "":
+            l.add(sub(key, "version"), "HA805", "Invalid dependency", "MEDIUM",
+                fmt.Sprintf("dependency %s has no version", d.Name),
+                "Pin the dependency to a released version.")
+        case err != nil:
+            l.add(sub(key, "version"), "HA805", "Invalid dependency", "MEDIUM",
+                fmt.Sprintf("dependency %s has an invalid version: %v", d.Name, err),
+                "Pin the dependency to a released version.")
+        }
+        if d.Repository == "" && !exists(filepath.Join(chartDir, "charts", d.Name)) {
+            l.add(key, "HA805", "Invalid dependency", "MEDIUM",
+                fmt.Sprintf("dependency %s has no repository and is not vendored in charts/", d.Name),
+                "Set the repository the dependency is pulled from.")
+        }
+    }
+}
+
+func (l *chartLinter) kubeVersion(cf chartFile, target string) {
+    if cf.KubeVersion == "" {
+        l.add([]string{"kubeVersion"}, "HA806", "No kubeVersion constraint", "LOW",
+            "Chart.yaml does not declare the Kubernetes versions it supports",
+            "Set kubeVersion, for example \">=1.25.0-0\".")
+        return
+    }
+    c, err := semver.NewConstraint(cf.KubeVersion)
+    if err != nil {
+        l.add([]string{"kubeVersion"}, "HA806", "Invalid kubeVersion constraint", "MEDIUM",
+            err.Error(), "Fix the constraint, Helm refuses to install the chart otherwise.")
+        return
+    }
+    v, err := semver.NewVersion(target)
+    if err == nil && !c.Check(v) {
+        l.add([]string{"kubeVersion"}, "HA806", "Unsupported Kubernetes version", "HIGH",
+            fmt.Sprintf("kubeVersion %q excludes the target cluster %s, helm install fails", cf.KubeVersion, target),
+            "Use a chart version supporting the cluster or check the target version.")
+    }
+}
+
+// tree checks the files Helm and users expect next to Chart.yaml.
+func (l *chartLinter) tree(cf chartFile, meta *types.ChartMetadata) {
+    if !meta.ValuesSchema {
+        l.add(nil, "HA807", "No values schema", "LOW",
+            "the chart ships no values.schema.json, values overrides are not validated",
+            "Add a values.schema.json describing the supported values.")
+    }
+    if cf.Type == "library" {
+        return
+    }
+    if !meta.Notes {
+        l.add(nil, "HA808", "No installation notes", "LOW",
+            "the chart has no templates/NOTES.txt",
+            "Add NOTES.txt telling users how to reach and check the release.")
+    }
+    if len(meta.Tests) == 0 {
+        l.add(nil, "HA809", "No chart tests", "LOW",
+            "the chart has no tests under templates/tests",
+            "Add helm test hooks checking the release works.")
+    }
+}
+
+// legacyRequirements reads the dependencies of an apiVersion v1 chart.
+func legacyRequirements(chartDir string) []types.ChartDependency {
+    data, err := os.ReadFile(filepath.Join(chartDir, "requirements.yaml"))
+    if err != nil {
+        return nil
+    }
+    docs, err := ParseManifests(data, "requirements.yaml")
+    if err != nil || len(docs) == 0 {
+        return nil
+    }
+    var req struct {
+        Dependencies []types.ChartDependency `yaml:"dependencies"`
+    }
+    if err := docs[0].node.Decode(&req); err != nil {
+        return nil
+    }
+    return req.Dependencies
+}
+
+func exists(path string) bool {
+    _, err := os.Stat(path)
+    return err == nil
+}
+
+// listFiles returns the names of the files directly under dir.
+func listFiles(dir string) []string {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil
+    }
+    var out []string
+    for _, e := range entries {
+        if !e.IsDir() {
+            out = append(out, e.Name())
+        }
+    }
+    return out
+}
@@ -0,0 +1,523 @@
+package audit
+
+import (
+    "archive/tar"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/Masterminds/semver/v3"
+    "gopkg.in/yaml.v3"
+
+    "helm-auditor/internal/types"
+)
+
+// DefaultMaxLockAge is how old a Chart.lock may be before its
+// dependencies are considered out of date.
+const DefaultMaxLockAge = 365 * 24 * time.Hour
+
+// DependencyOptions tune AuditDependencies. Without a repository config
+// and cache, dependencies are only checked against Chart.lock.
+type DependencyOptions struct {
+    RepositoryConfig string        // helm repositories.yaml, repository names and URLs
+    RepositoryCache  string        // directory holding the <name>-index.yaml files
+    MaxLockAge       time.Duration // 0 disables the Chart.lock age check
+    Now              time.Time
+}
+
+// Dependencies is the outcome of AuditDependencies.
+type Dependencies struct {
+    Tree     *types.ChartNode
+    Findings []types.Finding
+}
+
+// lockFile is Chart.lock, requirements.lock for apiVersion v1 charts.
+type lockFile struct {
+    Dependencies []types.ChartDependency `yaml:"dependencies"`
+    Generated    string                  `yaml:"generated"` // RFC 3339
+}
+
+// vendoredChart is a subchart found under charts/, unpacked or as an
+// archive.
+type vendoredChart struct {
+    dir  string // empty for archives
+    meta chartFile
+}
+
+type depWalker struct {
+    opts    DependencyOptions
+    root    string
+    repos   map[string]string                  // repository URL -> name
+    indexes map[string]map[string][]indexEntry // repository name -> chart -> versions
+    out     []types.Finding
+
+    // Repositories without a cached index -> dependencies not checked
+    unindexed map[string][]string
+}
+
+type indexEntry struct {
+    Version string `yaml:"version"`
+}
+
+// AuditDependencies builds the dependency tree of the chart in chartDir
+// from its Chart.yaml, Chart.lock and charts/ directory, recursively,
+// and flags unpinned (HA821), out of sync (HA822) and out of date
+// (HA823) dependencies. Repositories whose index is not in the helm
+// cache are reported (HA824) as their dependencies could not be checked
+// for newer releases.
+func AuditDependencies(chartDir string, opts DependencyOptions) (*Dependencies, error) {
+    if opts.Now.IsZero() {
+        opts.Now = time.Now().UTC()
+    }
+    w := &depWalker{
+        opts:      opts,
+        root:      chartDir,
+        indexes:   map[string]map[string][]indexEntry{},
+        unindexed: map[string][]string{},
+    }
+    w.loadRepositories()
+
+    tree := &types.ChartNode{Vendored: true, Pinned: true}
+    if err := w.chart(chartDir, tree); err != nil {
+        return nil, err
+    }
+
+    repos := make([]string, 0, len(w.unindexed))
+    for r := range w.unindexed {
+        repos = append(repos, r)
+    }
+    sort.Strings(repos)
+    for _, r := range repos {
+        reason := "no index for it in the helm repository cache"
+        if w.opts.RepositoryCache == "" {
+            reason = "HELM_REPOSITORY_CACHE is not set"
+        } else if strings.HasPrefix(r, "oci://") {
+            reason = "OCI registries have no index"
+        }
+        w.add("Chart.yaml", 0, "dependencies", tree.Name, "HA824", "Dependency freshness unknown", "LOW",
+            fmt.Sprintf("%s not checked for newer releases in %s: %s", strings.Join(w.unindexed[r], ", "), r, reason),
+            "Add the repository with helm repo add and mount the repository cache in the auditor.")
+    }
+    return &Dependencies{Tree: tree, Findings: w.out}, nil
+}
+
+// chart fills node from the chart unpacked in dir and walks its
+// dependencies.
+func (w *depWalker) chart(dir string, node *types.ChartNode) error {
+    rel := w.rel(dir)
+    data, err := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+    if err != nil {
+        return fmt.Errorf("reading chart metadata: %w", err)
+    }
+    docs, err := ParseManifests(data, rel+"Chart.yaml")
+    if err != nil || len(docs) == 0 {
+        return fmt.Errorf("parsing %sChart.yaml: %v", rel, err)
+    }
+    m := docs[0]
+    var cf chartFile
+    if err := m.node.Decode(&cf); err != nil {
+        return fmt.Errorf("parsing %sChart.yaml: %w", rel, err)
+    }
+    if cf.APIVersion == "v1" && len(cf.Dependencies) == 0 {
+        cf.Dependencies = legacyRequirements(dir)
+    }
+    node.Name = cf.Name
+    node.Version = cf.Version
+    node.AppVersion = cf.AppVersion
+    if node.ID == "" {
+        node.ID = cf.Name
+    }
+
+    lock, lockName := readLock(dir)
+    if lock != nil && w.opts.MaxLockAge > 0 {
+        generated, err := time.Parse(time.RFC3339Nano, lock.Generated)
+        if age := w.opts.Now.Sub(generated); err == nil && age > w.opts.MaxLockAge {
+            w.add(rel+lockName, 0, "", cf.Name, "HA823", "Outdated dependency", "LOW",
+                fmt.Sprintf("%s of %s was generated %d days ago", lockName, cf.Name, int(age.Hours()/24)),
+                "Run helm dependency update and review the new subchart versions.")
+        }
+    }
+
+    vendored := w.vendored(dir)
+    for i, dep := range cf.Dependencies {
+        child := &types.ChartNode{
+            ID:         node.ID + "/" + firstNonEmpty(dep.Alias, dep.Name),
+            Name:       dep.Name,
+            Constraint: dep.Version,
+            Repository: dep.Repository,
+            Alias:      dep.Alias,
+            Condition:  dep.Condition,
+        }
+        v, ok := vendored[dep.Name]
+        if ok {
+            delete(vendored, dep.Name)
+            child.Vendored = true
+            child.Version = v.meta.Version
+            child.AppVersion = v.meta.AppVersion
+        }
+        w.check(m, cf.Name, i, dep, lock, lockName, child)
+        node.Dependencies = append(node.Dependencies, child)
+        if ok && v.dir != "" {
+            if err := w.chart(v.dir, child); err != nil {
+                return err
+            }
+        }
+    }
+
+    // Subcharts copied into charts/ without being declared.
+    names := make([]string, 0, len(vendored))
+    for name := range vendored {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        v := vendored[name]
+        child := &types.ChartNode{
+            ID:         node.ID + "/" + name,
+            Name:       name,
+            Version:    v.meta.Version,
+            AppVersion: v.meta.AppVersion,
+            Vendored:   true,
+            Pinned:     true,
+        }
+        node.Dependencies = append(node.Dependencies, child)
+        if v.dir != "" {
+            if err := w.chart(v.dir, child); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// check compares a declared dependency with Chart.lock, the vendored copy
+// and the repository index.
+func (w *depWalker) check(m *Manifest, chart string, i int, dep types.ChartDependency, lock *lockFile, lockName string, child *types.ChartNode) {
+    key := []string{"dependencies", fmt.Sprint(i)}
+    constraint, err := semver.NewConstraint(dep.Version)
+    child.Pinned = err == nil && pinned(dep.Version)
+
+    var locked *types.ChartDependency
+    if lock != nil {
+        for j := range lock.Dependencies {
+            if lock.Dependencies[j].Name == dep.Name {
+                locked = &lock.Dependencies[j]
+                break
+            }
+        }
+    }
+    if locked != nil {
+        child.Locked = locked.Version
+        if child.Version == "" {
+            child.Version = locked.Version
+        }
+    }
+
+    at := func(key []string) (string, int, string) {
+        return m.File, m.LineOf(key...), FieldPath(key)
+    }
+
+    if !child.Pinned {
+        sev, how := "MEDIUM", "nothing pins the resolved version"
+        if locked != nil {
+            sev, how = "LOW", fmt.Sprintf("%s resolves it to %s", lockName, locked.Version)
+        }
+        file, line, path := at(sub(key, "version"))
+        w.add(file, line, path, chart, "HA821", "Unpinned dependency", sev,
+            fmt.Sprintf("dependency %s of %s is declared as %q, %s", dep.Name, chart, dep.Version, how),
+            "Declare the exact subchart version so every build renders the same chart.")
+    }
+
+    outOfSync := func(msg string) {
+        file, line, path := at(key)
+        w.add(file, line, path, chart, "HA822", "Dependency out of sync", "MEDIUM", msg,
+            "Run helm dependency update and commit Chart.lock and charts/ together.")
+    }
+    switch {
+    case lock != nil && locked == nil:
+        outOfSync(fmt.Sprintf("dependency %s of %s is missing from %s", dep.Name, chart, lockName))
+    case locked != nil && err == nil && !checkVersion(constraint, locked.Version):
+        outOfSync(fmt.Sprintf("%s locks %s %s, outside %q", lockName, dep.Name, locked.Version, dep.Version))
+    case locked != nil && child.Vendored && child.Version != locked.Version:
+        outOfSync(fmt.Sprintf("charts/ ships %s %s but %s has %s", dep.Name, child.Version, lockName, locked.Version))
+    }
+    if !child.Vendored {
+        outOfSync(fmt.Sprintf("dependency %s of %s is not vendored under charts/", dep.Name, chart))
+    }
+
+    latest, indexed := w.latest(dep.Repository, dep.Name)
+    if !indexed && dep.Repository != "" && !strings.HasPrefix(dep.Repository, "file://") {
+        if !slices.Contains(w.unindexed[dep.Repository], dep.Name) {
+            w.unindexed[dep.Repository] = append(w.unindexed[dep.Repository], dep.Name)
+        }
+    }
+    if latest != "" && child.Version != "" {
+        cur, err1 := semver.NewVersion(child.Version)
+        last, err2 := semver.NewVersion(latest)
+        if err1 == nil && err2 == nil && last.Compare(cur) > 0 {
+            child.Latest = latest
+            child.Outdated = true
+            sev := "LOW"
+            if last.Major() > cur.Major() {
+                sev = "MEDIUM"
+            }
+            file, line, path := at(key)
+            w.add(file, line, path, chart, "HA823", "Outdated dependency", sev,
+                fmt.Sprintf("%s %s is used, %s is available in %s", dep.Name, child.Version, latest, dep.Repository),
+                "Update the dependency to get the fixes of the newer releases.")
+        }
+    }
+}
+
+func (w *depWalker) add(file string, line int, path, chart, id, title, sev, msg, resolution string) {
+    w.out = append(w.out, types.Finding{
+        RuleID:     id,
+        Title:      title,
+        Severity:   sev,
+        Message:    msg,
+        Resolution: resolution,
+        Resource:   "Chart/" + chart,
+        Kind:       "Chart",
+        Name:       chart,
+        File:       file,
+        Line:       line,
+        Path:       path,
+    })
+}
+
+// rel returns dir relative to the root chart, with a trailing slash.
+func (w *depWalker) rel(dir string) string {
+    rel, err := filepath.Rel(w.root, dir)
+    if err != nil || rel == "." {
+        return ""
+    }
+    return filepath.ToSlash(rel) + "/"
+}
+
+// vendored lists the subcharts under dir/charts keyed by chart name.
+func (w *depWalker) vendored(dir string) map[string]vendoredChart {
+    out := map[string]vendoredChart{}
+    entries, err := os.ReadDir(filepath.Join(dir, "charts"))
+    if err != nil {
+        return out
+    }
+    for _, e := range entries {
+        path := filepath.Join(dir, "charts", e.Name())
+        var v vendoredChart
+        switch {
+        case e.IsDir():
+            data, err := os.ReadFile(filepath.Join(path, "Chart.yaml"))
+            if err != nil || yaml.Unmarshal(data, &v.meta) != nil {
+                continue
+            }
+            v.dir = path
+        case strings.HasSuffix(e.Name(), ".tgz"):
+            meta, err := archiveChart(path)
+            if err != nil {
+                continue
+            }
+            v.meta = *meta
+        default:
+            continue
+        }
+        out[v.meta.Name] = v
+    }
+    return out
+}
+
+// archiveChart reads the Chart.yaml of a packaged chart.
+func archiveChart(path string) (*chartFile, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    gz, err := gzip.NewReader(f)
+    if err != nil {
+        return nil, err
+    }
+    tr := tar.NewReader(gz)
+    for {
+        h, err := tr.Next()
+        if errors.Is(err, io.EOF) {
+            return nil, fmt.Errorf("%s: no Chart.yaml", path)
+        }
+        if err != nil {
+            return nil, err
+        }
+        // <chart>/Chart.yaml, not the ones of nested subcharts
+        if parts := strings.Split(h.Name, "/"); len(parts) == 2 && parts[1] == "Chart.yaml" {
+            var cf chartFile
+            if err := yaml.NewDecoder(tr).Decode(&cf); err != nil {
+                return nil, fmt.Errorf("%s: %w", path, err)
+            }
+            return &cf, nil
+        }
+    }
+}
+
+func readLock(dir string) (*lockFile, string) {
+    for _, name := range []string{"Chart.lock", "requirements.lock"} {
+        data, err := os.ReadFile(filepath.Join(dir, name))
+        if err != nil {
+            continue
+        }
+        var lock lockFile
+        if yaml.Unmarshal(data, &lock) == nil {
+            return &lock, name
+        }
+    }
+    return nil, ""
+}
+
+// loadRepositories reads the repository names known to helm.
+func (w *depWalker) loadRepositories() {
+    w.repos = map[string]string{}
+    if w.opts.RepositoryConfig == "" {
+        return
+    }
+    data, err := os.ReadFile(w.opts.RepositoryConfig)
+    if err != nil {
+        return
+    }
+    var cfg struct {
+        Repositories []struct {
+            Name string `yaml:"name"`
+            URL  string `yaml:"url"`
+        } `yaml:"repositories"`
+    }
+    if yaml.Unmarshal(data, &cfg) != nil {
+        return
+    }
+    for _, r := range cfg.Repositories {
+        w.repos[strings.TrimSuffix(r.URL, "/")] = r.Name
+    }
+}
+
+// latest returns the newest release of chart in the cached index of
+// repository, which may be a URL, "@name" or "alias:name", and whether
+// that index is available.
+func (w *depWalker) latest(repository, chart string) (string, bool) {
+    if w.opts.RepositoryCache == "" || repository == "" {
+        return "", false
+    }
+    name, ok := w.repos[strings.TrimSuffix(repository, "/")]
+    if !ok {
+        switch {
+        case strings.HasPrefix(repository, "@"):
+            name = repository[1:]
+        case strings.HasPrefix(repository, "alias:"):
+            name = strings.TrimPrefix(repository, "alias:")
+        default:
+            return "", false
+        }
+    }
+
+    index, ok := w.indexes[name]
+    if !ok {
+        var file struct {
+            Entries map[string][]indexEntry `yaml:"entries"`
+        }
+        if data, err := os.ReadFile(filepath.Join(w.opts.RepositoryCache, name+"-index.yaml")); err == nil {
+            _ = yaml.Unmarshal(data, &file)
+        }
+        index = file.Entries
+        w.indexes[name] = index
+    }
+    if index == nil {
+        return "", false
+    }
+
+    var best *semver.Version
+    found := ""
+    for _, e := range index[chart] {
+        v, err := semver.NewVersion(e.Version)
+        if err != nil || v.Prerelease() != "" {
+            continue
+        }
+        if found == "" || v.Compare(best) > 0 {
+            best, found = v, e.Version
+        }
+    }
+    return found, true
+}
+
+func checkVersion(c *semver.Constraints, version string) bool {
+    v, err := semver.NewVersion(version)
+    return err == nil && c.Check(v)
+}
+
+// pinned tells whether a dependency version admits a single release: a
+// full version, "=" at most in front of it. "1.2" is 1.2.x for Helm.
+func pinned(constraint string) bool {
+    s := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(constraint), "="))
+    _, err := semver.StrictNewVersion(strings.TrimPrefix(s, "v"))
+    return err == nil
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// AttributeCharts records on the tree which resources, images and
+// findings each chart produced, and sets Finding.Chart. Files are
+// attributed through their charts/<name> path segments, as laid out by
+// helm template --output-dir and in the chart sources.
+func AttributeCharts(tree *types.ChartNode, manifests []*Manifest, findings []types.Finding) {
+    if tree == nil {
+        return
+    }
+    for _, m := range manifests {
+        n := chartNode(tree, m.File)
+        n.Resources = append(n.Resources, m.ID())
+    }
+    for _, wl := range Workloads(manifests) {
+        n := chartNode(tree, wl.File)
+        for _, c := range wl.Containers {
+            if c.Image != "" && !contains(n.Images, c.Image) {
+                n.Images = append(n.Images, c.Image)
+            }
+        }
+    }
+    for i := range findings {
+        n := chartNode(tree, findings[i].File)
+        findings[i].Chart = n.ID
+        n.Findings++
+    }
+}
+
+// chartNode returns the deepest chart of the tree file belongs to.
+func chartNode(tree *types.ChartNode, file string) *types.ChartNode {
+    n := tree
+    parts := strings.Split(file, "/")
+    for i := 0; i+2 < len(parts) && parts[i] != "templates"; i++ {
+        if parts[i] != "charts" {
+            continue
+        }
+        var next *types.ChartNode
+        for _, d := range n.Dependencies {
+            if firstNonEmpty(d.Alias, d.Name) == parts[i+1] || d.Name == parts[i+1] {
+                next = d
+                break
+            }
+        }
+        if next == nil {
+            break
+        }
+        n = next
+        i++
+    }
+    return n
+}
@@ -0,0 +1,140 @@
+package audit
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// DefaultKubeVersion is the cluster version checked when none is given.
+const DefaultKubeVersion = "1.32"
+
+// apiDeprecation records when a GroupVersionKind was deprecated and
+// removed, as minor versions of Kubernetes 1.x. Replacement is empty
+// when the API has no successor.
+type apiDeprecation struct {
+    APIVersion  string
+    Kinds       []string
+    Deprecated  int
+    Removed     int
+    Replacement string
+}
+
+// apiDeprecations follows the Kubernetes deprecated API migration guide.
+var apiDeprecations = []apiDeprecation{
+    // 1.16
+    {"extensions/v1beta1", []string{"Deployment", "DaemonSet", "ReplicaSet"}, 8, 16, "apps/v1"},
+    {"apps/v1beta1", []string{"Deployment", "StatefulSet", "ReplicaSet"}, 9, 16, "apps/v1"},
+    {"apps/v1beta2", []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}, 9, 16, "apps/v1"},
+    {"extensions/v1beta1", []string{"NetworkPolicy"}, 9, 16, "networking.k8s.io/v1"},
+    {"extensions/v1beta1", []string{"PodSecurityPolicy"}, 10, 16, "policy/v1beta1"},
+
+    // 1.22
+    {"extensions/v1beta1", []string{"Ingress"}, 14, 22, "networking.k8s.io/v1"},
+    {"networking.k8s.io/v1beta1", []string{"Ingress", "IngressClass"}, 19, 22, "networking.k8s.io/v1"},
+    {"apiextensions.k8s.io/v1beta1", []string{"CustomResourceDefinition"}, 16, 22, "apiextensions.k8s.io/v1"},
+    {"admissionregistration.k8s.io/v1beta1", []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}, 16, 22, "admissionregistration.k8s.io/v1"},
+    {"apiregistration.k8s.io/v1beta1", []string{"APIService"}, 19, 22, "apiregistration.k8s.io/v1"},
+    {"authentication.k8s.io/v1beta1", []string{"TokenReview"}, 19, 22, "authentication.k8s.io/v1"},
+    {"authorization.k8s.io/v1beta1", []string{"SubjectAccessReview", "LocalSubjectAccessReview", "SelfSubjectAccessReview"}, 19, 22, "authorization.k8s.io/v1"},
+    {"certificates.k8s.io/v1beta1", []string{"CertificateSigningRequest"}, 19, 22, "certificates.k8s.io/v1"},
+    {"coordination.k8s.io/v1beta1", []string{"Lease"}, 19, 22, "coordination.k8s.io/v1"},
+    {"rbac.authorization.k8s.io/v1beta1", []string{"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"}, 17, 22, "rbac.authorization.k8s.io/v1"},
+    {"scheduling.k8s.io/v1beta1", []string{"PriorityClass"}, 14, 22, "scheduling.k8s.io/v1"},
+    {"storage.k8s.io/v1beta1", []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, 19, 22, "storage.k8s.io/v1"},
+
+    // 1.25
+    {"batch/v1beta1", []string{"CronJob"}, 21, 25, "batch/v1"},
+    {"discovery.k8s.io/v1beta1", []string{"EndpointSlice"}, 21, 25, "discovery.k8s.io/v1"},
+    {"events.k8s.io/v1beta1", []string{"Event"}, 21, 25, "events.k8s.io/v1"},
+    {"autoscaling/v2beta1", []string{"HorizontalPodAutoscaler"}, 22, 25, "autoscaling/v2"},
+    {"policy/v1beta1", []string{"PodDisruptionBudget"}, 21, 25, "policy/v1"},
+    {"policy/v1beta1", []string{"PodSecurityPolicy"}, 21, 25, ""},
+    {"node.k8s.io/v1beta1", []string{"RuntimeClass"}, 20, 25, "node.k8s.io/v1"},
+
+    // 1.26
+    {"autoscaling/v2beta2", []string{"HorizontalPodAutoscaler"}, 23, 26, "autoscaling/v2"},
+    {"flowcontrol.apiserver.k8s.io/v1beta1", []string{"FlowSchema", "PriorityLevelConfiguration"}, 23, 26, "flowcontrol.apiserver.k8s.io/v1"},
+
+    // 1.27
+    {"storage.k8s.io/v1beta1", []string{"CSIStorageCapacity"}, 24, 27, "storage.k8s.io/v1"},
+
+    // 1.29
+    {"flowcontrol.apiserver.k8s.io/v1beta2", []string{"FlowSchema", "PriorityLevelConfiguration"}, 26, 29, "flowcontrol.apiserver.k8s.io/v1"},
+
+    // 1.32
+    {"flowcontrol.apiserver.k8s.io/v1beta3", []string{"FlowSchema", "PriorityLevelConfiguration"}, 29, 32, "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// lookupDeprecation returns the deprecation of apiVersion and kind, if any.
+func lookupDeprecation(apiVersion, kind string) (apiDeprecation, bool) {
+    for _, d := range apiDeprecations {
+        if d.APIVersion == apiVersion && contains(d.Kinds, kind) {
+            return d, true
+        }
+    }
+    return apiDeprecation{}, false
+}
+
+// ParseKubeVersion returns the minor version of a Kubernetes 1.x release
+// given as "1.29", "v1.29.3" or "1.29.0-eks-1".
+func ParseKubeVersion(v string) (int, error) {
+    parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(v), "v"), ".", 3)
+    if len(parts) < 2 || parts[0] != "1" {
+        return 0, fmt.Errorf("invalid Kubernetes version %q", v)
+    }
+    minor, err := strconv.Atoi(strings.TrimRight(parts[1], "+"))
+    if err != nil {
+        return 0, fmt.Errorf("invalid Kubernetes version %q", v)
+    }
+    return minor, nil
+}
+
+// CheckAPIVersions reports the rendered resources using an API removed
+// in the target cluster version (HA601) or deprecated in it (HA602).
+func CheckAPIVersions(manifests []*Manifest, target string) ([]types.Finding, error) {
+    minor, err := ParseKubeVersion(target)
+    if err != nil {
+        return nil, err
+    }
+
+    findings := []types.Finding{}
+    for _, m := range manifests {
+        d, ok := lookupDeprecation(m.APIVersion(), m.Kind())
+        if !ok || minor < d.Deprecated {
+            continue
+        }
+        f := types.Finding{
+            RuleID:     "HA602",
+            Title:      "Deprecated API version",
+            Severity:   "LOW",
+            Message:    fmt.Sprintf("%s %s is deprecated since 1.%d and removed in 1.%d", m.APIVersion(), m.Kind(), d.Deprecated, d.Removed),
+            Resolution: migration(d),
+            Resource:   m.ID(),
+            Kind:       m.Kind(),
+            Name:       m.Name(),
+            Namespace:  m.Namespace(),
+            File:       m.File,
+            Line:       m.LineOf("apiVersion"),
+            Path:       "apiVersion",
+            Snippet:    m.APIVersion(),
+        }
+        if minor >= d.Removed {
+            f.RuleID = "HA601"
+            f.Title = "Removed API version"
+            f.Severity = "HIGH"
+            f.Message = fmt.Sprintf("%s %s was removed in 1.%d, the resource cannot be applied to a %s cluster", m.APIVersion(), m.Kind(), d.Removed, target)
+        }
+        findings = append(findings, f)
+    }
+    return findings, nil
+}
+
+func migration(d apiDeprecation) string {
+    if d.Replacement == "" {
+        return "The API has no replacement, drop the resource from the chart."
+    }
+    return fmt.Sprintf("Migrate to %s, checking the fields changed between versions.", d.Replacement)
+}
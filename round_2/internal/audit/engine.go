@@ -0,0 +1,114 @@
+package audit
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// Rule is a check run against every workload of the chart.
+type Rule struct {
+    ID         string
+    Title      string
+    Severity   string
+    Resolution string
+    Check      func(w *Workload, ctx *Context) []Violation
+}
+
+// Violation is one place a workload fails a rule.
+type Violation struct {
+    Container string   // empty for pod level violations
+    Path      []string // offending field, as accepted by Manifest.LineOf
+    Message   string
+    Severity  string // overrides the rule severity when set
+}
+
+// Context gives rules access to the resources around a workload.
+type Context struct {
+    Manifests []*Manifest
+
+    byID map[string]*Manifest
+}
+
+// NewContext indexes manifests for lookups by kind, namespace and name.
+func NewContext(manifests []*Manifest) *Context {
+    ctx := &Context{Manifests: manifests, byID: map[string]*Manifest{}}
+    for _, m := range manifests {
+        ctx.byID[m.ID()] = m
+    }
+    return ctx
+}
+
+// Lookup finds a resource rendered by the chart. Namespaced resources
+// without a namespace in the chart match any namespace.
+func (c *Context) Lookup(kind, namespace, name string) *Manifest {
+    if m, ok := c.byID[kind+"/"+namespace+"/"+name]; ok {
+        return m
+    }
+    return c.byID[kind+"/"+name]
+}
+
+// Check runs rules over the workloads in manifests. Findings are ordered
+// by file and line.
+func Check(manifests []*Manifest, rules []Rule) []types.Finding {
+    ctx := NewContext(manifests)
+    findings := []types.Finding{}
+
+    for _, w := range Workloads(manifests) {
+        for _, r := range rules {
+            for _, v := range r.Check(w, ctx) {
+                sev := r.Severity
+                if v.Severity != "" {
+                    sev = v.Severity
+                }
+                findings = append(findings, types.Finding{
+                    RuleID:     r.ID,
+                    Title:      r.Title,
+                    Severity:   sev,
+                    Message:    v.Message,
+                    Resolution: r.Resolution,
+                    Resource:   w.ID(),
+                    Kind:       w.Kind(),
+                    Name:       w.Name(),
+                    Namespace:  w.Namespace(),
+                    Container:  v.Container,
+                    File:       w.File,
+                    Line:       w.LineOf(v.Path...),
+                    Path:       FieldPath(v.Path),
+                })
+            }
+        }
+    }
+
+    sort.SliceStable(findings, func(i, j int) bool {
+        if findings[i].File != findings[j].File {
+            return findings[i].File < findings[j].File
+        }
+        return findings[i].Line < findings[j].Line
+    })
+    return findings
+}
+
+// FieldPath formats a manifest path the way kubectl explain does:
+// spec.containers[0].image.
+func FieldPath(path []string) string {
+    var b strings.Builder
+    for _, p := range path {
+        if _, err := strconv.Atoi(p); err == nil {
+            b.WriteString("[" + p + "]")
+            continue
+        }
+        if b.Len() > 0 {
+            b.WriteByte('.')
+        }
+        b.WriteString(p)
+    }
+    return b.String()
+}
+
+// sub appends elems to a copy of path.
+func sub(path []string, elems ...string) []string {
+    return append(append([]string{}, path...), elems...)
+}
@@ -0,0 +1,398 @@
+package audit
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// Relations between resources.
+const (
+    RelServiceAccount = "runs-as"         // workload -> ServiceAccount
+    RelConfigMap      = "reads-configmap" // workload -> ConfigMap
+    RelSecret         = "reads-secret"    // workload -> Secret
+    RelPullSecret     = "pulls-with"      // workload -> Secret
+    RelVolumeClaim    = "mounts"          // workload -> PersistentVolumeClaim
+    RelSelects        = "selects"         // Service -> workload
+    RelPolicy         = "applies-to"      // NetworkPolicy -> workload
+    RelBinds          = "binds"           // RoleBinding -> ServiceAccount
+    RelGrants         = "grants"          // RoleBinding -> Role
+    RelRoutes         = "routes-to"       // Ingress -> Service
+)
+
+// Node is a resource of the graph. External nodes are referenced by the
+// chart but not rendered by it.
+type Node struct {
+    ID        string `json:"id"`
+    Kind      string `json:"kind"`
+    Name      string `json:"name"`
+    Namespace string `json:"namespace,omitempty"`
+    File      string `json:"file,omitempty"`
+    External  bool   `json:"external,omitempty"`
+}
+
+type Edge struct {
+    From     string `json:"from"`
+    To       string `json:"to"`
+    Relation string `json:"relation"`
+}
+
+// Graph links the resources rendered by a chart.
+type Graph struct {
+    Nodes []*Node `json:"nodes"`
+    Edges []Edge  `json:"edges"`
+
+    index map[string]*Node
+    edges map[Edge]bool
+}
+
+// BuildGraph links workloads to the ServiceAccounts, ConfigMaps, Secrets
+// and claims they use, and Services, NetworkPolicies, bindings and
+// Ingresses to what they point at.
+func BuildGraph(manifests []*Manifest) *Graph {
+    g := &Graph{Nodes: []*Node{}, Edges: []Edge{}, index: map[string]*Node{}, edges: map[Edge]bool{}}
+    ctx := NewContext(manifests)
+    for _, m := range manifests {
+        g.add(&Node{ID: m.ID(), Kind: m.Kind(), Name: m.Name(), Namespace: m.Namespace(), File: m.File})
+    }
+
+    workloads := Workloads(manifests)
+    for _, w := range workloads {
+        g.linkWorkload(ctx, w)
+    }
+
+    for _, m := range manifests {
+        switch m.Kind() {
+        case "Service":
+            sel := stringMap(get(m.Object, "spec", "selector"))
+            for _, w := range workloads {
+                if sameNamespace(m.Namespace(), w.Namespace()) && matchMapSelector(sel, w.PodLabels()) {
+                    g.link(m.ID(), w.ID(), RelSelects)
+                }
+            }
+        case "NetworkPolicy":
+            sel, _ := get(m.Object, "spec", "podSelector").(map[string]any)
+            for _, w := range workloads {
+                if sameNamespace(m.Namespace(), w.Namespace()) && matchLabelSelector(sel, w.PodLabels()) {
+                    g.link(m.ID(), w.ID(), RelPolicy)
+                }
+            }
+        case "RoleBinding", "ClusterRoleBinding":
+            if !isRBAC(m) {
+                continue
+            }
+            b := parseBinding(m)
+            for _, s := range b.subjects {
+                if s.Kind == "ServiceAccount" {
+                    g.link(m.ID(), g.ref(ctx, "ServiceAccount", s.Namespace, s.Name), RelBinds)
+                }
+            }
+            refKind, refName := str(m.Object, "roleRef", "kind"), str(m.Object, "roleRef", "name")
+            ns := m.Namespace()
+            if refKind == "ClusterRole" {
+                ns = ""
+            }
+            if refName != "" {
+                g.link(m.ID(), g.ref(ctx, refKind, ns, refName), RelGrants)
+            }
+        case "Ingress":
+            for _, svc := range ingressServices(m) {
+                g.link(m.ID(), g.ref(ctx, "Service", m.Namespace(), svc), RelRoutes)
+            }
+        }
+    }
+    return g
+}
+
+// linkWorkload adds the edges from a workload to what its pods use.
+func (g *Graph) linkWorkload(ctx *Context, w *Workload) {
+    ns := w.Namespace()
+    pod := w.PodSpec()
+    g.link(w.ID(), g.ref(ctx, "ServiceAccount", ns, ServiceAccountName(w)), RelServiceAccount)
+
+    for _, s := range listOf(pod["imagePullSecrets"]) {
+        g.link(w.ID(), g.ref(ctx, "Secret", ns, str(s, "name")), RelPullSecret)
+    }
+
+    for _, v := range listOf(pod["volumes"]) {
+        g.linkVolume(ctx, w, v)
+        for _, src := range listOf(get(v, "projected", "sources")) {
+            g.linkVolume(ctx, w, src)
+        }
+    }
+    for _, t := range listOf(get(w.Object, "spec", "volumeClaimTemplates")) {
+        g.link(w.ID(), g.ref(ctx, "PersistentVolumeClaim", ns, str(t, "metadata", "name")), RelVolumeClaim)
+    }
+
+    for _, c := range w.Containers {
+        for _, ef := range listOf(c.Spec["envFrom"]) {
+            if name := str(ef, "configMapRef", "name"); name != "" {
+                g.link(w.ID(), g.ref(ctx, "ConfigMap", ns, name), RelConfigMap)
+            }
+            if name := str(ef, "secretRef", "name"); name != "" {
+                g.link(w.ID(), g.ref(ctx, "Secret", ns, name), RelSecret)
+            }
+        }
+        for _, e := range listOf(c.Spec["env"]) {
+            if name := str(e, "valueFrom", "configMapKeyRef", "name"); name != "" {
+                g.link(w.ID(), g.ref(ctx, "ConfigMap", ns, name), RelConfigMap)
+            }
+            if name := str(e, "valueFrom", "secretKeyRef", "name"); name != "" {
+                g.link(w.ID(), g.ref(ctx, "Secret", ns, name), RelSecret)
+            }
+        }
+    }
+}
+
+// linkVolume handles a pod volume or a projected volume source.
+func (g *Graph) linkVolume(ctx *Context, w *Workload, v map[string]any) {
+    ns := w.Namespace()
+    if name := str(v, "configMap", "name"); name != "" {
+        g.link(w.ID(), g.ref(ctx, "ConfigMap", ns, name), RelConfigMap)
+    }
+    if name := str(v, "secret", "secretName"); name != "" {
+        g.link(w.ID(), g.ref(ctx, "Secret", ns, name), RelSecret)
+    }
+    if name := str(v, "secret", "name"); name != "" { // projected source
+        g.link(w.ID(), g.ref(ctx, "Secret", ns, name), RelSecret)
+    }
+    if name := str(v, "persistentVolumeClaim", "claimName"); name != "" {
+        g.link(w.ID(), g.ref(ctx, "PersistentVolumeClaim", ns, name), RelVolumeClaim)
+    }
+}
+
+// Node returns the node with id, nil if unknown.
+func (g *Graph) Node(id string) *Node {
+    return g.index[id]
+}
+
+// Out returns the nodes id points at through relation, any relation when
+// relation is empty.
+func (g *Graph) Out(id, relation string) []*Node {
+    var out []*Node
+    for _, e := range g.Edges {
+        if e.From == id && (relation == "" || e.Relation == relation) {
+            out = append(out, g.index[e.To])
+        }
+    }
+    return out
+}
+
+// In returns the nodes pointing at id through relation, any relation when
+// relation is empty.
+func (g *Graph) In(id, relation string) []*Node {
+    var out []*Node
+    for _, e := range g.Edges {
+        if e.To == id && (relation == "" || e.Relation == relation) {
+            out = append(out, g.index[e.From])
+        }
+    }
+    return out
+}
+
+// JSON encodes the graph as {"nodes": [...], "edges": [...]}.
+func (g *Graph) JSON() ([]byte, error) {
+    return json.MarshalIndent(g, "", "  ")
+}
+
+// DOT renders the graph for Graphviz. External resources are dashed.
+func (g *Graph) DOT() []byte {
+    var b bytes.Buffer
+    b.WriteString("digraph chart {\n  rankdir=LR;\n  node [shape=box, style=\"rounded,filled\", fillcolor=white, fontname=Helvetica];\n")
+    for _, n := range g.Nodes {
+        style := ""
+        if n.External {
+            style = `, style="rounded,dashed"`
+        } else if color, ok := kindColors[n.Kind]; ok {
+            style = fmt.Sprintf(", fillcolor=%q", color)
+        }
+        fmt.Fprintf(&b, "  %s [label=%s%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Kind+"\n"+n.Name), style)
+    }
+    for _, e := range g.Edges {
+        fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Relation))
+    }
+    b.WriteString("}\n")
+    return b.Bytes()
+}
+
+// Write stores the graph as <base>.json and <base>.dot.
+func (g *Graph) Write(base string) error {
+    data, err := g.JSON()
+    if err != nil {
+        return err
+    }
+    if err := os.WriteFile(base+".json", data, 0o644); err != nil {
+        return err
+    }
+    return os.WriteFile(base+".dot", g.DOT(), 0o644)
+}
+
+var kindColors = map[string]string{
+    "Deployment":         "#ddf4ff",
+    "StatefulSet":        "#ddf4ff",
+    "DaemonSet":          "#ddf4ff",
+    "Job":                "#ddf4ff",
+    "CronJob":            "#ddf4ff",
+    "Pod":                "#ddf4ff",
+    "ServiceAccount":     "#fff8c5",
+    "Role":               "#ffebe9",
+    "ClusterRole":        "#ffebe9",
+    "RoleBinding":        "#ffebe9",
+    "ClusterRoleBinding": "#ffebe9",
+    "Secret":             "#fbefff",
+    "Service":            "#dafbe1",
+    "Ingress":            "#dafbe1",
+    "NetworkPolicy":      "#dafbe1",
+}
+
+func (g *Graph) add(n *Node) *Node {
+    if existing, ok := g.index[n.ID]; ok {
+        return existing
+    }
+    g.index[n.ID] = n
+    g.Nodes = append(g.Nodes, n)
+    return n
+}
+
+func (g *Graph) link(from, to, relation string) {
+    e := Edge{From: from, To: to, Relation: relation}
+    if from == "" || to == "" || g.edges[e] {
+        return
+    }
+    g.edges[e] = true
+    g.Edges = append(g.Edges, e)
+}
+
+// ref returns the id of a referenced resource, adding an external node
+// when the chart does not render it.
+func (g *Graph) ref(ctx *Context, kind, ns, name string) string {
+    if name == "" {
+        return ""
+    }
+    if m := ctx.Lookup(kind, ns, name); m != nil {
+        return m.ID()
+    }
+    for _, n := range g.Nodes {
+        if n.External && n.Kind == kind && n.Name == name && sameNamespace(n.Namespace, ns) {
+            return n.ID
+        }
+    }
+    id := kind + "/" + qualify(ns, name)
+    g.add(&Node{ID: id, Kind: kind, Name: name, Namespace: ns, External: true})
+    return id
+}
+
+// ingressServices lists the backend Services of an Ingress.
+func ingressServices(m *Manifest) []string {
+    var out []string
+    add := func(backend map[string]any) {
+        name := str(backend, "service", "name")
+        if name == "" {
+            name = str(backend, "serviceName") // extensions/v1beta1
+        }
+        if name != "" && !contains(out, name) {
+            out = append(out, name)
+        }
+    }
+
+    if def, ok := get(m.Object, "spec", "defaultBackend").(map[string]any); ok {
+        add(def)
+    }
+    if def, ok := get(m.Object, "spec", "backend").(map[string]any); ok {
+        add(def)
+    }
+    for _, rule := range listOf(get(m.Object, "spec", "rules")) {
+        for _, p := range listOf(get(rule, "http", "paths")) {
+            if backend, ok := p["backend"].(map[string]any); ok {
+                add(backend)
+            }
+        }
+    }
+    return out
+}
+
+// CorrelateRBAC joins workload findings with RBAC: a workload that can
+// break out of its container (privileged, host namespaces, sensitive
+// host paths) and whose ServiceAccount holds dangerous grants is an
+// escalation path to the whole cluster.
+func CorrelateRBAC(g *Graph, findings []types.Finding, perms []types.WorkloadPermissions) []types.Finding {
+    breakout := map[string]string{} // workload -> first breakout finding
+    for _, f := range findings {
+        switch f.RuleID {
+        case "HA001", "HA002", "HA003", "HA004", "HA005":
+            if f.Severity == "HIGH" || f.Severity == "CRITICAL" {
+                if _, ok := breakout[f.Resource]; !ok {
+                    breakout[f.Resource] = f.Title
+                }
+            }
+        }
+    }
+
+    var out []types.Finding
+    for _, wp := range perms {
+        why, ok := breakout[wp.Workload]
+        if !ok {
+            continue
+        }
+        var grants []string
+        for _, p := range wp.Permissions {
+            for _, flag := range p.Flags {
+                grants = append(grants, fmt.Sprintf("%s (%s via %s)", grantTitle(flag), p.Role, p.Binding))
+            }
+        }
+        if len(grants) == 0 {
+            continue
+        }
+        sort.Strings(grants)
+
+        n := g.Node(wp.Workload)
+        if n == nil {
+            continue
+        }
+        var sa string
+        for _, s := range g.Out(n.ID, RelServiceAccount) {
+            sa = s.ID
+        }
+        out = append(out, types.Finding{
+            RuleID:   "HA201",
+            Title:    "Container breakout with dangerous RBAC",
+            Severity: "CRITICAL",
+            Message: fmt.Sprintf("%s (%s) runs as %s, which has: %s",
+                n.ID, strings.ToLower(why), sa, strings.Join(grants, "; ")),
+            Resolution: "Drop the host access of the workload or give it a ServiceAccount without cluster wide grants.",
+            Resource:   n.ID,
+            Kind:       n.Kind,
+            Name:       n.Name,
+            Namespace:  n.Namespace,
+            File:       n.File,
+        })
+    }
+    return out
+}
+
+func grantTitle(id string) string {
+    for _, c := range grantChecks {
+        if c.ID == id {
+            return strings.ToLower(c.Title)
+        }
+    }
+    return id
+}
+
+// listOf returns the maps of a YAML list.
+func listOf(v any) []map[string]any {
+    list, _ := v.([]any)
+    var out []map[string]any
+    for _, item := range list {
+        if m, ok := item.(map[string]any); ok {
+            out = append(out, m)
+        }
+    }
+    return out
+}
@@ -0,0 +1,173 @@
+package audit
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Manifest is one rendered Kubernetes document and where it came from.
+type Manifest struct {
+    File   string // relative to the templates root
+    Line   int    // line of the document start
+    Object map[string]any
+
+    node *yaml.Node
+}
+
+func (m *Manifest) Kind() string {
+    k, _ := m.Object["kind"].(string)
+    return k
+}
+
+func (m *Manifest) APIVersion() string {
+    v, _ := m.Object["apiVersion"].(string)
+    return v
+}
+
+func (m *Manifest) Name() string {
+    return str(m.Object, "metadata", "name")
+}
+
+func (m *Manifest) Namespace() string {
+    return str(m.Object, "metadata", "namespace")
+}
+
+// ID is Kind/name, or Kind/namespace/name for namespaced resources.
+func (m *Manifest) ID() string {
+    if ns := m.Namespace(); ns != "" {
+        return m.Kind() + "/" + ns + "/" + m.Name()
+    }
+    return m.Kind() + "/" + m.Name()
+}
+
+// LineOf returns the line of the value at path, e.g. "spec", "replicas".
+// Sequence items are addressed by their index as a decimal string. Falls
+// back to the closest ancestor found.
+func (m *Manifest) LineOf(path ...string) int {
+    n := m.node
+    line := m.Line
+    for _, p := range path {
+        next := child(n, p)
+        if next == nil {
+            break
+        }
+        n = next
+        line = n.Line
+    }
+    return line
+}
+
+func child(n *yaml.Node, key string) *yaml.Node {
+    if n == nil {
+        return nil
+    }
+    switch n.Kind {
+    case yaml.MappingNode:
+        for i := 0; i+1 < len(n.Content); i += 2 {
+            if n.Content[i].Value == key {
+                return n.Content[i+1]
+            }
+        }
+    case yaml.SequenceNode:
+        var idx int
+        if _, err := fmt.Sscanf(key, "%d", &idx); err == nil && idx >= 0 && idx < len(n.Content) {
+            return n.Content[idx]
+        }
+    }
+    return nil
+}
+
+// LoadManifests parses every YAML file under root, as written by
+// `helm template --output-dir`. Files that fail to parse are reported as
+// warnings, documents before the error are kept.
+func LoadManifests(root string) ([]*Manifest, []string, error) {
+    var out []*Manifest
+    var warnings []string
+
+    err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            return nil
+        }
+        if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+            return nil
+        }
+
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(root, path)
+        if err != nil {
+            rel = path
+        }
+
+        docs, err := ParseManifests(data, filepath.ToSlash(rel))
+        if err != nil {
+            warnings = append(warnings, err.Error())
+        }
+        out = append(out, docs...)
+        return nil
+    })
+    if err != nil {
+        return nil, warnings, fmt.Errorf("loading manifests from %s: %w", root, err)
+    }
+    return out, warnings, nil
+}
+
+// ParseManifests splits a multi document YAML stream. Empty documents are
+// skipped.
+func ParseManifests(data []byte, file string) ([]*Manifest, error) {
+    var out []*Manifest
+
+    dec := yaml.NewDecoder(bytes.NewReader(data))
+    for {
+        var doc yaml.Node
+        err := dec.Decode(&doc)
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return out, fmt.Errorf("%s: %w", file, err)
+        }
+        if len(doc.Content) == 0 {
+            continue
+        }
+
+        root := doc.Content[0]
+        var obj map[string]any
+        if err := root.Decode(&obj); err != nil || obj == nil {
+            continue
+        }
+        out = append(out, &Manifest{File: file, Line: root.Line, Object: obj, node: root})
+    }
+    return out, nil
+}
+
+// str walks nested maps and returns the string at path.
+func str(obj map[string]any, path ...string) string {
+    v, _ := get(obj, path...).(string)
+    return v
+}
+
+// get walks nested maps and returns the value at path, nil if missing.
+func get(obj map[string]any, path ...string) any {
+    var cur any = obj
+    for _, p := range path {
+        m, ok := cur.(map[string]any)
+        if !ok {
+            return nil
+        }
+        cur = m[p]
+    }
+    return cur
+}
@@ -0,0 +1,259 @@
+package audit
+
+import (
+    "fmt"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// Exposure of a workload in one direction.
+const (
+    DefaultAllow = "default-allow" // no NetworkPolicy selects it
+    AllowAll     = "allow-all"     // a policy selects it but allows any peer
+    Restricted   = "restricted"    // only the peers and ports listed
+    Isolated     = "isolated"      // selected, no traffic allowed
+)
+
+// Network is the outcome of AnalyzeNetwork.
+type Network struct {
+    Report   *types.NetworkReport
+    Findings []types.Finding
+}
+
+// AnalyzeNetwork evaluates the NetworkPolicies of the chart against its
+// workloads and lists what the chart exposes outside the cluster.
+func AnalyzeNetwork(manifests []*Manifest, g *Graph) *Network {
+    ctx := NewContext(manifests)
+    out := &Network{
+        Report:   &types.NetworkReport{Workloads: []types.WorkloadNetwork{}},
+        Findings: []types.Finding{},
+    }
+
+    exposed := map[string][]string{} // workload -> how it is reached from outside
+    for _, m := range manifests {
+        switch m.Kind() {
+        case "Service":
+            svc, ok := exposedService(m, g)
+            if !ok {
+                continue
+            }
+            out.Report.Services = append(out.Report.Services, svc)
+            for _, w := range svc.Workloads {
+                exposed[w] = append(exposed[w], fmt.Sprintf("%s (%s)", m.ID(), svc.Type))
+            }
+            out.Findings = append(out.Findings, serviceFinding(m, svc))
+        case "Ingress":
+            hosts := ingressHosts(m)
+            out.Report.Ingresses = append(out.Report.Ingresses, hosts...)
+            for _, h := range hosts {
+                for _, svc := range h.Services {
+                    sm := ctx.Lookup("Service", m.Namespace(), svc)
+                    if sm == nil {
+                        continue
+                    }
+                    for _, w := range g.Out(sm.ID(), RelSelects) {
+                        exposed[w.ID] = append(exposed[w.ID], fmt.Sprintf("%s host %s", m.ID(), h.Host))
+                    }
+                }
+                if !h.TLS {
+                    out.Findings = append(out.Findings, types.Finding{
+                        RuleID:     "HA303",
+                        Title:      "Ingress host without TLS",
+                        Severity:   "MEDIUM",
+                        Message:    fmt.Sprintf("%s serves %s over plain HTTP", m.ID(), h.Host),
+                        Resolution: "Add the host to spec.tls with a certificate secret.",
+                        Resource:   m.ID(),
+                        Kind:       m.Kind(),
+                        Name:       m.Name(),
+                        Namespace:  m.Namespace(),
+                        File:       m.File,
+                        Line:       m.LineOf("spec", "rules"),
+                        Path:       "spec.rules",
+                    })
+                }
+            }
+        }
+    }
+
+    for _, w := range Workloads(manifests) {
+        var policies []*Manifest
+        for _, n := range g.In(w.ID(), RelPolicy) {
+            if m := ctx.Lookup(n.Kind, n.Namespace, n.Name); m != nil {
+                policies = append(policies, m)
+            }
+        }
+
+        wn := types.WorkloadNetwork{
+            Workload: w.ID(),
+            Ingress:  exposure(policies, "Ingress", "ingress", "from"),
+            Egress:   exposure(policies, "Egress", "egress", "to"),
+            Exposed:  exposed[w.ID()],
+        }
+        for _, p := range policies {
+            wn.Policies = append(wn.Policies, p.ID())
+        }
+        out.Report.Workloads = append(out.Report.Workloads, wn)
+
+        if wn.Ingress == DefaultAllow || wn.Ingress == AllowAll {
+            f := types.Finding{
+                RuleID:     "HA301",
+                Title:      "Ingress not restricted by a NetworkPolicy",
+                Severity:   "LOW",
+                Message:    fmt.Sprintf("%s accepts traffic from any pod (%s)", w.ID(), wn.Ingress),
+                Resolution: "Ship a NetworkPolicy selecting the workload pods that only allows the expected clients.",
+                Resource:   w.ID(),
+                Kind:       w.Kind(),
+                Name:       w.Name(),
+                Namespace:  w.Namespace(),
+                File:       w.File,
+                Line:       w.Line,
+            }
+            if len(wn.Exposed) > 0 {
+                f.Severity = "MEDIUM"
+                f.Message += fmt.Sprintf(" and is exposed through %s", wn.Exposed[0])
+            }
+            out.Findings = append(out.Findings, f)
+        }
+    }
+    return out
+}
+
+// exposure rates the traffic the policies selecting a pod allow in one
+// direction. Policies apply to a direction when listed in policyTypes;
+// without policyTypes, Ingress always applies and Egress when egress
+// rules are present.
+func exposure(policies []*Manifest, policyType, field, peers string) string {
+    applied := 0
+    allowed := 0
+    for _, p := range policies {
+        if !hasPolicyType(p, policyType, field) {
+            continue
+        }
+        applied++
+        for _, rule := range listOf(get(p.Object, "spec", field)) {
+            allowed++
+            if allowsAll(rule, peers) {
+                return AllowAll
+            }
+        }
+    }
+    switch {
+    case applied == 0:
+        return DefaultAllow
+    case allowed == 0:
+        return Isolated
+    default:
+        return Restricted
+    }
+}
+
+func hasPolicyType(p *Manifest, policyType, field string) bool {
+    listed := stringList(get(p.Object, "spec", "policyTypes"))
+    if len(listed) > 0 {
+        return contains(listed, policyType)
+    }
+    if policyType == "Ingress" {
+        return true
+    }
+    _, ok := get(p.Object, "spec", field).([]any)
+    return ok
+}
+
+// allowsAll tells whether a rule lets any peer through: no peers and no
+// ports, or an ipBlock covering the whole internet.
+func allowsAll(rule map[string]any, peers string) bool {
+    list := listOf(rule[peers])
+    if len(list) == 0 {
+        ports, _ := rule["ports"].([]any)
+        return len(ports) == 0
+    }
+    for _, peer := range list {
+        cidr := str(peer, "ipBlock", "cidr")
+        except, _ := get(peer, "ipBlock", "except").([]any)
+        if (cidr == "0.0.0.0/0" || cidr == "::/0") && len(except) == 0 {
+            return true
+        }
+    }
+    return false
+}
+
+func exposedService(m *Manifest, g *Graph) (types.ExposedService, bool) {
+    typ := str(m.Object, "spec", "type")
+    if typ != "LoadBalancer" && typ != "NodePort" {
+        return types.ExposedService{}, false
+    }
+    svc := types.ExposedService{
+        Service:      m.ID(),
+        Type:         typ,
+        Ports:        []string{},
+        SourceRanges: stringList(get(m.Object, "spec", "loadBalancerSourceRanges")),
+    }
+    for _, p := range listOf(get(m.Object, "spec", "ports")) {
+        proto := str(p, "protocol")
+        if proto == "" {
+            proto = "TCP"
+        }
+        port := fmt.Sprint(p["port"])
+        if np, ok := p["nodePort"]; ok {
+            port += ":" + fmt.Sprint(np)
+        }
+        svc.Ports = append(svc.Ports, port+"/"+proto)
+    }
+    for _, n := range g.Out(m.ID(), RelSelects) {
+        svc.Workloads = append(svc.Workloads, n.ID)
+    }
+    return svc, true
+}
+
+func serviceFinding(m *Manifest, svc types.ExposedService) types.Finding {
+    f := types.Finding{
+        RuleID:     "HA302",
+        Title:      "Service exposed outside the cluster",
+        Severity:   "LOW",
+        Message:    fmt.Sprintf("%s is a %s Service on %s", m.ID(), svc.Type, strings.Join(svc.Ports, ", ")),
+        Resolution: "Use a ClusterIP Service behind an Ingress, or limit loadBalancerSourceRanges.",
+        Resource:   m.ID(),
+        Kind:       m.Kind(),
+        Name:       m.Name(),
+        Namespace:  m.Namespace(),
+        File:       m.File,
+        Line:       m.LineOf("spec", "type"),
+        Path:       "spec.type",
+    }
+    if svc.Type == "LoadBalancer" && len(svc.SourceRanges) == 0 {
+        f.Severity = "MEDIUM"
+        f.Message += " reachable from any address"
+    }
+    return f
+}
+
+// ingressHosts lists the hosts of an Ingress with their backends.
+func ingressHosts(m *Manifest) []types.IngressHost {
+    tls := map[string]bool{}
+    for _, t := range listOf(get(m.Object, "spec", "tls")) {
+        for _, h := range stringList(t["hosts"]) {
+            tls[h] = true
+        }
+    }
+
+    var out []types.IngressHost
+    for _, rule := range listOf(get(m.Object, "spec", "rules")) {
+        host := str(rule, "host")
+        if host == "" {
+            host = "*"
+        }
+        h := types.IngressHost{Ingress: m.ID(), Host: host, TLS: tls[host]}
+        for _, p := range listOf(get(rule, "http", "paths")) {
+            name := str(p, "backend", "service", "name")
+            if name == "" {
+                name = str(p, "backend", "serviceName")
+            }
+            if name != "" && !contains(h.Services, name) {
+                h.Services = append(h.Services, name)
+            }
+        }
+        out = append(out, h)
+    }
+    return out
+}
@@ -0,0 +1,305 @@
+package audit
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// Pod Security Standards levels, from least to most strict.
+const (
+    PSSPrivileged = "privileged"
+    PSSBaseline   = "baseline"
+    PSSRestricted = "restricted"
+)
+
+var pssOrder = map[string]int{PSSPrivileged: 0, PSSBaseline: 1, PSSRestricted: 2}
+
+// enforceLabel is the Pod Security Admission label of a namespace.
+const enforceLabel = "pod-security.kubernetes.io/enforce"
+
+// baselineCapabilities may be added under the baseline level.
+var baselineCapabilities = map[string]bool{
+    "AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true,
+    "KILL": true, "MKNOD": true, "NET_BIND_SERVICE": true, "SETFCAP": true, "SETGID": true,
+    "SETPCAP": true, "SETUID": true, "SYS_CHROOT": true,
+}
+
+var safeSysctls = map[string]bool{
+    "kernel.shm_rmid_forced":              true,
+    "net.ipv4.ip_local_port_range":        true,
+    "net.ipv4.ip_unprivileged_port_start": true,
+    "net.ipv4.tcp_syncookies":             true,
+    "net.ipv4.ping_group_range":           true,
+    "net.ipv4.ip_local_reserved_ports":    true,
+    "net.ipv4.tcp_keepalive_time":         true,
+    "net.ipv4.tcp_fin_timeout":            true,
+    "net.ipv4.tcp_keepalive_intvl":        true,
+    "net.ipv4.tcp_keepalive_probes":       true,
+}
+
+var allowedSELinuxTypes = map[string]bool{
+    "": true, "container_t": true, "container_init_t": true, "container_kvm_t": true, "container_engine_t": true,
+}
+
+// restrictedVolumes are the only volume types allowed under restricted,
+// name is the one key of a volume that is not a type.
+var restrictedVolumes = map[string]bool{
+    "configMap": true, "csi": true, "downwardAPI": true, "emptyDir": true, "ephemeral": true,
+    "persistentVolumeClaim": true, "projected": true, "secret": true, "name": true,
+}
+
+// pssEval collects the violations of one workload.
+type pssEval struct {
+    w   *Workload
+    out []types.PSSViolation
+}
+
+func (e *pssEval) add(level, check, container string, path []string, format string, args ...any) {
+    e.out = append(e.out, types.PSSViolation{
+        Level:     level,
+        Check:     check,
+        Container: container,
+        Field:     FieldPath(path),
+        Line:      e.w.LineOf(path...),
+        Detail:    fmt.Sprintf(format, args...),
+    })
+}
+
+// PSS is the outcome of EvaluatePSS.
+type PSS struct {
+    Report   *types.PSSReport
+    Findings []types.Finding
+}
+
+// EvaluatePSS classifies every workload against the Pod Security
+// Standards and tells which namespaces would reject it. Namespaces
+// rendered by the chart with an enforce label are checked against it,
+// the others only report the level they would need.
+func EvaluatePSS(manifests []*Manifest) *PSS {
+    report := &types.PSSReport{Required: PSSRestricted, Workloads: []types.PodSecurity{}, Namespaces: []types.NamespaceAdmission{}}
+    findings := []types.Finding{}
+
+    enforced := map[string]string{} // namespace -> enforce label
+    for _, m := range manifests {
+        if m.Kind() == "Namespace" {
+            if level := stringMap(get(m.Object, "metadata", "labels"))[enforceLabel]; level != "" {
+                enforced[m.Name()] = level
+            }
+        }
+    }
+
+    byNS := map[string]*types.NamespaceAdmission{}
+    var order []string
+    for _, w := range Workloads(manifests) {
+        ps := types.PodSecurity{Workload: w.ID(), Namespace: w.Namespace(), Level: PSSRestricted}
+        ps.Violations = evaluatePod(w)
+        for _, v := range ps.Violations {
+            if v.Level == PSSBaseline {
+                ps.Level = PSSPrivileged
+                break
+            }
+            ps.Level = PSSBaseline
+        }
+        report.Workloads = append(report.Workloads, ps)
+        report.Required = leastStrict(report.Required, ps.Level)
+
+        ns := w.Namespace()
+        na, ok := byNS[ns]
+        if !ok {
+            na = &types.NamespaceAdmission{Namespace: ns, Enforce: enforced[ns], Required: PSSRestricted}
+            byNS[ns] = na
+            order = append(order, ns)
+        }
+        na.Required = leastStrict(na.Required, ps.Level)
+
+        if level, ok := pssOrder[na.Enforce]; ok && pssOrder[ps.Level] < level {
+            na.Rejected = append(na.Rejected, w.ID())
+            findings = append(findings, types.Finding{
+                RuleID:     "HA501",
+                Title:      "Rejected by Pod Security Admission",
+                Severity:   "HIGH",
+                Message:    fmt.Sprintf("%s only meets %s but namespace %s enforces %s", w.ID(), ps.Level, ns, na.Enforce),
+                Resolution: "Fix the violating fields listed in the Pod Security report or lower the namespace enforce level.",
+                Resource:   w.ID(),
+                Kind:       w.Kind(),
+                Name:       w.Name(),
+                Namespace:  ns,
+                File:       w.File,
+                Line:       w.Line,
+            })
+        }
+    }
+
+    sort.Strings(order)
+    for _, ns := range order {
+        report.Namespaces = append(report.Namespaces, *byNS[ns])
+    }
+    return &PSS{Report: report, Findings: findings}
+}
+
+func leastStrict(a, b string) string {
+    if pssOrder[b] < pssOrder[a] {
+        return b
+    }
+    return a
+}
+
+// evaluatePod checks the pod template of w against the baseline and
+// restricted controls of the Pod Security Standards.
+func evaluatePod(w *Workload) []types.PSSViolation {
+    e := &pssEval{w: w}
+    pod := w.PodSpec()
+    sp := w.SpecPath
+    psc, _ := pod["securityContext"].(map[string]any)
+
+    // Baseline, pod level.
+    for _, field := range []string{"hostNetwork", "hostPID", "hostIPC"} {
+        if b, _ := boolAt(pod, field); b {
+            e.add(PSSBaseline, "Host Namespaces", "", sub(sp, field), "%s is true", field)
+        }
+    }
+    if b, _ := boolAt(psc, "windowsOptions", "hostProcess"); b {
+        e.add(PSSBaseline, "HostProcess", "", sub(sp, "securityContext", "windowsOptions", "hostProcess"), "hostProcess is true")
+    }
+    e.seLinux(psc, "", sub(sp, "securityContext"))
+    e.seccomp(psc, "", sub(sp, "securityContext"), false)
+    for i, s := range listOf(psc["sysctls"]) {
+        if name := str(s, "name"); !safeSysctls[name] {
+            e.add(PSSBaseline, "Sysctls", "", sub(sp, "securityContext", "sysctls", strconv.Itoa(i)), "sysctl %s is not in the safe set", name)
+        }
+    }
+    for i, v := range listOf(pod["volumes"]) {
+        path := sub(sp, "volumes", strconv.Itoa(i))
+        if _, ok := v["hostPath"]; ok {
+            e.add(PSSBaseline, "HostPath Volumes", "", sub(path, "hostPath"), "volume %q is a hostPath", str(v, "name"))
+            continue
+        }
+        for k := range v {
+            if !restrictedVolumes[k] {
+                e.add(PSSRestricted, "Volume Types", "", sub(path, k), "volume %q has type %s", str(v, "name"), k)
+            }
+        }
+    }
+    // The pod metadata sits next to its spec, also for bare Pods.
+    annotations := stringMap(get(w.Object, sub(sp[:len(sp)-1], "metadata", "annotations")...))
+    for k, v := range annotations {
+        if strings.HasPrefix(k, "container.apparmor.security.beta.kubernetes.io/") &&
+            v != "runtime/default" && !strings.HasPrefix(v, "localhost/") {
+            e.add(PSSBaseline, "AppArmor", strings.TrimPrefix(k, "container.apparmor.security.beta.kubernetes.io/"),
+                sub(sp[:len(sp)-1], "metadata", "annotations"), "AppArmor profile %s", v)
+        }
+    }
+
+    podNonRoot, _ := boolAt(psc, "runAsNonRoot")
+    podUser, podUserSet := intAt(psc, "runAsUser")
+    if podUserSet && podUser == 0 {
+        e.add(PSSRestricted, "Running as Non-root user", "", sub(sp, "securityContext", "runAsUser"), "runAsUser is 0")
+    }
+    podSeccomp := str(psc, "seccompProfile", "type")
+
+    for _, c := range w.Containers {
+        csc, _ := c.Spec["securityContext"].(map[string]any)
+        cp := sub(c.Path, "securityContext")
+
+        // Baseline, container level.
+        if b, _ := boolAt(csc, "privileged"); b {
+            e.add(PSSBaseline, "Privileged Containers", c.Name, sub(cp, "privileged"), "privileged is true")
+        }
+        if b, _ := boolAt(csc, "windowsOptions", "hostProcess"); b {
+            e.add(PSSBaseline, "HostProcess", c.Name, sub(cp, "windowsOptions", "hostProcess"), "hostProcess is true")
+        }
+        added := stringList(get(csc, "capabilities", "add"))
+        for _, a := range added {
+            if name := strings.TrimPrefix(strings.ToUpper(a), "CAP_"); !baselineCapabilities[name] {
+                e.add(PSSBaseline, "Capabilities", c.Name, sub(cp, "capabilities", "add"), "adds %s", name)
+            }
+        }
+        for i, p := range listOf(c.Spec["ports"]) {
+            if port, ok := intAt(p, "hostPort"); ok && port != 0 {
+                e.add(PSSBaseline, "Host Ports", c.Name, sub(c.Path, "ports", strconv.Itoa(i), "hostPort"), "hostPort %d", port)
+            }
+        }
+        if pm := str(csc, "procMount"); pm != "" && pm != "Default" {
+            e.add(PSSBaseline, "/proc Mount Type", c.Name, sub(cp, "procMount"), "procMount is %s", pm)
+        }
+        if t := str(csc, "appArmorProfile", "type"); t == "Unconfined" {
+            e.add(PSSBaseline, "AppArmor", c.Name, sub(cp, "appArmorProfile", "type"), "AppArmor profile is Unconfined")
+        }
+        e.seLinux(csc, c.Name, cp)
+        e.seccomp(csc, c.Name, cp, false)
+
+        // Restricted.
+        if b, set := boolAt(csc, "allowPrivilegeEscalation"); !set || b {
+            e.add(PSSRestricted, "Privilege Escalation", c.Name, sub(cp, "allowPrivilegeEscalation"), "allowPrivilegeEscalation is not false")
+        }
+        nonRoot, set := boolAt(csc, "runAsNonRoot")
+        if !set {
+            nonRoot = podNonRoot
+        }
+        if !nonRoot {
+            e.add(PSSRestricted, "Running as Non-root", c.Name, sub(cp, "runAsNonRoot"), "runAsNonRoot is not true")
+        }
+        if u, ok := intAt(csc, "runAsUser"); ok && u == 0 {
+            e.add(PSSRestricted, "Running as Non-root user", c.Name, sub(cp, "runAsUser"), "runAsUser is 0")
+        }
+        if t := str(csc, "seccompProfile", "type"); t == "" && podSeccomp == "" {
+            e.add(PSSRestricted, "Seccomp", c.Name, sub(cp, "seccompProfile"), "no seccomp profile on the pod or container")
+        } else {
+            e.seccomp(csc, c.Name, cp, true)
+        }
+        if c.Field != "ephemeralContainers" && !containsFold(stringList(get(csc, "capabilities", "drop")), "ALL") {
+            e.add(PSSRestricted, "Capabilities", c.Name, sub(cp, "capabilities", "drop"), "capabilities are not dropped with ALL")
+        }
+        for _, a := range added {
+            if name := strings.TrimPrefix(strings.ToUpper(a), "CAP_"); name != "NET_BIND_SERVICE" && baselineCapabilities[name] {
+                e.add(PSSRestricted, "Capabilities", c.Name, sub(cp, "capabilities", "add"), "adds %s", name)
+            }
+        }
+    }
+    if podSeccomp != "" {
+        e.seccomp(psc, "", sub(sp, "securityContext"), true)
+    }
+    return e.out
+}
+
+// seLinux checks the seLinuxOptions of a security context (baseline).
+func (e *pssEval) seLinux(sc map[string]any, container string, path []string) {
+    opts, _ := sc["seLinuxOptions"].(map[string]any)
+    if opts == nil {
+        return
+    }
+    if t := str(opts, "type"); !allowedSELinuxTypes[t] {
+        e.add(PSSBaseline, "SELinux", container, sub(path, "seLinuxOptions", "type"), "SELinux type %s", t)
+    }
+    for _, f := range []string{"user", "role"} {
+        if v := str(opts, f); v != "" {
+            e.add(PSSBaseline, "SELinux", container, sub(path, "seLinuxOptions", f), "SELinux %s %s", f, v)
+        }
+    }
+}
+
+// seccomp checks the seccomp profile of a security context: Unconfined
+// breaks baseline, restricted also requires RuntimeDefault or Localhost.
+func (e *pssEval) seccomp(sc map[string]any, container string, path []string, restricted bool) {
+    t := str(sc, "seccompProfile", "type")
+    switch {
+    case t == "":
+    case !restricted && t == "Unconfined":
+        e.add(PSSBaseline, "Seccomp", container, sub(path, "seccompProfile", "type"), "seccomp profile is Unconfined")
+    case restricted && t != "RuntimeDefault" && t != "Localhost" && t != "Unconfined":
+        e.add(PSSRestricted, "Seccomp", container, sub(path, "seccompProfile", "type"), "seccomp profile is %s", t)
+    }
+}
+
+func containsFold(list []string, s string) bool {
+    for _, v := range list {
+        if strings.EqualFold(v, s) {
+            return true
+        }
+    }
+    return false
+}
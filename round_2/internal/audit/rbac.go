@@ -0,0 +1,442 @@
+package audit
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// Scopes of a permission besides a namespace name: cluster wide through a
+// ClusterRoleBinding, or the namespace helm installs the release into.
+const (
+    clusterScope = "cluster"
+    releaseScope = "release namespace"
+)
+
+// grantCheck flags a dangerous RBAC rule.
+type grantCheck struct {
+    ID         string
+    Title      string
+    Severity   string // when only granted inside a namespace
+    Cluster    string // when granted cluster wide
+    Resolution string
+    Match      func(r policyRule) bool
+}
+
+var grantChecks = []grantCheck{
+    {
+        ID:         "HA101",
+        Title:      "Wildcard RBAC verbs",
+        Severity:   "HIGH",
+        Cluster:    "CRITICAL",
+        Resolution: "List the verbs the workload needs instead of *.",
+        Match:      func(r policyRule) bool { return contains(r.Verbs, "*") },
+    },
+    {
+        ID:         "HA102",
+        Title:      "Secrets readable",
+        Severity:   "MEDIUM",
+        Cluster:    "HIGH",
+        Resolution: "Restrict secret access to a namespaced Role with resourceNames.",
+        Match: func(r policyRule) bool {
+            return len(r.ResourceNames) == 0 && r.grants("", "secrets", "get", "list", "watch")
+        },
+    },
+    {
+        ID:         "HA103",
+        Title:      "Privilege escalation verbs",
+        Severity:   "HIGH",
+        Cluster:    "CRITICAL",
+        Resolution: "Remove escalate, bind and impersonate unless the chart manages RBAC on behalf of users.",
+        Match: func(r policyRule) bool {
+            return r.grants("rbac.authorization.k8s.io", "roles", "escalate", "bind") ||
+                r.grants("rbac.authorization.k8s.io", "clusterroles", "escalate", "bind") ||
+                r.grants("", "users", "impersonate") ||
+                r.grants("", "groups", "impersonate") ||
+                r.grants("", "serviceaccounts", "impersonate")
+        },
+    },
+    {
+        ID:         "HA104",
+        Title:      "Pod exec or attach",
+        Severity:   "HIGH",
+        Cluster:    "HIGH",
+        Resolution: "Do not grant pods/exec or pods/attach to workloads.",
+        Match: func(r policyRule) bool {
+            return r.grants("", "pods/exec", "create", "get") || r.grants("", "pods/attach", "create", "get")
+        },
+    },
+    {
+        ID:         "HA105",
+        Title:      "Node proxy access",
+        Severity:   "HIGH",
+        Cluster:    "CRITICAL",
+        Resolution: "Remove nodes/proxy, it gives access to the kubelet API of every node.",
+        Match:      func(r policyRule) bool { return r.grants("", "nodes/proxy", "*", "get", "create") },
+    },
+}
+
+// builtinAdmin are default ClusterRoles granting full or near full access.
+var builtinAdmin = map[string]bool{"cluster-admin": true, "admin": true, "edit": true}
+
+type policyRule struct {
+    APIGroups       []string
+    Resources       []string
+    ResourceNames   []string
+    NonResourceURLs []string
+    Verbs           []string
+
+    path []string
+}
+
+// admin tells whether the rule grants everything, which makes the other
+// checks redundant.
+func (r policyRule) admin() bool {
+    return contains(r.Verbs, "*") && contains(r.Resources, "*") && contains(r.APIGroups, "*")
+}
+
+// flags returns the checks matching the rule.
+func (r policyRule) flags() []grantCheck {
+    var out []grantCheck
+    for _, c := range grantChecks {
+        if c.Match(r) {
+            out = append(out, c)
+            if r.admin() {
+                break // the wildcard check comes first and covers the rest
+            }
+        }
+    }
+    return out
+}
+
+// grants tells whether the rule allows any of verbs on resource.
+func (r policyRule) grants(group, resource string, verbs ...string) bool {
+    if !contains(r.APIGroups, "*") && !contains(r.APIGroups, group) {
+        return false
+    }
+    if !matchResource(r.Resources, resource) {
+        return false
+    }
+    if contains(r.Verbs, "*") {
+        return true
+    }
+    for _, v := range verbs {
+        if contains(r.Verbs, v) {
+            return true
+        }
+    }
+    return false
+}
+
+type rbacRole struct {
+    *Manifest
+    rules []policyRule
+}
+
+type rbacSubject struct {
+    Kind      string
+    Name      string
+    Namespace string
+}
+
+type rbacBinding struct {
+    *Manifest
+    roleRef  string // Kind/name
+    role     *rbacRole
+    subjects []rbacSubject
+    scope    string
+}
+
+// RBAC is the outcome of AnalyzeRBAC.
+type RBAC struct {
+    Findings  []types.Finding
+    Workloads []types.WorkloadPermissions
+}
+
+// AnalyzeRBAC resolves the roles and bindings rendered by the chart into
+// the permissions of every workload, and flags dangerous grants.
+func AnalyzeRBAC(manifests []*Manifest) *RBAC {
+    ctx := NewContext(manifests)
+    roles := map[*Manifest]*rbacRole{}
+    var bindings []*rbacBinding
+
+    for _, m := range manifests {
+        if !isRBAC(m) {
+            continue
+        }
+        switch m.Kind() {
+        case "Role", "ClusterRole":
+            roles[m] = parseRole(m)
+        }
+    }
+    for _, m := range manifests {
+        if !isRBAC(m) || (m.Kind() != "RoleBinding" && m.Kind() != "ClusterRoleBinding") {
+            continue
+        }
+        b := parseBinding(m)
+        refKind, refName := str(m.Object, "roleRef", "kind"), str(m.Object, "roleRef", "name")
+        b.roleRef = refKind + "/" + refName
+        ns := m.Namespace()
+        if refKind == "ClusterRole" {
+            ns = ""
+        }
+        if rm := ctx.Lookup(refKind, ns, refName); rm != nil {
+            b.role = roles[rm]
+        }
+        bindings = append(bindings, b)
+    }
+
+    out := &RBAC{Findings: []types.Finding{}, Workloads: []types.WorkloadPermissions{}}
+    out.Findings = append(out.Findings, roleFindings(manifests, roles, bindings)...)
+    out.Findings = append(out.Findings, builtinBindingFindings(bindings)...)
+
+    for _, w := range Workloads(manifests) {
+        sa := ServiceAccountName(w)
+        wp := types.WorkloadPermissions{
+            Workload:       w.ID(),
+            ServiceAccount: qualify(w.Namespace(), sa),
+            Permissions:    []types.Permission{},
+        }
+        for _, b := range bindings {
+            if b.binds(w.Namespace(), sa) {
+                wp.Permissions = append(wp.Permissions, b.permissions()...)
+            }
+        }
+        out.Workloads = append(out.Workloads, wp)
+    }
+    return out
+}
+
+// roleFindings flags the dangerous rules of every role, with the
+// subjects it is bound to.
+func roleFindings(manifests []*Manifest, roles map[*Manifest]*rbacRole, bindings []*rbacBinding) []types.Finding {
+    var out []types.Finding
+    for _, m := range manifests {
+        role, ok := roles[m]
+        if !ok {
+            continue
+        }
+
+        var bound []string
+        cluster := false
+        for _, b := range bindings {
+            if b.role != role {
+                continue
+            }
+            cluster = cluster || b.scope == clusterScope
+            for _, s := range b.subjects {
+                bound = append(bound, fmt.Sprintf("%s %s", s.Kind, qualify(s.Namespace, s.Name)))
+            }
+        }
+
+        for _, r := range role.rules {
+            for _, c := range r.flags() {
+                sev := c.Severity
+                if cluster {
+                    sev = c.Cluster
+                }
+                msg := fmt.Sprintf("%s grants %s on %s", m.ID(), strings.Join(r.Verbs, ","), describeTargets(r))
+                if cluster {
+                    msg += " cluster wide"
+                }
+                if len(bound) > 0 {
+                    msg += ", bound to " + strings.Join(bound, ", ")
+                } else {
+                    msg += ", not bound by the chart"
+                }
+                out = append(out, types.Finding{
+                    RuleID:     c.ID,
+                    Title:      c.Title,
+                    Severity:   sev,
+                    Message:    msg,
+                    Resolution: c.Resolution,
+                    Resource:   m.ID(),
+                    Kind:       m.Kind(),
+                    Name:       m.Name(),
+                    Namespace:  m.Namespace(),
+                    File:       m.File,
+                    Line:       m.LineOf(r.path...),
+                    Path:       FieldPath(r.path),
+                })
+            }
+        }
+    }
+    return out
+}
+
+// builtinBindingFindings flags bindings to the default admin roles, which
+// the chart does not render and so cannot be inspected rule by rule.
+func builtinBindingFindings(bindings []*rbacBinding) []types.Finding {
+    var out []types.Finding
+    for _, b := range bindings {
+        name := strings.TrimPrefix(b.roleRef, "ClusterRole/")
+        if b.role != nil || !builtinAdmin[name] || !strings.HasPrefix(b.roleRef, "ClusterRole/") {
+            continue
+        }
+        sev := "HIGH"
+        if name == "cluster-admin" || b.scope == clusterScope {
+            sev = "CRITICAL"
+        }
+        var subjects []string
+        for _, s := range b.subjects {
+            subjects = append(subjects, fmt.Sprintf("%s %s", s.Kind, qualify(s.Namespace, s.Name)))
+        }
+        out = append(out, types.Finding{
+            RuleID:     "HA106",
+            Title:      "Binding to a built in admin role",
+            Severity:   sev,
+            Message:    fmt.Sprintf("%s grants %s to %s", b.ID(), b.roleRef, strings.Join(subjects, ", ")),
+            Resolution: "Bind a dedicated Role listing only the permissions the workload needs.",
+            Resource:   b.ID(),
+            Kind:       b.Kind(),
+            Name:       b.Name(),
+            Namespace:  b.Namespace(),
+            File:       b.File,
+            Line:       b.LineOf("roleRef"),
+            Path:       "roleRef",
+        })
+    }
+    return out
+}
+
+func parseRole(m *Manifest) *rbacRole {
+    role := &rbacRole{Manifest: m}
+    rules, _ := m.Object["rules"].([]any)
+    for i, r := range rules {
+        rm, _ := r.(map[string]any)
+        role.rules = append(role.rules, policyRule{
+            APIGroups:       stringList(rm["apiGroups"]),
+            Resources:       stringList(rm["resources"]),
+            ResourceNames:   stringList(rm["resourceNames"]),
+            NonResourceURLs: stringList(rm["nonResourceURLs"]),
+            Verbs:           stringList(rm["verbs"]),
+            path:            []string{"rules", strconv.Itoa(i)},
+        })
+    }
+    return role
+}
+
+func parseBinding(m *Manifest) *rbacBinding {
+    b := &rbacBinding{Manifest: m, scope: m.Namespace()}
+    switch {
+    case m.Kind() == "ClusterRoleBinding":
+        b.scope = clusterScope
+    case b.scope == "":
+        b.scope = releaseScope
+    }
+    subjects, _ := m.Object["subjects"].([]any)
+    for _, s := range subjects {
+        sm, _ := s.(map[string]any)
+        subj := rbacSubject{Kind: str(sm, "kind"), Name: str(sm, "name"), Namespace: str(sm, "namespace")}
+        if subj.Kind == "ServiceAccount" && subj.Namespace == "" {
+            subj.Namespace = m.Namespace()
+        }
+        b.subjects = append(b.subjects, subj)
+    }
+    return b
+}
+
+// binds tells whether the binding applies to service account sa of
+// namespace ns. An empty namespace, as rendered without --namespace,
+// matches any namespace.
+func (b *rbacBinding) binds(ns, sa string) bool {
+    for _, s := range b.subjects {
+        switch {
+        case s.Kind == "ServiceAccount" && s.Name == sa && sameNamespace(s.Namespace, ns):
+            return true
+        case s.Kind == "Group" && s.Name == "system:serviceaccounts":
+            return true
+        case s.Kind == "Group" && strings.HasPrefix(s.Name, "system:serviceaccounts:") &&
+            sameNamespace(strings.TrimPrefix(s.Name, "system:serviceaccounts:"), ns):
+            return true
+        }
+    }
+    return false
+}
+
+// permissions lists the rules granted through the binding.
+func (b *rbacBinding) permissions() []types.Permission {
+    if b.role == nil {
+        return []types.Permission{{Role: b.roleRef, Binding: b.ID(), Scope: b.scope, Verbs: []string{}, External: true}}
+    }
+
+    var out []types.Permission
+    for _, r := range b.role.rules {
+        p := types.Permission{
+            Role:            b.roleRef,
+            Binding:         b.ID(),
+            Scope:           b.scope,
+            APIGroups:       r.APIGroups,
+            Resources:       r.Resources,
+            ResourceNames:   r.ResourceNames,
+            NonResourceURLs: r.NonResourceURLs,
+            Verbs:           r.Verbs,
+        }
+        for _, c := range r.flags() {
+            p.Flags = append(p.Flags, c.ID)
+        }
+        out = append(out, p)
+    }
+    return out
+}
+
+func isRBAC(m *Manifest) bool {
+    return strings.HasPrefix(m.APIVersion(), "rbac.authorization.k8s.io/")
+}
+
+func describeTargets(r policyRule) string {
+    if len(r.NonResourceURLs) > 0 {
+        return strings.Join(r.NonResourceURLs, ",")
+    }
+    targets := append([]string{}, r.Resources...)
+    sort.Strings(targets)
+    return strings.Join(targets, ",")
+}
+
+// matchResource matches resource against a rule resource list, which may
+// hold * or subresource wildcards such as pods/*.
+func matchResource(list []string, resource string) bool {
+    for _, r := range list {
+        if r == "*" || r == resource {
+            return true
+        }
+        if strings.HasSuffix(r, "/*") && strings.HasPrefix(resource, strings.TrimSuffix(r, "*")) {
+            return true
+        }
+    }
+    return false
+}
+
+func sameNamespace(a, b string) bool {
+    return a == "" || b == "" || a == b
+}
+
+func qualify(ns, name string) string {
+    if ns == "" {
+        return name
+    }
+    return ns + "/" + name
+}
+
+func stringList(v any) []string {
+    list, _ := v.([]any)
+    out := []string{}
+    for _, item := range list {
+        if s, ok := item.(string); ok {
+            out = append(out, s)
+        }
+    }
+    return out
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,347 @@
+package audit
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// DefaultRules are the built in workload checks.
+var DefaultRules = []Rule{
+    {
+        ID:         "HA001",
+        Title:      "Privileged container",
+        Severity:   "HIGH",
+        Resolution: "Remove securityContext.privileged or set it to false.",
+        Check:      checkPrivileged,
+    },
+    {
+        ID:         "HA002",
+        Title:      "hostPath volume",
+        Severity:   "MEDIUM",
+        Resolution: "Use a persistent volume, configMap or emptyDir instead of mounting node paths.",
+        Check:      checkHostPath,
+    },
+    hostNamespaceRule("HA003", "hostNetwork", "Host network namespace"),
+    hostNamespaceRule("HA004", "hostPID", "Host PID namespace"),
+    hostNamespaceRule("HA005", "hostIPC", "Host IPC namespace"),
+    {
+        ID:         "HA006",
+        Title:      "Container may run as root",
+        Severity:   "MEDIUM",
+        Resolution: "Set securityContext.runAsNonRoot to true and runAsUser to a non zero UID.",
+        Check:      checkRunAsRoot,
+    },
+    {
+        ID:         "HA007",
+        Title:      "Missing resource limits",
+        Severity:   "LOW",
+        Resolution: "Set resources.limits.cpu and resources.limits.memory.",
+        Check:      checkLimits,
+    },
+    {
+        ID:         "HA008",
+        Title:      "Added Linux capabilities",
+        Severity:   "MEDIUM",
+        Resolution: "Drop ALL capabilities and only add back the ones the process needs.",
+        Check:      checkCapabilities,
+    },
+    {
+        ID:         "HA009",
+        Title:      "Writable root filesystem",
+        Severity:   "LOW",
+        Resolution: "Set securityContext.readOnlyRootFilesystem to true and mount emptyDir volumes for scratch space.",
+        Check:      checkReadOnlyRootFS,
+    },
+    {
+        ID:         "HA010",
+        Title:      "Service account token mounted",
+        Severity:   "LOW",
+        Resolution: "Set automountServiceAccountToken to false on the pod or its ServiceAccount unless it talks to the API server.",
+        Check:      checkAutomountToken,
+    },
+    {
+        ID:         "HA011",
+        Title:      "Mutable image tag",
+        Severity:   "MEDIUM",
+        Resolution: "Pin the image to a version tag, ideally with its digest.",
+        Check:      checkLatestTag,
+    },
+}
+
+// sensitiveHostPaths give control over the node when mounted.
+var sensitiveHostPaths = []string{
+    "/", "/etc", "/proc", "/sys", "/root", "/var/lib/kubelet",
+    "/var/run/docker.sock", "/run/containerd", "/var/run/containerd", "/var/run/crio",
+}
+
+// dangerousCapabilities allow escaping or attacking the node.
+var dangerousCapabilities = map[string]bool{
+    "ALL":             true,
+    "SYS_ADMIN":       true,
+    "SYS_PTRACE":      true,
+    "SYS_MODULE":      true,
+    "SYS_RAWIO":       true,
+    "NET_ADMIN":       true,
+    "NET_RAW":         true,
+    "DAC_READ_SEARCH": true,
+    "BPF":             true,
+    "PERFMON":         true,
+}
+
+func checkPrivileged(w *Workload, _ *Context) []Violation {
+    var out []Violation
+    for _, c := range w.Containers {
+        if b, _ := boolAt(c.Spec, "securityContext", "privileged"); b {
+            out = append(out, Violation{
+                Container: c.Name,
+                Path:      sub(c.Path, "securityContext", "privileged"),
+                Message:   fmt.Sprintf("container %q runs privileged", c.Name),
+            })
+        }
+    }
+    return out
+}
+
+func checkHostPath(w *Workload, _ *Context) []Violation {
+    var out []Violation
+    volumes, _ := w.PodSpec()["volumes"].([]any)
+    for i, v := range volumes {
+        vm, _ := v.(map[string]any)
+        path := str(vm, "hostPath", "path")
+        if _, ok := vm["hostPath"]; !ok {
+            continue
+        }
+        viol := Violation{
+            Path:    sub(w.SpecPath, "volumes", strconv.Itoa(i), "hostPath"),
+            Message: fmt.Sprintf("volume %q mounts host path %s", str(vm, "name"), path),
+        }
+        if sensitiveHostPath(path) {
+            viol.Severity = "HIGH"
+        }
+        out = append(out, viol)
+    }
+    return out
+}
+
+func hostNamespaceRule(id, field, title string) Rule {
+    return Rule{
+        ID:         id,
+        Title:      title,
+        Severity:   "HIGH",
+        Resolution: fmt.Sprintf("Remove %s from the pod spec.", field),
+        Check: func(w *Workload, _ *Context) []Violation {
+            if b, _ := boolAt(w.PodSpec(), field); !b {
+                return nil
+            }
+            return []Violation{{
+                Path:    sub(w.SpecPath, field),
+                Message: fmt.Sprintf("pod sets %s: true", field),
+            }}
+        },
+    }
+}
+
+func checkRunAsRoot(w *Workload, _ *Context) []Violation {
+    pod := w.PodSpec()
+    podUser, podUserSet := intAt(pod, "securityContext", "runAsUser")
+    podNonRoot, _ := boolAt(pod, "securityContext", "runAsNonRoot")
+
+    var out []Violation
+    for _, c := range w.Containers {
+        user, userSet := intAt(c.Spec, "securityContext", "runAsUser")
+        userPath := sub(c.Path, "securityContext", "runAsUser")
+        if !userSet {
+            user, userSet = podUser, podUserSet
+            userPath = sub(w.SpecPath, "securityContext", "runAsUser")
+        }
+        nonRoot, nonRootSet := boolAt(c.Spec, "securityContext", "runAsNonRoot")
+        if !nonRootSet {
+            nonRoot = podNonRoot
+        }
+
+        switch {
+        case userSet && user == 0:
+            out = append(out, Violation{
+                Container: c.Name,
+                Path:      userPath,
+                Message:   fmt.Sprintf("container %q runs as UID 0", c.Name),
+                Severity:  "HIGH",
+            })
+        case !userSet && !nonRoot:
+            out = append(out, Violation{
+                Container: c.Name,
+                Path:      sub(c.Path, "securityContext"),
+                Message:   fmt.Sprintf("container %q does not set runAsNonRoot, it runs as the image user which may be root", c.Name),
+            })
+        }
+    }
+    return out
+}
+
+func checkLimits(w *Workload, _ *Context) []Violation {
+    var out []Violation
+    for _, c := range w.Containers {
+        if c.Field == "ephemeralContainers" {
+            continue // resources are not allowed on ephemeral containers
+        }
+        var missing []string
+        for _, r := range []string{"cpu", "memory"} {
+            if get(c.Spec, "resources", "limits", r) == nil {
+                missing = append(missing, r)
+            }
+        }
+        if len(missing) == 0 {
+            continue
+        }
+        out = append(out, Violation{
+            Container: c.Name,
+            Path:      sub(c.Path, "resources"),
+            Message:   fmt.Sprintf("container %q has no %s limit", c.Name, strings.Join(missing, " or ")),
+        })
+    }
+    return out
+}
+
+func checkCapabilities(w *Workload, _ *Context) []Violation {
+    var out []Violation
+    for _, c := range w.Containers {
+        added, _ := get(c.Spec, "securityContext", "capabilities", "add").([]any)
+        if len(added) == 0 {
+            continue
+        }
+        var caps []string
+        dangerous := false
+        for _, a := range added {
+            s, _ := a.(string)
+            name := strings.TrimPrefix(strings.ToUpper(s), "CAP_")
+            caps = append(caps, name)
+            dangerous = dangerous || dangerousCapabilities[name]
+        }
+        v := Violation{
+            Container: c.Name,
+            Path:      sub(c.Path, "securityContext", "capabilities", "add"),
+            Message:   fmt.Sprintf("container %q adds capabilities %s", c.Name, strings.Join(caps, ", ")),
+        }
+        if dangerous {
+            v.Severity = "HIGH"
+        }
+        out = append(out, v)
+    }
+    return out
+}
+
+func checkReadOnlyRootFS(w *Workload, _ *Context) []Violation {
+    var out []Violation
+    for _, c := range w.Containers {
+        if c.Field == "ephemeralContainers" {
+            continue
+        }
+        if b, _ := boolAt(c.Spec, "securityContext", "readOnlyRootFilesystem"); b {
+            continue
+        }
+        out = append(out, Violation{
+            Container: c.Name,
+            Path:      sub(c.Path, "securityContext"),
+            Message:   fmt.Sprintf("container %q has a writable root filesystem", c.Name),
+        })
+    }
+    return out
+}
+
+func checkAutomountToken(w *Workload, ctx *Context) []Violation {
+    pod := w.PodSpec()
+    if automount, set := boolAt(pod, "automountServiceAccountToken"); set {
+        if automount {
+            return []Violation{{
+                Path:    sub(w.SpecPath, "automountServiceAccountToken"),
+                Message: "pod mounts its service account token",
+            }}
+        }
+        return nil
+    }
+
+    sa := ServiceAccountName(w)
+    if m := ctx.Lookup("ServiceAccount", w.Namespace(), sa); m != nil {
+        if automount, set := boolAt(m.Object, "automountServiceAccountToken"); set && !automount {
+            return nil
+        }
+    }
+    return []Violation{{
+        Path:    w.SpecPath,
+        Message: fmt.Sprintf("token of service account %q is mounted by default", sa),
+    }}
+}
+
+func checkLatestTag(w *Workload, _ *Context) []Violation {
+    var out []Violation
+    for _, c := range w.Containers {
+        if c.Image == "" || strings.Contains(c.Image, "@") {
+            continue
+        }
+        tag := ""
+        last := c.Image[strings.LastIndex(c.Image, "/")+1:]
+        if i := strings.LastIndex(last, ":"); i >= 0 {
+            tag = last[i+1:]
+        }
+        if tag != "" && tag != "latest" {
+            continue
+        }
+        msg := fmt.Sprintf("container %q uses image %s without a tag", c.Name, c.Image)
+        if tag == "latest" {
+            msg = fmt.Sprintf("container %q uses the latest tag of %s", c.Name, c.Image)
+        }
+        out = append(out, Violation{
+            Container: c.Name,
+            Path:      sub(c.Path, "image"),
+            Message:   msg,
+        })
+    }
+    return out
+}
+
+// ServiceAccountName returns the service account the workload pods run as.
+func ServiceAccountName(w *Workload) string {
+    pod := w.PodSpec()
+    if sa := str(pod, "serviceAccountName"); sa != "" {
+        return sa
+    }
+    if sa := str(pod, "serviceAccount"); sa != "" {
+        return sa
+    }
+    return "default"
+}
+
+func sensitiveHostPath(path string) bool {
+    path = strings.TrimSuffix(path, "/")
+    if path == "" {
+        return true // the node root
+    }
+    for _, p := range sensitiveHostPaths {
+        if path == p || (p != "/" && strings.HasPrefix(path, p+"/")) {
+            return true
+        }
+    }
+    return false
+}
+
+// boolAt returns the boolean at path and whether it was set.
+func boolAt(obj map[string]any, path ...string) (bool, bool) {
+    b, ok := get(obj, path...).(bool)
+    return b, ok
+}
+
+// intAt returns the integer at path and whether it was set.
+func intAt(obj map[string]any, path ...string) (int64, bool) {
+    switch v := get(obj, path...).(type) {
+    case int:
+        return int64(v), true
+    case int64:
+        return v, true
+    case uint64:
+        return int64(v), true
+    case float64:
+        return int64(v), true
+    }
+    return 0, false
+}
@@ -0,0 +1,411 @@
+package audit
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "helm-auditor/internal/types"
+)
+
+// DefaultSchemaDir holds the Kubernetes JSON schemas bundled in the image,
+// one <version>-standalone-strict directory per Kubernetes release as
+// published by the kubernetes-json-schema project.
+const DefaultSchemaDir = "/schemas"
+
+// Validator checks rendered documents against the OpenAPI schemas of a
+// Kubernetes release and the CRDs known to the chart.
+type Validator struct {
+    dir   string // standalone-strict directory of the selected release
+    cache map[string]map[string]any
+    crds  map[string]map[string]any // apiVersion/Kind -> openAPIV3Schema
+}
+
+// Validation is the outcome of Validator.Validate.
+type Validation struct {
+    Findings    []types.Finding
+    Unvalidated []string // resources without a known schema
+}
+
+// SchemaVersion turns "1.32", "v1.32.3" or "1.32.0-eks-1" into the
+// directory prefix of the schemas bundled for that minor release,
+// "v1.32.0". Patch releases do not change the APIs.
+func SchemaVersion(v string) (string, error) {
+    if _, err := ParseKubeVersion(v); err != nil {
+        return "", err
+    }
+    parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(v), "v"), ".", 3)
+    return fmt.Sprintf("v%s.%s.0", parts[0], strings.TrimRight(parts[1], "+")), nil
+}
+
+// BundledSchemaVersions lists the releases with schemas under schemaDir.
+func BundledSchemaVersions(schemaDir string) []string {
+    dirs, _ := filepath.Glob(filepath.Join(schemaDir, "*-standalone-strict"))
+    out := make([]string, 0, len(dirs))
+    for _, d := range dirs {
+        out = append(out, strings.TrimSuffix(filepath.Base(d), "-standalone-strict"))
+    }
+    sort.Strings(out)
+    return out
+}
+
+// SchemasUnavailable reports that the manifests could not be validated
+// (HA704) because no schemas are bundled for kubeVersion.
+func SchemasUnavailable(schemaDir, kubeVersion string, err error) types.Finding {
+    bundled := strings.Join(BundledSchemaVersions(schemaDir), ", ")
+    if bundled == "" {
+        bundled = "none"
+    }
+    return types.Finding{
+        RuleID:     "HA704",
+        Title:      "Schema validation skipped",
+        Severity:   "LOW",
+        Message:    fmt.Sprintf("Manifests not validated against Kubernetes %s: %v (bundled: %s)", kubeVersion, err, bundled),
+        Resolution: "Add the release to KUBE_SCHEMA_VERSIONS in the Dockerfile or set KUBE_VERSION to a bundled one.",
+        Resource:   "Kubernetes/" + kubeVersion,
+    }
+}
+
+// NewValidator selects the schemas of kubeVersion under schemaDir.
+func NewValidator(schemaDir, kubeVersion string) (*Validator, error) {
+    version, err := SchemaVersion(kubeVersion)
+    if err != nil {
+        return nil, err
+    }
+    dir := filepath.Join(schemaDir, version+"-standalone-strict")
+    if _, err := os.Stat(dir); err != nil {
+        return nil, fmt.Errorf("no schemas for Kubernetes %s: %w", version, err)
+    }
+    return &Validator{dir: dir, cache: map[string]map[string]any{}, crds: map[string]map[string]any{}}, nil
+}
+
+// LoadCRDs parses the CustomResourceDefinitions shipped in the crds/
+// directories of a chart and its subcharts.
+func LoadCRDs(chartDir string) ([]*Manifest, error) {
+    var out []*Manifest
+    err := filepath.WalkDir(chartDir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || !strings.Contains(filepath.ToSlash(path), "/crds/") {
+            return nil
+        }
+        if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+            return nil
+        }
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(chartDir, path)
+        if err != nil {
+            rel = path
+        }
+        docs, err := ParseManifests(data, filepath.ToSlash(rel))
+        if err != nil {
+            return err
+        }
+        for _, m := range docs {
+            if m.Kind() == "CustomResourceDefinition" {
+                out = append(out, m)
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return out, fmt.Errorf("loading CRDs from %s: %w", chartDir, err)
+    }
+    return out, nil
+}
+
+// AddCRDs registers the schemas of every served version of the CRDs
+// among manifests, other documents are ignored.
+func (v *Validator) AddCRDs(manifests []*Manifest) {
+    for _, m := range manifests {
+        if m.Kind() != "CustomResourceDefinition" {
+            continue
+        }
+        group := str(m.Object, "spec", "group")
+        kind := str(m.Object, "spec", "names", "kind")
+        for _, ver := range listOf(get(m.Object, "spec", "versions")) {
+            schema, _ := get(ver, "schema", "openAPIV3Schema").(map[string]any)
+            if schema == nil {
+                // apiextensions.k8s.io/v1beta1 had a single top level schema
+                schema, _ = get(m.Object, "spec", "validation", "openAPIV3Schema").(map[string]any)
+            }
+            if schema != nil {
+                v.crds[group+"/"+str(ver, "name")+"/"+kind] = schema
+            }
+        }
+    }
+}
+
+// schemaFor returns the schema of a document and whether it is a CRD's.
+func (v *Validator) schemaFor(m *Manifest) (map[string]any, bool, error) {
+    if s, ok := v.crds[m.APIVersion()+"/"+m.Kind()]; ok {
+        return s, true, nil
+    }
+
+    // deployment-apps-v1.json, pod-v1.json, ingress-networking-v1.json
+    group, version, found := strings.Cut(m.APIVersion(), "/")
+    name := strings.ToLower(m.Kind())
+    if found {
+        name += "-" + strings.Split(group, ".")[0] + "-" + version
+    } else {
+        name += "-" + group
+    }
+    if s, ok := v.cache[name]; ok {
+        return s, false, nil
+    }
+
+    data, err := os.ReadFile(filepath.Join(v.dir, name+".json"))
+    if err != nil {
+        return nil, false, err
+    }
+    var s map[string]any
+    if err := json.Unmarshal(data, &s); err != nil {
+        return nil, false, fmt.Errorf("%s: %w", name, err)
+    }
+    v.cache[name] = s
+    return s, false, nil
+}
+
+// Validate checks every document for unknown fields (HA701), values of
+// the wrong type (HA702) and missing required fields (HA703).
+func (v *Validator) Validate(manifests []*Manifest) *Validation {
+    out := &Validation{Findings: []types.Finding{}}
+    for _, m := range manifests {
+        if m.Kind() == "" || m.APIVersion() == "" {
+            continue
+        }
+        schema, crd, err := v.schemaFor(m)
+        if err != nil {
+            if !errors.Is(err, fs.ErrNotExist) {
+                out.Unvalidated = append(out.Unvalidated, fmt.Sprintf("%s: %v", m.ID(), err))
+            } else {
+                out.Unvalidated = append(out.Unvalidated, m.ID())
+            }
+            continue
+        }
+        sv := &schemaCheck{m: m, crd: crd}
+        sv.check(schema, m.Object, nil)
+        out.Findings = append(out.Findings, sv.out...)
+    }
+    return out
+}
+
+// schemaCheck walks one document along its schema.
+type schemaCheck struct {
+    m   *Manifest
+    crd bool
+    out []types.Finding
+}
+
+func (c *schemaCheck) add(path []string, id, title, sev, format string, args ...any) {
+    c.out = append(c.out, types.Finding{
+        RuleID:     id,
+        Title:      title,
+        Severity:   sev,
+        Message:    fmt.Sprintf(format, args...),
+        Resolution: "Fix the template so it renders the field as defined by the API, the API server rejects or drops it.",
+        Resource:   c.m.ID(),
+        Kind:       c.m.Kind(),
+        Name:       c.m.Name(),
+        Namespace:  c.m.Namespace(),
+        File:       c.m.File,
+        Line:       c.m.LineOf(path...),
+        Path:       FieldPath(path),
+    })
+}
+
+// check validates value against schema. It reports the first problem
+// found at a field and does not descend below a value of the wrong type.
+func (c *schemaCheck) check(schema map[string]any, value any, path []string) {
+    if schema == nil {
+        return
+    }
+    if !c.matches(schema, value) {
+        c.add(path, "HA702", "Invalid field type", "HIGH", "%s is %s, expected %s",
+            fieldName(path), jsonType(value), strings.Join(schemaTypes(schema), " or "))
+        return
+    }
+    for _, s := range listOf(schema["allOf"]) {
+        c.check(s, value, path)
+    }
+
+    switch val := value.(type) {
+    case map[string]any:
+        c.object(schema, val, path)
+    case []any:
+        items, _ := schema["items"].(map[string]any)
+        for i, item := range val {
+            c.check(items, item, sub(path, strconv.Itoa(i)))
+        }
+    case string:
+        if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 && !containsValue(enum, val) {
+            c.add(path, "HA702", "Invalid field value", "HIGH", "%s is %q, expected one of %s", fieldName(path), val, joinValues(enum))
+        }
+    }
+}
+
+func (c *schemaCheck) object(schema map[string]any, obj map[string]any, path []string) {
+    props, _ := schema["properties"].(map[string]any)
+    additional := schema["additionalProperties"]
+    preserve, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool)
+
+    // Structural CRD schemas prune unknown fields, built-in schemas are
+    // strict. Object metadata is never described by CRD schemas.
+    strict := additional == false || (c.crd && len(props) > 0 && additional == nil && !preserve)
+
+    for _, r := range stringList(schema["required"]) {
+        if _, ok := obj[r]; !ok {
+            c.add(path, "HA703", "Missing required field", "MEDIUM", "%s is required", fieldName(sub(path, r)))
+        }
+    }
+
+    keys := make([]string, 0, len(obj))
+    for k := range obj {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        child := sub(path, k)
+        if c.crd && len(path) == 0 && (k == "apiVersion" || k == "kind" || k == "metadata") {
+            continue
+        }
+        if ps, ok := props[k].(map[string]any); ok {
+            c.check(ps, obj[k], child)
+            continue
+        }
+        if as, ok := additional.(map[string]any); ok {
+            c.check(as, obj[k], child)
+            continue
+        }
+        if strict {
+            c.add(child, "HA701", "Unknown field", "MEDIUM", "%s is not a field of %s", fieldName(child), c.m.APIVersion()+" "+c.m.Kind())
+        }
+    }
+}
+
+// matches tells whether value has one of the types allowed by schema,
+// oneOf and anyOf branches included.
+func (c *schemaCheck) matches(schema map[string]any, value any) bool {
+    for _, key := range []string{"oneOf", "anyOf"} {
+        if branches := listOf(schema[key]); len(branches) > 0 {
+            for _, b := range branches {
+                if c.matches(b, value) {
+                    return true
+                }
+            }
+            return false
+        }
+    }
+    if b, _ := schema["x-kubernetes-int-or-string"].(bool); b || schema["format"] == "int-or-string" {
+        return value == nil || isType(value, "integer") || isType(value, "string")
+    }
+    allowed := schemaTypes(schema)
+    if len(allowed) == 0 {
+        return true
+    }
+    if value == nil {
+        // The API server treats null as an absent field, CRDs must opt in.
+        nullable, _ := schema["nullable"].(bool)
+        return nullable || contains(allowed, "null") || !c.crd
+    }
+    for _, t := range allowed {
+        if isType(value, t) {
+            return true
+        }
+    }
+    return false
+}
+
+func schemaTypes(schema map[string]any) []string {
+    switch t := schema["type"].(type) {
+    case string:
+        return []string{t}
+    case []any:
+        return stringList(t)
+    }
+    var out []string
+    for _, key := range []string{"oneOf", "anyOf"} {
+        for _, b := range listOf(schema[key]) {
+            out = append(out, schemaTypes(b)...)
+        }
+    }
+    return out
+}
+
+func isType(value any, t string) bool {
+    switch t {
+    case "object":
+        _, ok := value.(map[string]any)
+        return ok
+    case "array":
+        _, ok := value.([]any)
+        return ok
+    case "string":
+        switch value.(type) {
+        case string, time.Time:
+            return true
+        }
+    case "integer":
+        switch n := value.(type) {
+        case int, int64, uint64:
+            return true
+        case float64:
+            return n == float64(int64(n))
+        }
+    case "number":
+        switch value.(type) {
+        case int, int64, uint64, float64:
+            return true
+        }
+    case "boolean":
+        _, ok := value.(bool)
+        return ok
+    case "null":
+        return value == nil
+    }
+    return false
+}
+
+func jsonType(value any) string {
+    for _, t := range []string{"object", "array", "string", "integer", "number", "boolean"} {
+        if isType(value, t) {
+            return t
+        }
+    }
+    return "null"
+}
+
+func fieldName(path []string) string {
+    if len(path) == 0 {
+        return "the document"
+    }
+    return FieldPath(path)
+}
+
+func containsValue(list []any, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
+
+func joinValues(list []any) string {
+    parts := make([]string, len(list))
+    for i, v := range list {
+        parts[i] = fmt.Sprint(v)
+    }
+    return strings.Join(parts, ", ")
+}
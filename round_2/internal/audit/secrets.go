@@ -0,0 +1,296 @@
+package audit
+
+import (
+    "encoding/base64"
+    "fmt"
+    "io/fs"
+    "math"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "helm-auditor/internal/types"
+)
+
+// credentialPattern is a well known credential format.
+type credentialPattern struct {
+    Name     string
+    Severity string
+    Re       *regexp.Regexp
+}
+
+var credentialPatterns = []credentialPattern{
+    {"private key", "CRITICAL", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`)},
+    {"AWS access key", "HIGH", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+    {"GitHub token", "HIGH", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+    {"GitLab token", "HIGH", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+    {"Slack token", "HIGH", regexp.MustCompile(`\bxox[baprs]-[A-Za-z0-9-]{10,}\b`)},
+    {"Slack webhook", "MEDIUM", regexp.MustCompile(`https://hooks\.slack\.com/services/T[A-Za-z0-9_]+/B[A-Za-z0-9_]+/[A-Za-z0-9_]+`)},
+    {"Google API key", "HIGH", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+    {"Stripe secret key", "HIGH", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+    {"JSON web token", "MEDIUM", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+    {"URL with credentials", "HIGH", regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^/\s:@"']+:[^/\s@"']+@[^\s"']+`)},
+}
+
+// sensitiveKey matches keys and env var names holding credentials.
+var sensitiveKey = regexp.MustCompile(`(?i)(passw(or)?d|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credential|auth[_-]?key|client[_-]?secret)`)
+
+// referenceKey matches keys naming a secret rather than holding one:
+// existingSecret, useExistingSecret, passwordKey, secretName, tokenRef,
+// tokenFile...
+var referenceKey = regexp.MustCompile(`(?i)^(use[_-]?)?existing|(name|ref|keys?|file|path|mount|enabled|create|annotations?)$`)
+
+// inlineAssignment finds password=... lines in configuration files
+// embedded in ConfigMaps and values.
+var inlineAssignment = regexp.MustCompile(`(?i)\b([a-z0-9_.-]*(?:passw(?:or)?d|secret|token|api[_-]?key)[a-z0-9_.-]*)\s*[:=]\s*["']?([^\s"',;]{4,})`)
+
+// defaultPasswords are shipped as chart defaults far too often.
+var defaultPasswords = map[string]bool{
+    "admin": true, "password": true, "changeme": true, "change-me": true, "secret": true,
+    "root": true, "test": true, "default": true, "prom-operator": true, "postgres": true,
+    "mysql": true, "guest": true, "123456": true, "letmein": true, "pass": true,
+}
+
+// SecretScan is the outcome of ScanSecrets.
+type SecretScan struct {
+    Findings []types.Finding
+}
+
+// ScanSecrets looks for credentials in rendered manifests and chart
+// values files: Secret data (base64 decoded), ConfigMaps, env vars and
+// any value under a credential-like key. Values are never reported in
+// full, only redacted.
+func ScanSecrets(manifests, values []*Manifest) *SecretScan {
+    s := &SecretScan{Findings: []types.Finding{}}
+    for _, m := range manifests {
+        s.scan(m, m.Kind() == "Secret")
+    }
+    for _, v := range values {
+        s.scan(v, false)
+    }
+    return s
+}
+
+// LoadValues parses the values.yaml of a chart and of its unpacked
+// subcharts. Files are named relative to chartDir.
+func LoadValues(chartDir string) ([]*Manifest, error) {
+    var out []*Manifest
+    err := filepath.WalkDir(chartDir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() || (d.Name() != "values.yaml" && d.Name() != "values.yml") {
+            return nil
+        }
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(chartDir, path)
+        if err != nil {
+            rel = path
+        }
+        docs, err := ParseManifests(data, filepath.ToSlash(rel))
+        if err != nil {
+            return err
+        }
+        out = append(out, docs...)
+        return nil
+    })
+    if err != nil {
+        return out, fmt.Errorf("loading values from %s: %w", chartDir, err)
+    }
+    return out, nil
+}
+
+func (s *SecretScan) scan(m *Manifest, secret bool) {
+    walkScalars(m.node, nil, "", func(path []string, key string, n *yaml.Node) {
+        value := n.Value
+        decoded := false
+        if secret && len(path) == 2 && path[0] == "data" {
+            if b, err := base64.StdEncoding.DecodeString(value); err == nil {
+                value, decoded = string(b), true
+            }
+        }
+        inSecret := secret && len(path) == 2 && (path[0] == "data" || path[0] == "stringData")
+        s.check(m, path, key, value, n.Line, inSecret, decoded)
+    })
+}
+
+// check applies the detectors to one scalar value.
+func (s *SecretScan) check(m *Manifest, path []string, key, value string, line int, inSecret, decoded bool) {
+    if value == "" || strings.Contains(value, "{{") {
+        return
+    }
+    where := "value"
+    if decoded {
+        where = "decoded value"
+    }
+
+    for _, p := range credentialPatterns {
+        if match := p.Re.FindString(value); match != "" {
+            s.add(m, path, line, "HA401", "Credential in manifest", p.Severity,
+                fmt.Sprintf("%s found in %s of %s", p.Name, where, describeKey(path, key)), redact(match))
+            return
+        }
+    }
+
+    sensitive := sensitiveKey.MatchString(key) && !referenceKey.MatchString(key)
+    if sensitive || inSecret {
+        if defaultPasswords[strings.ToLower(strings.TrimSpace(value))] {
+            s.add(m, path, line, "HA403", "Default credential", "HIGH",
+                fmt.Sprintf("%s is set to a well known default", describeKey(path, key)), redact(value))
+            return
+        }
+    }
+    // Random looking Secret values are credentials whatever their key,
+    // tokens and keys in a Secret rarely sit under a credential name.
+    if inSecret && isHighEntropy(value) {
+        s.add(m, path, line, "HA404", "High entropy secret value", "MEDIUM",
+            fmt.Sprintf("%s of %s looks like a random credential", where, describeKey(path, key)), redact(value))
+        return
+    }
+    // Other Secret values may be generated by the chart, only hard coded
+    // ones under a credential key outside Secrets are flagged.
+    if sensitive && !inSecret && !strings.ContainsAny(value, " \n") && !isBoolOrNumber(value) {
+        sev := "MEDIUM"
+        if len(value) >= 16 && entropy(value) >= 3.5 {
+            sev = "HIGH"
+        }
+        s.add(m, path, line, "HA402", "Hard coded secret", sev,
+            fmt.Sprintf("%s holds a literal credential", describeKey(path, key)), redact(value))
+        return
+    }
+
+    if strings.Contains(value, "\n") {
+        for i, l := range strings.Split(value, "\n") {
+            sub := inlineAssignment.FindStringSubmatch(l)
+            if sub == nil || strings.Contains(sub[2], "${") || referenceKey.MatchString(sub[1]) {
+                continue
+            }
+            sev := "MEDIUM"
+            if defaultPasswords[strings.ToLower(sub[2])] {
+                sev = "HIGH"
+            }
+            s.add(m, path, line+i+1, "HA402", "Hard coded secret", sev,
+                fmt.Sprintf("%s sets %s inline", describeKey(path, key), sub[1]), redact(sub[2]))
+        }
+    }
+}
+
+func (s *SecretScan) add(m *Manifest, path []string, line int, id, title, sev, msg, snippet string) {
+    resource := m.ID()
+    if m.Kind() == "" {
+        resource = m.File // values.yaml
+    }
+    s.Findings = append(s.Findings, types.Finding{
+        RuleID:     id,
+        Title:      title,
+        Severity:   sev,
+        Message:    msg,
+        Resolution: "Reference an existing Secret or an external secret store instead of embedding the value.",
+        Resource:   resource,
+        Kind:       m.Kind(),
+        Name:       m.Name(),
+        Namespace:  m.Namespace(),
+        File:       m.File,
+        Line:       line,
+        Path:       FieldPath(path),
+        Snippet:    snippet,
+    })
+}
+
+// walkScalars calls fn for every string scalar under n with its path and
+// the key naming it. In lists of {name, value} pairs, such as env vars,
+// the name is used as the key of the value.
+func walkScalars(n *yaml.Node, path []string, key string, fn func(path []string, key string, n *yaml.Node)) {
+    if n == nil {
+        return
+    }
+    switch n.Kind {
+    case yaml.MappingNode:
+        nameKey := ""
+        for i := 0; i+1 < len(n.Content); i += 2 {
+            if n.Content[i].Value == "name" && n.Content[i+1].Kind == yaml.ScalarNode {
+                nameKey = n.Content[i+1].Value
+            }
+        }
+        for i := 0; i+1 < len(n.Content); i += 2 {
+            k := n.Content[i].Value
+            childKey := k
+            if k == "value" && nameKey != "" {
+                childKey = nameKey
+            }
+            walkScalars(n.Content[i+1], sub(path, k), childKey, fn)
+        }
+    case yaml.SequenceNode:
+        for i, c := range n.Content {
+            walkScalars(c, sub(path, strconv.Itoa(i)), key, fn)
+        }
+    case yaml.ScalarNode:
+        if n.Tag == "!!str" || n.Tag == "" {
+            fn(path, key, n)
+        }
+    }
+}
+
+func describeKey(path []string, key string) string {
+    if p := FieldPath(path); p != "" {
+        if key != "" && !strings.HasSuffix(p, key) {
+            return fmt.Sprintf("%s (%s)", p, key)
+        }
+        return p
+    }
+    return key
+}
+
+// redact keeps enough of a value to recognise it.
+func redact(s string) string {
+    if strings.HasPrefix(s, "-----BEGIN") {
+        if i := strings.Index(s[5:], "-----"); i >= 0 {
+            return s[:i+10] + "..."
+        }
+    }
+    r := []rune(s)
+    switch {
+    case len(r) <= 4:
+        return "****"
+    case len(r) <= 12:
+        return string(r[:2]) + strings.Repeat("*", len(r)-2)
+    default:
+        return string(r[:4]) + strings.Repeat("*", 8) + fmt.Sprintf(" (%d chars)", len(r))
+    }
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+    counts := map[rune]int{}
+    for _, r := range s {
+        counts[r]++
+    }
+    n := float64(len([]rune(s)))
+    var h float64
+    for _, c := range counts {
+        p := float64(c) / n
+        h -= p * math.Log2(p)
+    }
+    return h
+}
+
+// isHighEntropy reports single token values random enough to be keys
+// or tokens rather than words or identifiers.
+func isHighEntropy(s string) bool {
+    return len(s) >= 16 && !strings.ContainsAny(s, " \t\n") && entropy(s) >= 3.5
+}
+
+func isBoolOrNumber(s string) bool {
+    if _, err := strconv.ParseFloat(s, 64); err == nil {
+        return true
+    }
+    _, err := strconv.ParseBool(s)
+    return err == nil
+}
@@ -0,0 +1,54 @@
+package audit
+
+// matchLabelSelector evaluates a metav1.LabelSelector (matchLabels and
+// matchExpressions) against labels. An empty selector matches everything.
+func matchLabelSelector(sel map[string]any, labels map[string]string) bool {
+    for k, v := range stringMap(sel["matchLabels"]) {
+        if labels[k] != v {
+            return false
+        }
+    }
+
+    exprs, _ := sel["matchExpressions"].([]any)
+    for _, e := range exprs {
+        em, _ := e.(map[string]any)
+        key := str(em, "key")
+        values := stringList(em["values"])
+        val, has := labels[key]
+        switch str(em, "operator") {
+        case "In":
+            if !has || !contains(values, val) {
+                return false
+            }
+        case "NotIn":
+            if has && contains(values, val) {
+                return false
+            }
+        case "Exists":
+            if !has {
+                return false
+            }
+        case "DoesNotExist":
+            if has {
+                return false
+            }
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+// matchMapSelector evaluates a plain selector such as a Service's. An
+// empty selector matches nothing: such Services have manual endpoints.
+func matchMapSelector(sel map[string]string, labels map[string]string) bool {
+    if len(sel) == 0 {
+        return false
+    }
+    for k, v := range sel {
+        if labels[k] != v {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+    "strconv"
+)
+
+// podSpecPaths locates the pod spec inside each workload kind.
+var podSpecPaths = map[string][]string{
+    "Pod":                   {"spec"},
+    "Deployment":            {"spec", "template", "spec"},
+    "StatefulSet":           {"spec", "template", "spec"},
+    "DaemonSet":             {"spec", "template", "spec"},
+    "ReplicaSet":            {"spec", "template", "spec"},
+    "ReplicationController": {"spec", "template", "spec"},
+    "Job":                   {"spec", "template", "spec"},
+    "CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerFields are the pod spec lists holding containers.
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Workload is a rendered resource that runs containers.
+type Workload struct {
+    *Manifest
+    SpecPath   []string // path to the pod spec
+    Containers []Container
+}
+
+// Container is one container of a workload pod spec.
+type Container struct {
+    Name  string
+    Image string
+    Field string   // containers, initContainers or ephemeralContainers
+    Path  []string // path to the container in the manifest
+    Spec  map[string]any
+}
+
+// PodSpec returns the pod spec of the workload.
+func (w *Workload) PodSpec() map[string]any {
+    spec, _ := get(w.Object, w.SpecPath...).(map[string]any)
+    return spec
+}
+
+// PodLabels returns the labels pods created by the workload carry.
+func (w *Workload) PodLabels() map[string]string {
+    var meta []string
+    if w.Kind() == "Pod" {
+        meta = []string{"metadata", "labels"}
+    } else {
+        meta = append(append([]string{}, w.SpecPath[:len(w.SpecPath)-1]...), "metadata", "labels")
+    }
+    return stringMap(get(w.Object, meta...))
+}
+
+// Workloads returns the manifests that run containers.
+func Workloads(manifests []*Manifest) []*Workload {
+    var out []*Workload
+    for _, m := range manifests {
+        path, ok := podSpecPaths[m.Kind()]
+        if !ok {
+            continue
+        }
+        spec, ok := get(m.Object, path...).(map[string]any)
+        if !ok {
+            continue
+        }
+
+        w := &Workload{Manifest: m, SpecPath: path}
+        for _, field := range containerFields {
+            list, _ := spec[field].([]any)
+            for i, c := range list {
+                cm, ok := c.(map[string]any)
+                if !ok {
+                    continue
+                }
+                name, _ := cm["name"].(string)
+                image, _ := cm["image"].(string)
+                cpath := append(append([]string{}, path...), field, strconv.Itoa(i))
+                w.Containers = append(w.Containers, Container{
+                    Name:  name,
+                    Image: image,
+                    Field: field,
+                    Path:  cpath,
+                    Spec:  cm,
+                })
+            }
+        }
+        out = append(out, w)
+    }
+    return out
+}
+
+// ImageUsers maps every image to the workloads referencing it.
+func ImageUsers(workloads []*Workload) map[string][]*Workload {
+    users := map[string][]*Workload{}
+    for _, w := range workloads {
+        seen := map[string]bool{}
+        for _, c := range w.Containers {
+            if c.Image == "" || seen[c.Image] {
+                continue
+            }
+            seen[c.Image] = true
+            users[c.Image] = append(users[c.Image], w)
+        }
+    }
+    return users
+}
+
+func stringMap(v any) map[string]string {
+    m, _ := v.(map[string]any)
+    out := map[string]string{}
+    for k, val := range m {
+        if s, ok := val.(string); ok {
+            out[k] = s
+        }
+    }
+    return out
+}
@@ -0,0 +1,221 @@
+// Package cache keeps the scan results of images on the reports volume,
+// keyed by manifest digest, so unchanged images are not scanned again.
+package cache
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/google/go-containerregistry/pkg/authn"
+    "github.com/google/go-containerregistry/pkg/name"
+    "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Scan outcomes of an image.
+const (
+    Hit      = "hit"      // SBOM and vulnerabilities reused
+    Rescan   = "rescan"   // SBOM reused, matched again against a newer DB
+    Miss     = "miss"     // scanned
+    Uncached = "uncached" // digest unknown, scanned
+)
+
+// DefaultProvenanceTTL is how long verified signatures are reused,
+// signatures and attestations can be attached to a digest at any time.
+const DefaultProvenanceTTL = 24 * time.Hour
+
+// Entry describes what is cached for a digest.
+type Entry struct {
+    Digest      string    `json:"digest"`
+    Image       string    `json:"image"` // reference it was last resolved from
+    SBOM        time.Time `json:"sbom,omitzero"`
+    Scanned     time.Time `json:"scanned,omitzero"`
+    DBUpdated   time.Time `json:"db_updated,omitzero"` // trivy DB of the last match
+    Provenanced time.Time `json:"provenanced,omitzero"`
+}
+
+// Paths are the cached files of a digest, named like the per image
+// reports.
+type Paths struct {
+    SBOM       string
+    Vulns      string
+    Provenance string // provenor output folder
+    entry      string
+}
+
+// Cache is a directory of entries, one per digest, plus the trivy cache
+// (vulnerability DB and layer analysis) under trivy/.
+type Cache struct {
+    dir string
+}
+
+// New uses dir, created if needed.
+func New(dir string) (*Cache, error) {
+    if err := os.MkdirAll(filepath.Join(dir, "images"), 0755); err != nil {
+        return nil, fmt.Errorf("creating scan cache: %w", err)
+    }
+    return &Cache{dir: dir}, nil
+}
+
+// TrivyDir holds the trivy vulnerability DB, under db/.
+func (c *Cache) TrivyDir() string {
+    return filepath.Join(c.dir, "trivy")
+}
+
+// JobsDir holds the cache dirs of the trivy jobs of a run.
+func (c *Cache) JobsDir() string {
+    return filepath.Join(c.dir, "trivy", "jobs")
+}
+
+// JobDir is the --cache-dir of the trivy job name. trivy locks its
+// cache for the length of a scan, so jobs running side by side get their
+// own, with a copy of the shared DB.
+func (c *Cache) JobDir(name string) string {
+    return filepath.Join(c.JobsDir(), name)
+}
+
+// PathsFor returns where the results of digest are cached.
+func (c *Cache) PathsFor(digest string) Paths {
+    algo, hex, _ := strings.Cut(digest, ":")
+    base := filepath.Join(c.dir, "images", algo, hex)
+    return Paths{
+        SBOM:       filepath.Join(base, "sbom.cdx.json"),
+        Vulns:      filepath.Join(base, "vulns.json"),
+        Provenance: filepath.Join(base, "prov"),
+        entry:      filepath.Join(base, "entry.json"),
+    }
+}
+
+// Load returns the entry of digest. Files gone from the cache are
+// forgotten, a missing entry is empty.
+func (c *Cache) Load(digest string) *Entry {
+    p := c.PathsFor(digest)
+    e := &Entry{Digest: digest}
+    if data, err := os.ReadFile(p.entry); err == nil {
+        if json.Unmarshal(data, e) != nil {
+            e = &Entry{Digest: digest}
+        }
+    }
+    if !exists(p.SBOM) {
+        e.SBOM, e.Scanned, e.DBUpdated = time.Time{}, time.Time{}, time.Time{}
+    }
+    if !exists(p.Vulns) {
+        e.Scanned, e.DBUpdated = time.Time{}, time.Time{}
+    }
+    if !exists(filepath.Join(p.Provenance, "provenance.json")) {
+        e.Provenanced = time.Time{}
+    }
+    return e
+}
+
+// Save writes the entry.
+func (c *Cache) Save(e *Entry) error {
+    p := c.PathsFor(e.Digest)
+    if err := os.MkdirAll(filepath.Dir(p.entry), 0755); err != nil {
+        return err
+    }
+    data, _ := json.MarshalIndent(e, "", "  ")
+    return os.WriteFile(p.entry, data, 0644)
+}
+
+// Plan tells how to scan the entry against the trivy DB updated at
+// dbUpdated. An unknown DB time always matches again.
+func (e *Entry) Plan(dbUpdated time.Time) string {
+    switch {
+    case e.SBOM.IsZero():
+        return Miss
+    case e.Scanned.IsZero() || dbUpdated.IsZero() || dbUpdated.After(e.DBUpdated):
+        return Rescan
+    }
+    return Hit
+}
+
+// ProvenanceFresh reports cached provenance younger than ttl.
+func (e *Entry) ProvenanceFresh(ttl time.Duration, now time.Time) bool {
+    return !e.Provenanced.IsZero() && now.Sub(e.Provenanced) < ttl
+}
+
+// Resolve returns the manifest digest image points to, the index digest
+// for multi platform images.
+func Resolve(ctx context.Context, image string) (string, error) {
+    ref, err := name.ParseReference(image)
+    if err != nil {
+        return "", err
+    }
+    if d, ok := ref.(name.Digest); ok {
+        return d.DigestStr(), nil
+    }
+    desc, err := remote.Head(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain))
+    if err != nil {
+        return "", fmt.Errorf("resolving digest of %s: %w", image, err)
+    }
+    return desc.Digest.String(), nil
+}
+
+// DBUpdated reads when the trivy vulnerability DB under trivyDir was
+// built, from db/metadata.json.
+func DBUpdated(trivyDir string) (time.Time, error) {
+    data, err := os.ReadFile(filepath.Join(trivyDir, "db", "metadata.json"))
+    if err != nil {
+        return time.Time{}, err
+    }
+    var meta struct {
+        UpdatedAt time.Time `json:"UpdatedAt"`
+    }
+    if err := json.Unmarshal(data, &meta); err != nil {
+        return time.Time{}, fmt.Errorf("parsing trivy DB metadata: %w", err)
+    }
+    return meta.UpdatedAt, nil
+}
+
+// Copy copies the file or directory src to dst.
+func Copy(src, dst string) error {
+    info, err := os.Stat(src)
+    if err != nil {
+        return err
+    }
+    if !info.IsDir() {
+        return copyFile(src, dst)
+    }
+    return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        rel, _ := filepath.Rel(src, path)
+        target := filepath.Join(dst, rel)
+        if info.IsDir() {
+            return os.MkdirAll(target, 0755)
+        }
+        return copyFile(path, target)
+    })
+}
+
+func copyFile(src, dst string) error {
+    in, err := os.Open(src)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+    if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+        return err
+    }
+    out, err := os.Create(dst)
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(out, in); err != nil {
+        out.Close()
+        return err
+    }
+    return out.Close()
+}
+
+func exists(path string) bool {
+    _, err := os.Stat(path)
+    return err == nil
+}
@@ -0,0 +1,454 @@
+// Package diff compares two audits of a chart, typically two versions of
+// it, and reports what changed security wise.
+package diff
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/google/go-containerregistry/pkg/name"
+
+    "helm-auditor/internal/policy"
+    "helm-auditor/internal/reports"
+    "helm-auditor/internal/types"
+)
+
+// Audit names one side of the comparison.
+type Audit struct {
+    Chart   string `json:"chart"`
+    Version string `json:"version"`
+}
+
+// Image is an image deployed by only one of the audits.
+type Image struct {
+    Name   string `json:"name"`
+    Digest string `json:"digest,omitempty"`
+    Signed bool   `json:"signed"`
+}
+
+// ImageChange is an image of both audits whose tag or digest changed.
+type ImageChange struct {
+    Repository string `json:"repository"`
+    From       string `json:"from"`
+    To         string `json:"to"`
+    FromDigest string `json:"from_digest,omitempty"`
+    ToDigest   string `json:"to_digest,omitempty"`
+}
+
+// SameTag reports a digest change behind an unchanged reference, the
+// image was rebuilt or retagged.
+func (c ImageChange) SameTag() bool {
+    return c.From == c.To
+}
+
+// CVE is a vulnerability that appeared or went away, with the images
+// (repositories) concerned.
+type CVE struct {
+    ID               string   `json:"id"`
+    Package          string   `json:"package"`
+    Severity         string   `json:"severity"`
+    InstalledVersion string   `json:"installed_version,omitempty"`
+    FixedVersion     string   `json:"fixed_version,omitempty"`
+    Images           []string `json:"images"`
+}
+
+// RBACChange lists the grants a workload gained or lost in a scope, as
+// "verb resource.group" like kubectl auth can-i.
+type RBACChange struct {
+    Workload string   `json:"workload"`
+    Scope    string   `json:"scope"` // namespace, or "cluster"
+    Added    []string `json:"added,omitempty"`
+    Removed  []string `json:"removed,omitempty"`
+}
+
+// Signature is the signature status of an image.
+type Signature struct {
+    Signed   bool     `json:"signed"`
+    SignedBy []string `json:"signed_by,omitempty"`
+    Signers  []string `json:"signers,omitempty"` // certificate SANs
+    SLSA     int      `json:"slsa,omitempty"`
+}
+
+func (s Signature) String() string {
+    if !s.Signed {
+        return "unsigned"
+    }
+    out := "signed"
+    if len(s.SignedBy) > 0 {
+        out += " (" + strings.Join(s.SignedBy, ", ") + ")"
+    }
+    if len(s.Signers) > 0 {
+        out += " by " + strings.Join(s.Signers, ", ")
+    }
+    if s.SLSA > 0 {
+        out += fmt.Sprintf(", SLSA %d", s.SLSA)
+    }
+    return out
+}
+
+// SignatureChange is an image of both audits whose signature status
+// changed.
+type SignatureChange struct {
+    Repository string    `json:"repository"`
+    From       Signature `json:"from"`
+    To         Signature `json:"to"`
+}
+
+// Lost reports a signature, signing scheme or signer that went away.
+func (c SignatureChange) Lost() bool {
+    return (c.From.Signed && !c.To.Signed) ||
+        len(missing(c.From.SignedBy, c.To.SignedBy)) > 0 ||
+        c.To.SLSA < c.From.SLSA
+}
+
+// Report is the outcome of Compare, written as audit-diff.json.
+type Report struct {
+    From Audit `json:"from"`
+    To   Audit `json:"to"`
+
+    AddedImages   []Image       `json:"added_images,omitempty"`
+    RemovedImages []Image       `json:"removed_images,omitempty"`
+    ChangedImages []ImageChange `json:"changed_images,omitempty"`
+
+    // CVEs of the images added count as new, of the images removed as
+    // fixed
+    NewCVEs   []CVE `json:"new_cves,omitempty"`
+    FixedCVEs []CVE `json:"fixed_cves,omitempty"`
+
+    // Trivy config checks
+    NewMisconfigurations      []reports.Misconfiguration `json:"new_misconfigurations,omitempty"`
+    ResolvedMisconfigurations []reports.Misconfiguration `json:"resolved_misconfigurations,omitempty"`
+
+    // Native manifest findings
+    NewFindings      []types.Finding `json:"new_findings,omitempty"`
+    ResolvedFindings []types.Finding `json:"resolved_findings,omitempty"`
+
+    RBAC       []RBACChange      `json:"rbac,omitempty"`
+    Signatures []SignatureChange `json:"signatures,omitempty"`
+}
+
+// Empty reports two audits without security relevant differences.
+func (r *Report) Empty() bool {
+    return len(r.AddedImages)+len(r.RemovedImages)+len(r.ChangedImages)+
+        len(r.NewCVEs)+len(r.FixedCVEs)+
+        len(r.NewMisconfigurations)+len(r.ResolvedMisconfigurations)+
+        len(r.NewFindings)+len(r.ResolvedFindings)+
+        len(r.RBAC)+len(r.Signatures) == 0
+}
+
+// Compare reports what changed from the audit old to cur. Images are
+// matched by repository so version bumps show as changes, not as an
+// image removed and another added.
+func Compare(old, cur *reports.ExtendedAudit) *Report {
+    r := &Report{
+        From: Audit{Chart: old.Chart.Name, Version: old.Chart.Version},
+        To:   Audit{Chart: cur.Chart.Name, Version: cur.Chart.Version},
+    }
+    r.images(old, cur)
+    r.misconfigurations(old.Misconfigurations, cur.Misconfigurations)
+    r.findings(manifests(old), manifests(cur))
+    r.rbac(manifests(old), manifests(cur))
+    return r
+}
+
+func manifests(a *reports.ExtendedAudit) *reports.ManifestAudit {
+    if a.Manifests == nil {
+        return &reports.ManifestAudit{}
+    }
+    return a.Manifests
+}
+
+func byRepository(a *reports.ExtendedAudit) (map[string]reports.ImageSummary, []string) {
+    idx := map[string]reports.ImageSummary{}
+    var repos []string
+    for _, img := range a.ImagesSummary.Images {
+        repo := Repository(img.Name)
+        if _, ok := idx[repo]; !ok {
+            repos = append(repos, repo)
+        }
+        idx[repo] = img
+    }
+    sort.Strings(repos)
+    return idx, repos
+}
+
+func (r *Report) images(old, cur *reports.ExtendedAudit) {
+    before, oldRepos := byRepository(old)
+    after, curRepos := byRepository(cur)
+    fixed := cveSet{}
+    found := cveSet{}
+
+    for _, repo := range curRepos {
+        img := after[repo]
+        prev, ok := before[repo]
+        if !ok {
+            r.AddedImages = append(r.AddedImages, Image{Name: img.Name, Digest: img.Digest, Signed: img.Signed})
+            found.add(repo, img.CVEs, nil)
+            continue
+        }
+        if prev.Name != img.Name || (prev.Digest != "" && img.Digest != "" && prev.Digest != img.Digest) {
+            r.ChangedImages = append(r.ChangedImages, ImageChange{
+                Repository: repo,
+                From:       prev.Name,
+                To:         img.Name,
+                FromDigest: prev.Digest,
+                ToDigest:   img.Digest,
+            })
+        }
+        found.add(repo, img.CVEs, prev.CVEs)
+        fixed.add(repo, prev.CVEs, img.CVEs)
+
+        from, to := signature(prev), signature(img)
+        if from.String() != to.String() {
+            r.Signatures = append(r.Signatures, SignatureChange{Repository: repo, From: from, To: to})
+        }
+    }
+    for _, repo := range oldRepos {
+        if _, ok := after[repo]; ok {
+            continue
+        }
+        img := before[repo]
+        r.RemovedImages = append(r.RemovedImages, Image{Name: img.Name, Digest: img.Digest, Signed: img.Signed})
+        fixed.add(repo, img.CVEs, nil)
+    }
+    r.NewCVEs = found.list()
+    r.FixedCVEs = fixed.list()
+}
+
+func signature(img reports.ImageSummary) Signature {
+    s := Signature{Signed: img.Signed, SignedBy: sorted(img.SignedBy)}
+    seen := map[string]bool{}
+    for _, signer := range img.Signers {
+        if signer.SubjectAlternativeName != "" && !seen[signer.SubjectAlternativeName] {
+            seen[signer.SubjectAlternativeName] = true
+            s.Signers = append(s.Signers, signer.SubjectAlternativeName)
+        }
+    }
+    sort.Strings(s.Signers)
+    if img.SLSA != nil {
+        s.SLSA = img.SLSA.Level
+    }
+    return s
+}
+
+// cveSet groups CVEs by ID and package across images.
+type cveSet map[string]*CVE
+
+// add records the CVEs of image repo in vulns and not in except.
+func (s cveSet) add(repo string, vulns, except []types.Vulnerability) {
+    skip := map[string]bool{}
+    for _, v := range except {
+        skip[CVEKey(v)] = true
+    }
+    for _, v := range vulns {
+        key := CVEKey(v)
+        if skip[key] {
+            continue
+        }
+        c, ok := s[key]
+        if !ok {
+            c = &CVE{
+                ID:               v.ID,
+                Package:          v.Package,
+                Severity:         strings.ToUpper(v.Severity),
+                InstalledVersion: v.InstalledVersion,
+                FixedVersion:     v.FixedVersion,
+            }
+            s[key] = c
+        }
+        if len(c.Images) == 0 || c.Images[len(c.Images)-1] != repo {
+            c.Images = append(c.Images, repo)
+        }
+    }
+}
+
+// list sorts the CVEs by severity, then by ID.
+func (s cveSet) list() []CVE {
+    out := make([]CVE, 0, len(s))
+    for _, c := range s {
+        out = append(out, *c)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if a, b := severityRank(out[i].Severity), severityRank(out[j].Severity); a != b {
+            return a < b
+        }
+        if out[i].ID != out[j].ID {
+            return out[i].ID < out[j].ID
+        }
+        return out[i].Package < out[j].Package
+    })
+    if len(out) == 0 {
+        return nil
+    }
+    return out
+}
+
+func (r *Report) misconfigurations(old, cur []reports.Misconfiguration) {
+    r.NewMisconfigurations = subtract(cur, old, MisconfigurationKey)
+    r.ResolvedMisconfigurations = subtract(old, cur, MisconfigurationKey)
+    bySeverity := func(ms []reports.Misconfiguration) {
+        sort.SliceStable(ms, func(i, j int) bool {
+            return severityRank(ms[i].Severity) < severityRank(ms[j].Severity)
+        })
+    }
+    bySeverity(r.NewMisconfigurations)
+    bySeverity(r.ResolvedMisconfigurations)
+}
+
+func (r *Report) findings(old, cur *reports.ManifestAudit) {
+    r.NewFindings = subtract(cur.Findings, old.Findings, FindingKey)
+    r.ResolvedFindings = subtract(old.Findings, cur.Findings, FindingKey)
+    bySeverity := func(fs []types.Finding) {
+        sort.SliceStable(fs, func(i, j int) bool {
+            return severityRank(fs[i].Severity) < severityRank(fs[j].Severity)
+        })
+    }
+    bySeverity(r.NewFindings)
+    bySeverity(r.ResolvedFindings)
+}
+
+// CVEKey identifies a vulnerability within an image.
+func CVEKey(v types.Vulnerability) string {
+    return v.ID + "\x00" + v.Package
+}
+
+// MisconfigurationKey identifies a failed Trivy check across audits.
+func MisconfigurationKey(m reports.Misconfiguration) string {
+    return m.ID + "\x00" + m.Resource
+}
+
+// FindingKey identifies a native finding across audits. Lines move
+// between chart versions, the field does not.
+func FindingKey(f types.Finding) string {
+    return strings.Join([]string{f.RuleID, f.Resource, f.Container, f.Path}, "\x00")
+}
+
+// subtract returns the items of a whose key is not in b.
+func subtract[T any](a, b []T, key func(T) string) []T {
+    in := map[string]bool{}
+    for _, x := range b {
+        in[key(x)] = true
+    }
+    var out []T
+    for _, x := range a {
+        if !in[key(x)] {
+            out = append(out, x)
+        }
+    }
+    return out
+}
+
+func (r *Report) rbac(old, cur *reports.ManifestAudit) {
+    before, after := grants(old.RBAC), grants(cur.RBAC)
+    keys := map[string]bool{}
+    for k := range before {
+        keys[k] = true
+    }
+    for k := range after {
+        keys[k] = true
+    }
+    sortedKeys := make([]string, 0, len(keys))
+    for k := range keys {
+        sortedKeys = append(sortedKeys, k)
+    }
+    sort.Strings(sortedKeys)
+
+    for _, k := range sortedKeys {
+        workload, scope, _ := strings.Cut(k, "\x00")
+        c := RBACChange{
+            Workload: workload,
+            Scope:    scope,
+            Added:    missing(after[k], before[k]),
+            Removed:  missing(before[k], after[k]),
+        }
+        if len(c.Added) > 0 || len(c.Removed) > 0 {
+            r.RBAC = append(r.RBAC, c)
+        }
+    }
+}
+
+// grants expands the permissions of every workload into single grants,
+// keyed by workload and scope, so splitting or renaming roles across
+// versions is not a change.
+func grants(perms []types.WorkloadPermissions) map[string][]string {
+    out := map[string][]string{}
+    for _, w := range perms {
+        seen := map[string]bool{}
+        for _, p := range w.Permissions {
+            k := w.Workload + "\x00" + p.Scope
+            for _, g := range expand(p) {
+                if !seen[k+g] {
+                    seen[k+g] = true
+                    out[k] = append(out[k], g)
+                }
+            }
+        }
+    }
+    for k := range out {
+        sort.Strings(out[k])
+    }
+    return out
+}
+
+func expand(p types.Permission) []string {
+    if p.External {
+        // A role the chart does not render, only the binding is known.
+        return []string{"bind " + p.Role}
+    }
+    var out []string
+    for _, verb := range p.Verbs {
+        for _, url := range p.NonResourceURLs {
+            out = append(out, verb+" "+url)
+        }
+        groups := p.APIGroups
+        if len(groups) == 0 {
+            groups = []string{""}
+        }
+        for _, group := range groups {
+            for _, res := range p.Resources {
+                if group != "" {
+                    res += "." + group
+                }
+                if len(p.ResourceNames) == 0 {
+                    out = append(out, verb+" "+res)
+                    continue
+                }
+                for _, n := range p.ResourceNames {
+                    out = append(out, verb+" "+res+"/"+n)
+                }
+            }
+        }
+    }
+    return out
+}
+
+// missing returns the items of a not in b.
+func missing(a, b []string) []string {
+    return subtract(a, b, func(s string) string { return s })
+}
+
+func sorted(list []string) []string {
+    out := append([]string(nil), list...)
+    sort.Strings(out)
+    return out
+}
+
+func severityRank(s string) int {
+    for i, sev := range policy.Severities {
+        if strings.EqualFold(s, sev) {
+            return i
+        }
+    }
+    return len(policy.Severities)
+}
+
+// Repository strips the tag and digest so images match across version
+// bumps.
+func Repository(image string) string {
+    ref, err := name.ParseReference(image)
+    if err != nil {
+        return image
+    }
+    return ref.Context().Name()
+}
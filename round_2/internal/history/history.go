@@ -0,0 +1,432 @@
+// Package history keeps every audit of a chart in an embedded bbolt
+// database so findings can be followed across runs: new, existing or
+// resolved since the last audit, counts over time and time to fix.
+package history
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    bolt "go.etcd.io/bbolt"
+
+    "helm-auditor/internal/diff"
+    "helm-auditor/internal/reports"
+    "helm-auditor/internal/types"
+)
+
+// DefaultVariant names the audits of a chart rendered with its default
+// values.
+const DefaultVariant = "default"
+
+var (
+    auditsBucket   = []byte("audits")
+    versionsBucket = []byte("versions")
+)
+
+// Issue is a CVE, misconfiguration or finding recorded in an audit.
+type Issue struct {
+    Key       string    `json:"key"`
+    Kind      string    `json:"kind"` // cve, misconfiguration or finding
+    ID        string    `json:"id"`
+    Severity  string    `json:"severity"`
+    Target    string    `json:"target"` // image repository or resource
+    FirstSeen time.Time `json:"first_seen"`
+}
+
+// Record is one audit of a chart, stored under
+// audits/<chart>/<variant>/<timestamp> and indexed under
+// versions/<chart>/<variant>/<version>/<timestamp>.
+type Record struct {
+    Chart   string    `json:"chart"`
+    Version string    `json:"version"`
+    Variant string    `json:"variant"`
+    Time    time.Time `json:"time"`
+    Issues  []Issue   `json:"issues"`
+}
+
+// Point sums the record up for trends.
+func (r *Record) Point() types.TrendPoint {
+    p := types.TrendPoint{Time: r.Time, Version: r.Version, Vulns: map[string]int{}}
+    for _, i := range r.Issues {
+        switch i.Kind {
+        case "cve":
+            p.Vulns[i.Severity]++
+        case "misconfiguration":
+            p.Misconfigurations++
+        case "finding":
+            p.Findings++
+        }
+    }
+    return p
+}
+
+// Store is the history database.
+type Store struct {
+    db *bolt.DB
+}
+
+// Open opens or creates the database at path. bbolt locks the file, a
+// second process waits up to timeout for it.
+func Open(path string, timeout time.Duration) (*Store, error) {
+    db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: timeout})
+    if err != nil {
+        return nil, fmt.Errorf("opening history %s: %w", path, err)
+    }
+    if err := db.Update(reindex); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("indexing history %s: %w", path, err)
+    }
+    return &Store{db: db}, nil
+}
+
+// reindex builds the version index of a database written before it
+// existed.
+func reindex(tx *bolt.Tx) error {
+    audits := tx.Bucket(auditsBucket)
+    if audits == nil || tx.Bucket(versionsBucket) != nil {
+        return nil
+    }
+    return audits.ForEach(func(chart, _ []byte) error {
+        return audits.Bucket(chart).ForEach(func(variant, _ []byte) error {
+            return audits.Bucket(chart).Bucket(variant).ForEach(func(k, v []byte) error {
+                var r Record
+                if err := json.Unmarshal(v, &r); err != nil {
+                    return fmt.Errorf("history record of %s: %w", chart, err)
+                }
+                idx, err := bucket(tx, true, versionsBucket, chart, variant, []byte(r.Version))
+                if err != nil {
+                    return err
+                }
+                return idx.Put(k, nil)
+            })
+        })
+    })
+}
+
+// Close releases the database.
+func (s *Store) Close() error {
+    return s.db.Close()
+}
+
+func timeKey(t time.Time) []byte {
+    k := make([]byte, 8)
+    binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+    return k
+}
+
+// bucket returns the nested bucket at path, such as audits, chart and
+// variant, nil if nothing was stored there yet and create is false.
+func bucket(tx *bolt.Tx, create bool, path ...[]byte) (*bolt.Bucket, error) {
+    var b *bolt.Bucket
+    for i, name := range path {
+        var err error
+        switch {
+        case i == 0 && create:
+            b, err = tx.CreateBucketIfNotExists(name)
+        case i == 0:
+            b = tx.Bucket(name)
+        case create:
+            b, err = b.CreateBucketIfNotExists(name)
+        default:
+            b = b.Bucket(name)
+        }
+        if b == nil || err != nil {
+            return nil, err
+        }
+    }
+    return b, nil
+}
+
+// Put stores an audit.
+func (s *Store) Put(r *Record) error {
+    data, err := json.Marshal(r)
+    if err != nil {
+        return err
+    }
+    return s.db.Update(func(tx *bolt.Tx) error {
+        b, err := bucket(tx, true, auditsBucket, []byte(r.Chart), []byte(r.Variant))
+        if err != nil {
+            return err
+        }
+        if err := b.Put(timeKey(r.Time), data); err != nil {
+            return err
+        }
+        idx, err := bucket(tx, true, versionsBucket, []byte(r.Chart), []byte(r.Variant), []byte(r.Version))
+        if err != nil {
+            return err
+        }
+        return idx.Put(timeKey(r.Time), nil)
+    })
+}
+
+// Last returns the latest audit of chart and variant, nil if there is
+// none.
+func (s *Store) Last(chart, variant string) (*Record, error) {
+    var r *Record
+    err := s.db.View(func(tx *bolt.Tx) error {
+        b, err := bucket(tx, false, auditsBucket, []byte(chart), []byte(variant))
+        if b == nil || err != nil {
+            return err
+        }
+        _, v := b.Cursor().Last()
+        if v == nil {
+            return nil
+        }
+        r = &Record{}
+        return json.Unmarshal(v, r)
+    })
+    return r, err
+}
+
+// Records returns the audits of chart and variant since the given time,
+// all of them for the zero time, oldest first.
+func (s *Store) Records(chart, variant string, since time.Time) ([]*Record, error) {
+    var out []*Record
+    err := s.db.View(func(tx *bolt.Tx) error {
+        b, err := bucket(tx, false, auditsBucket, []byte(chart), []byte(variant))
+        if b == nil || err != nil {
+            return err
+        }
+        c := b.Cursor()
+        k, v := c.First()
+        if !since.IsZero() {
+            k, v = c.Seek(timeKey(since))
+        }
+        for ; k != nil; k, v = c.Next() {
+            r := &Record{}
+            if err := json.Unmarshal(v, r); err != nil {
+                return fmt.Errorf("history record of %s: %w", chart, err)
+            }
+            out = append(out, r)
+        }
+        return nil
+    })
+    return out, err
+}
+
+// Versions lists the chart versions audited with variant.
+func (s *Store) Versions(chart, variant string) ([]string, error) {
+    var out []string
+    err := s.db.View(func(tx *bolt.Tx) error {
+        b, err := bucket(tx, false, versionsBucket, []byte(chart), []byte(variant))
+        if b == nil || err != nil {
+            return err
+        }
+        return b.ForEach(func(version, _ []byte) error {
+            out = append(out, string(version))
+            return nil
+        })
+    })
+    return out, err
+}
+
+// VersionRecords returns the audits of one version of chart with
+// variant, oldest first.
+func (s *Store) VersionRecords(chart, variant, version string) ([]*Record, error) {
+    var out []*Record
+    err := s.db.View(func(tx *bolt.Tx) error {
+        idx, err := bucket(tx, false, versionsBucket, []byte(chart), []byte(variant), []byte(version))
+        if idx == nil || err != nil {
+            return err
+        }
+        b, err := bucket(tx, false, auditsBucket, []byte(chart), []byte(variant))
+        if b == nil || err != nil {
+            return err
+        }
+        return idx.ForEach(func(k, _ []byte) error {
+            v := b.Get(k)
+            if v == nil {
+                return nil
+            }
+            r := &Record{}
+            if err := json.Unmarshal(v, r); err != nil {
+                return fmt.Errorf("history record of %s: %w", chart, err)
+            }
+            out = append(out, r)
+            return nil
+        })
+    })
+    return out, err
+}
+
+// Charts lists the charts with a history, and their variants.
+func (s *Store) Charts() (map[string][]string, error) {
+    out := map[string][]string{}
+    err := s.db.View(func(tx *bolt.Tx) error {
+        b := tx.Bucket(auditsBucket)
+        if b == nil {
+            return nil
+        }
+        return b.ForEach(func(chart, _ []byte) error {
+            return b.Bucket(chart).ForEach(func(variant, _ []byte) error {
+                out[string(chart)] = append(out[string(chart)], string(variant))
+                return nil
+            })
+        })
+    })
+    return out, err
+}
+
+// Trend sums up the audits of chart and variant, oldest first.
+func (s *Store) Trend(chart, variant string, since time.Time) ([]types.TrendPoint, error) {
+    records, err := s.Records(chart, variant, since)
+    if err != nil {
+        return nil, err
+    }
+    out := make([]types.TrendPoint, 0, len(records))
+    for _, r := range records {
+        out = append(out, r.Point())
+    }
+    return out, nil
+}
+
+// TimeToFix is the mean number of days between the first audit
+// reporting an issue and the first one without it, by severity.
+func (s *Store) TimeToFix(chart, variant string, since time.Time) (map[string]float64, error) {
+    records, err := s.Records(chart, variant, since)
+    if err != nil {
+        return nil, err
+    }
+    total := map[string]time.Duration{}
+    count := map[string]int{}
+    for i := 1; i < len(records); i++ {
+        for _, issue := range resolved(records[i-1], records[i]) {
+            total[issue.Severity] += records[i].Time.Sub(issue.FirstSeen)
+            count[issue.Severity]++
+        }
+    }
+    if len(count) == 0 {
+        return nil, nil
+    }
+    out := map[string]float64{}
+    for sev, n := range count {
+        out[sev] = total[sev].Hours() / 24 / float64(n)
+    }
+    return out, nil
+}
+
+// resolved returns the issues of prev missing from cur.
+func resolved(prev, cur *Record) []Issue {
+    in := map[string]bool{}
+    for _, i := range cur.Issues {
+        in[i.Key] = true
+    }
+    var out []Issue
+    for _, i := range prev.Issues {
+        if !in[i.Key] {
+            out = append(out, i)
+        }
+    }
+    return out
+}
+
+// Annotate marks the CVEs, misconfigurations and findings of audit as
+// new or existing since the last audit of the chart and variant, stores
+// the audit at now and returns how it compares with the history.
+func (s *Store) Annotate(audit *reports.ExtendedAudit, variant string, now time.Time) (*types.AuditHistory, error) {
+    if variant == "" {
+        variant = DefaultVariant
+    }
+    chart := audit.Chart.Name
+    prev, err := s.Last(chart, variant)
+    if err != nil {
+        return nil, err
+    }
+    seen := map[string]time.Time{}
+    if prev != nil {
+        for _, i := range prev.Issues {
+            seen[i.Key] = i.FirstSeen
+        }
+    }
+
+    h := &types.AuditHistory{Variant: variant}
+    rec := &Record{Chart: chart, Version: audit.Chart.Version, Variant: variant, Time: now}
+    index := map[string]time.Time{}
+    // track records the issue and returns its baseline and first sighting.
+    track := func(kind, id, severity, target, key string) (string, time.Time) {
+        key = kind + "\x00" + target + "\x00" + key
+        if first, ok := index[key]; ok {
+            return baseline(prev, first, now), first
+        }
+        first, ok := seen[key]
+        if !ok {
+            first = now
+        }
+        index[key] = first
+        rec.Issues = append(rec.Issues, Issue{
+            Key:       key,
+            Kind:      kind,
+            ID:        id,
+            Severity:  strings.ToUpper(severity),
+            Target:    target,
+            FirstSeen: first,
+        })
+        b := baseline(prev, first, now)
+        if b == "new" {
+            h.New++
+        } else {
+            h.Existing++
+        }
+        return b, first
+    }
+
+    for i := range audit.ImagesSummary.Images {
+        img := &audit.ImagesSummary.Images[i]
+        repo := diff.Repository(img.Name)
+        for j := range img.CVEs {
+            v := &img.CVEs[j]
+            v.Baseline, v.FirstSeen = track("cve", v.ID, v.Severity, repo, diff.CVEKey(*v))
+        }
+    }
+    for i := range audit.Misconfigurations {
+        m := &audit.Misconfigurations[i]
+        m.Baseline, m.FirstSeen = track("misconfiguration", m.ID, m.Severity, m.Resource, diff.MisconfigurationKey(*m))
+    }
+    if audit.Manifests != nil {
+        for i := range audit.Manifests.Findings {
+            f := &audit.Manifests.Findings[i]
+            f.Baseline, f.FirstSeen = track("finding", f.RuleID, f.Severity, f.Resource, diff.FindingKey(*f))
+        }
+    }
+
+    if prev != nil {
+        p := prev.Point()
+        h.Previous = &p
+        for _, i := range resolved(prev, rec) {
+            h.Resolved = append(h.Resolved, types.ResolvedIssue{
+                Kind:      i.Kind,
+                ID:        i.ID,
+                Severity:  i.Severity,
+                Target:    i.Target,
+                FirstSeen: i.FirstSeen,
+            })
+        }
+        sort.SliceStable(h.Resolved, func(a, b int) bool {
+            return h.Resolved[a].Kind < h.Resolved[b].Kind
+        })
+    }
+
+    if err := s.Put(rec); err != nil {
+        return nil, err
+    }
+    if h.Trend, err = s.Trend(chart, variant, time.Time{}); err != nil {
+        return nil, err
+    }
+    if h.TimeToFix, err = s.TimeToFix(chart, variant, time.Time{}); err != nil {
+        return nil, err
+    }
+    return h, nil
+}
+
+// baseline is "new" for an issue first seen in this audit, "existing"
+// otherwise. Without previous audit nothing is new.
+func baseline(prev *Record, first, now time.Time) string {
+    if prev != nil && first.Equal(now) {
+        return "new"
+    }
+    return "existing"
+}
@@ -0,0 +1,45 @@
+package osv
+
+import (
+    "helm-auditor/internal/types"
+)
+
+// CrossCheck compares the matches of an image with the vulnerabilities
+// trivy found in it. A match and a trivy vulnerability agree when they
+// are about the same package and trivy's ID is the match ID or one of
+// its aliases.
+func CrossCheck(db *DB, matches []Match, trivy []types.Vulnerability) *types.OSVScan {
+    scan := &types.OSVScan{Database: db.Path, Matched: len(matches), TrivyScanned: true}
+
+    type pkgID struct{ pkg, id string }
+    found := map[pkgID]bool{}
+    for _, v := range trivy {
+        found[pkgID{v.Package, v.ID}] = true
+    }
+    agreed := map[pkgID]bool{}
+    for _, m := range matches {
+        hit := false
+        for _, id := range append([]string{m.ID}, m.Aliases...) {
+            k := pkgID{m.Package, id}
+            if found[k] {
+                agreed[k] = true
+                hit = true
+            }
+        }
+        if hit {
+            scan.Both++
+            continue
+        }
+        scan.OSVOnly = append(scan.OSVOnly, ref(m.Vulnerability))
+    }
+    for _, v := range trivy {
+        if !agreed[pkgID{v.Package, v.ID}] {
+            scan.TrivyOnly = append(scan.TrivyOnly, ref(v))
+        }
+    }
+    return scan
+}
+
+func ref(v types.Vulnerability) types.VulnRef {
+    return types.VulnRef{ID: v.ID, Package: v.Package, InstalledVersion: v.InstalledVersion}
+}
@@ -0,0 +1,90 @@
+package osv
+
+import (
+    "fmt"
+    "math"
+    "strings"
+)
+
+// CVSS v3 base metric weights.
+var cvss3Weights = map[string]map[string]float64{
+    "AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+    "AC": {"L": 0.77, "H": 0.44},
+    "UI": {"N": 0.85, "R": 0.62},
+    "C":  {"H": 0.56, "L": 0.22, "N": 0},
+    "I":  {"H": 0.56, "L": 0.22, "N": 0},
+    "A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// CVSS3Score computes the base score of a CVSS v3.0 or v3.1 vector.
+func CVSS3Score(vector string) (float64, error) {
+    parts := strings.Split(vector, "/")
+    if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+        return 0, fmt.Errorf("not a CVSS v3 vector: %q", vector)
+    }
+    m := map[string]string{}
+    for _, p := range parts[1:] {
+        k, v, _ := strings.Cut(p, ":")
+        m[k] = v
+    }
+
+    w := map[string]float64{}
+    for metric, weights := range cvss3Weights {
+        v, ok := weights[m[metric]]
+        if !ok {
+            return 0, fmt.Errorf("CVSS vector %q: invalid %s", vector, metric)
+        }
+        w[metric] = v
+    }
+    changed := m["S"] == "C"
+    if !changed && m["S"] != "U" {
+        return 0, fmt.Errorf("CVSS vector %q: invalid S", vector)
+    }
+    pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+    if changed {
+        pr["L"], pr["H"] = 0.68, 0.5
+    }
+    privileges, ok := pr[m["PR"]]
+    if !ok {
+        return 0, fmt.Errorf("CVSS vector %q: invalid PR", vector)
+    }
+
+    iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+    impact := 6.42 * iss
+    if changed {
+        impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+    }
+    if impact <= 0 {
+        return 0, nil
+    }
+    exploitability := 8.22 * w["AV"] * w["AC"] * privileges * w["UI"]
+    if changed {
+        return roundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+    }
+    return roundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// roundUp is the CVSS v3.1 Roundup, to one decimal avoiding floating
+// point artifacts.
+func roundUp(x float64) float64 {
+    i := int(math.Round(x * 100000))
+    if i%10000 == 0 {
+        return float64(i) / 100000
+    }
+    return float64(i/10000+1) / 10
+}
+
+// SeverityOf rates a CVSS score.
+func SeverityOf(score float64) string {
+    switch {
+    case score >= 9:
+        return "CRITICAL"
+    case score >= 7:
+        return "HIGH"
+    case score >= 4:
+        return "MEDIUM"
+    case score > 0:
+        return "LOW"
+    }
+    return "UNKNOWN"
+}
@@ -0,0 +1,41 @@
+package osv
+
+import "testing"
+
+// Base scores as published by NVD.
+func TestCVSS3Score(t *testing.T) {
+    tests := []struct {
+        vector   string
+        score    float64
+        severity string
+    }{
+        {"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8, "CRITICAL"},  // CVE-2023-38545
+        {"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", 10.0, "CRITICAL"}, // CVE-2021-44228
+        {"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1, "MEDIUM"},
+        {"CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:N/I:N/A:H", 5.5, "MEDIUM"},
+        {"CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:C/C:H/I:H/A:H", 9.9, "CRITICAL"},
+        {"CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:H/I:N/A:N", 5.9, "MEDIUM"},
+        {"CVSS:3.0/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:H", 7.5, "HIGH"},
+        {"CVSS:3.1/AV:P/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", 1.6, "LOW"},
+        {"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", 0, "UNKNOWN"},
+    }
+    for _, tt := range tests {
+        score, err := CVSS3Score(tt.vector)
+        if err != nil {
+            t.Errorf("CVSS3Score(%q): %v", tt.vector, err)
+            continue
+        }
+        if score != tt.score {
+            t.Errorf("CVSS3Score(%q) = %v, want %v", tt.vector, score, tt.score)
+        }
+        if s := SeverityOf(score); s != tt.severity {
+            t.Errorf("SeverityOf(%v) = %s, want %s", score, s, tt.severity)
+        }
+    }
+
+    for _, v := range []string{"CVSS:2.0/AV:N", "CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/C:H/I:H/A:H"} {
+        if _, err := CVSS3Score(v); err == nil {
+            t.Errorf("CVSS3Score(%q) did not fail", v)
+        }
+    }
+}
@@ -0,0 +1,457 @@
+// Package osv matches the components of CycloneDX SBOMs against an
+// offline export of the OSV database, so images can be scanned without
+// trivy and trivy's results cross-checked.
+package osv
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "helm-auditor/internal/types"
+)
+
+// DataSource marks the vulnerabilities found by the matcher.
+const DataSource = "osv"
+
+// Entry is an OSV vulnerability, the fields the matcher uses.
+type Entry struct {
+    ID        string     `json:"id"`
+    Aliases   []string   `json:"aliases"`
+    Upstream  []string   `json:"upstream"`
+    Summary   string     `json:"summary"`
+    Details   string     `json:"details"`
+    Published string     `json:"published"`
+    Withdrawn string     `json:"withdrawn"`
+    Severity  []Severity `json:"severity"`
+    Affected  []Affected `json:"affected"`
+
+    References []struct {
+        Type string `json:"type"`
+        URL  string `json:"url"`
+    } `json:"references"`
+
+    // Varies between databases, only a severity string is read from it
+    DatabaseSpecific json.RawMessage `json:"database_specific"`
+}
+
+// Severity is a CVSS vector or an ecosystem rating.
+type Severity struct {
+    Type  string `json:"type"` // CVSS_V3, CVSS_V4, Ubuntu...
+    Score string `json:"score"`
+}
+
+// Affected lists the affected versions of a package.
+type Affected struct {
+    Package struct {
+        Ecosystem string `json:"ecosystem"` // Debian:12, PyPI...
+        Name      string `json:"name"`
+    } `json:"package"`
+    Severity []Severity `json:"severity"`
+    Ranges   []Range    `json:"ranges"`
+    Versions []string   `json:"versions"`
+}
+
+// Range is a list of events in the version ordering of Type.
+type Range struct {
+    Type   string  `json:"type"` // SEMVER, ECOSYSTEM or GIT
+    Events []Event `json:"events"`
+}
+
+// Event opens or closes an affected range.
+type Event struct {
+    Introduced   string `json:"introduced,omitempty"`
+    Fixed        string `json:"fixed,omitempty"`
+    LastAffected string `json:"last_affected,omitempty"`
+    Limit        string `json:"limit,omitempty"`
+}
+
+// Component is a package of an SBOM, as the OSV database names it.
+type Component struct {
+    PURL      string
+    Ecosystem string // base ecosystem, without release
+    Release   string // distribution release, OS packages only
+    Name      string // OSV name, the source package of OS packages
+    Version   string // version compared, the source version of OS packages
+    Package   string // name reported, as in the SBOM
+    Installed string // version reported, as in the SBOM
+    Type      string // purl type
+}
+
+type key struct {
+    ecosystem, name string
+}
+
+func keyOf(ecosystem, name string) key {
+    base, _, _ := strings.Cut(ecosystem, ":")
+    if base == "PyPI" {
+        name = strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(name))
+    }
+    return key{base, name}
+}
+
+// DB is the part of an OSV export loaded for a set of components.
+type DB struct {
+    Path    string
+    Entries int
+
+    byPackage map[key][]*Entry
+}
+
+// Load reads the OSV export at path: a directory of <ID>.json files,
+// optionally under one directory per ecosystem, and all.zip archives as
+// published on osv-vulnerabilities.storage.googleapis.com. Only entries
+// affecting the packages of components are kept; nil keeps everything.
+func Load(path string, components []Component) (*DB, error) {
+    db := &DB{Path: path, byPackage: map[key][]*Entry{}}
+    var want map[key]bool
+    var ecosystems map[string]bool
+    if components != nil {
+        want, ecosystems = map[key]bool{}, map[string]bool{}
+        for _, c := range components {
+            want[keyOf(c.Ecosystem, c.Name)] = true
+            ecosystems[c.Ecosystem] = true
+        }
+    }
+
+    add := func(r io.Reader, name string) error {
+        var e Entry
+        if err := json.NewDecoder(r).Decode(&e); err != nil {
+            return fmt.Errorf("parsing OSV entry %s: %w", name, err)
+        }
+        if e.Withdrawn != "" {
+            return nil
+        }
+        seen := map[key]bool{}
+        for _, a := range e.Affected {
+            k := keyOf(a.Package.Ecosystem, a.Package.Name)
+            if seen[k] || (want != nil && !want[k]) {
+                continue
+            }
+            seen[k] = true
+            db.byPackage[k] = append(db.byPackage[k], &e)
+        }
+        if len(seen) > 0 {
+            db.Entries++
+        }
+        return nil
+    }
+
+    info, err := os.Stat(path)
+    if err != nil {
+        return nil, fmt.Errorf("opening OSV database: %w", err)
+    }
+    if !info.IsDir() {
+        return db, loadZip(path, add)
+    }
+    err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            // Top level directories are named after ecosystems, Debian:12
+            base, _, _ := strings.Cut(d.Name(), ":")
+            if ecosystems != nil && filepath.Dir(p) == filepath.Clean(path) && !ecosystems[base] {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        switch strings.ToLower(filepath.Ext(p)) {
+        case ".zip":
+            return loadZip(p, add)
+        case ".json":
+            f, err := os.Open(p)
+            if err != nil {
+                return err
+            }
+            defer f.Close()
+            return add(f, p)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return db, nil
+}
+
+func loadZip(path string, add func(io.Reader, string) error) error {
+    zr, err := zip.OpenReader(path)
+    if err != nil {
+        return fmt.Errorf("opening OSV archive: %w", err)
+    }
+    defer zr.Close()
+    for _, f := range zr.File {
+        if !strings.HasSuffix(f.Name, ".json") {
+            continue
+        }
+        r, err := f.Open()
+        if err != nil {
+            return err
+        }
+        err = add(r, path+"!"+f.Name)
+        r.Close()
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Match is a vulnerability of a component, with the IDs it is also
+// known under.
+type Match struct {
+    types.Vulnerability
+    Aliases []string
+}
+
+// Match returns the vulnerabilities affecting components, one per
+// component and CVE.
+func (db *DB) Match(components []Component) []Match {
+    var out []Match
+    for _, c := range components {
+        index := map[string]int{}
+        for _, e := range db.byPackage[keyOf(c.Ecosystem, c.Name)] {
+            fixed, ok := e.affects(c)
+            if !ok {
+                continue
+            }
+            m := e.match(c, fixed)
+            if i, dup := index[m.ID]; dup {
+                out[i].Aliases = union(out[i].Aliases, m.Aliases)
+                continue
+            }
+            index[m.ID] = len(out)
+            out = append(out, m)
+        }
+    }
+    sort.SliceStable(out, func(i, j int) bool {
+        if out[i].Package != out[j].Package {
+            return out[i].Package < out[j].Package
+        }
+        return out[i].ID < out[j].ID
+    })
+    return out
+}
+
+// Vulnerabilities drops the aliases of matches.
+func Vulnerabilities(matches []Match) []types.Vulnerability {
+    out := make([]types.Vulnerability, 0, len(matches))
+    for _, m := range matches {
+        out = append(out, m.Vulnerability)
+    }
+    return out
+}
+
+// affects reports whether the entry affects the component and the
+// version fixing it, if any.
+func (e *Entry) affects(c Component) (fixed string, ok bool) {
+    for _, a := range e.Affected {
+        if keyOf(a.Package.Ecosystem, a.Package.Name) != keyOf(c.Ecosystem, c.Name) ||
+            !sameRelease(a.Package.Ecosystem, c.Release) {
+            continue
+        }
+        for _, v := range a.Versions {
+            if v == c.Version {
+                ok = true
+            }
+        }
+        for _, r := range a.Ranges {
+            if f, in := r.contains(c.Ecosystem, c.Version); in {
+                ok = true
+                if fixed == "" {
+                    fixed = f
+                }
+            }
+        }
+    }
+    return fixed, ok
+}
+
+// sameRelease matches the release of a component against the release
+// part of an OSV ecosystem: 12 in Debian:12, 22.04 in Ubuntu:22.04:LTS
+// or 9 in Red Hat:enterprise_linux:9::appstream.
+func sameRelease(ecosystem, release string) bool {
+    _, suffix, found := strings.Cut(ecosystem, ":")
+    if !found || release == "" {
+        return true
+    }
+    for _, f := range strings.Split(suffix, ":") {
+        if f == release {
+            return true
+        }
+    }
+    return false
+}
+
+// contains walks the events of the range in version order and reports
+// whether version is affected, with the first fixed version after it.
+func (r Range) contains(ecosystem, version string) (fixed string, affected bool) {
+    var cmp func(a, b string) int
+    switch r.Type {
+    case "SEMVER":
+        cmp = compareSemver
+    case "ECOSYSTEM":
+        cmp = compareFunc(ecosystem)
+    default:
+        // GIT ranges need commit history
+        return "", false
+    }
+
+    events := append([]Event(nil), r.Events...)
+    at := func(e Event) string {
+        return e.Introduced + e.Fixed + e.LastAffected + e.Limit
+    }
+    sort.SliceStable(events, func(i, j int) bool {
+        vi, vj := at(events[i]), at(events[j])
+        if vi == "0" || vj == "0" {
+            return vi == "0" && vj != "0"
+        }
+        return cmp(vi, vj) < 0
+    })
+
+    for _, e := range events {
+        v := at(e)
+        if e.Introduced == "0" {
+            affected = true
+            continue
+        }
+        c := cmp(version, v)
+        if c < 0 {
+            // Later events are all above version
+            if affected && e.Fixed != "" {
+                fixed = e.Fixed
+            }
+            break
+        }
+        switch {
+        case e.Introduced != "":
+            affected = true
+        case e.Fixed != "", e.Limit != "":
+            affected = false
+        case e.LastAffected != "" && c > 0:
+            affected = false
+        }
+    }
+    if !affected {
+        fixed = ""
+    }
+    return fixed, affected
+}
+
+func (e *Entry) match(c Component, fixed string) Match {
+    m := Match{Aliases: union(e.Aliases, e.Upstream)}
+    v := &m.Vulnerability
+    v.ID = e.ID
+    if !strings.HasPrefix(e.ID, "CVE-") {
+        // Report the CVE the advisory is about, like trivy does
+        var cves []string
+        for _, a := range m.Aliases {
+            if strings.HasPrefix(a, "CVE-") {
+                cves = append(cves, a)
+            }
+        }
+        if len(cves) == 1 {
+            v.ID = cves[0]
+            m.Aliases = union([]string{e.ID}, m.Aliases)
+        }
+    }
+
+    v.Package = c.Package
+    v.InstalledVersion = c.Installed
+    v.FixedVersion = fixed
+    v.Status = "affected"
+    if fixed != "" {
+        v.Status = "fixed"
+    }
+    v.DataSource = DataSource
+    v.Type = c.Type
+    v.Class = "lang-pkgs"
+    if c.Release != "" || c.Type == "deb" || c.Type == "apk" || c.Type == "rpm" {
+        v.Class = "os-pkgs"
+    }
+
+    v.Title = e.Summary
+    if v.Title == "" {
+        v.Title, _, _ = strings.Cut(strings.TrimSpace(e.Details), "\n")
+    }
+    v.URL = "https://osv.dev/vulnerability/" + e.ID
+    for _, r := range e.References {
+        if r.Type == "ADVISORY" {
+            v.URL = r.URL
+            break
+        }
+    }
+    if t, err := time.Parse(time.RFC3339, e.Published); err == nil {
+        v.Published = t
+    }
+    v.Severity, v.CVSSScore, v.CVSSVector = e.severity(c)
+    return m
+}
+
+// severity rates the entry from its CVSS v3 vector, an ecosystem rating
+// or the database severity, in that order.
+func (e *Entry) severity(c Component) (severity string, score float64, vector string) {
+    ratings := e.Severity
+    for _, a := range e.Affected {
+        if keyOf(a.Package.Ecosystem, a.Package.Name) == keyOf(c.Ecosystem, c.Name) {
+            ratings = append(ratings, a.Severity...)
+        }
+    }
+    text := ""
+    for _, s := range ratings {
+        switch s.Type {
+        case "CVSS_V3":
+            if score, err := CVSS3Score(s.Score); err == nil {
+                return SeverityOf(score), score, s.Score
+            }
+        case "CVSS_V2", "CVSS_V4":
+        default:
+            text = s.Score
+        }
+    }
+    if text == "" && len(e.DatabaseSpecific) > 0 {
+        var db struct {
+            Severity string `json:"severity"`
+        }
+        if json.Unmarshal(e.DatabaseSpecific, &db) == nil {
+            text = db.Severity
+        }
+    }
+    return normalizeSeverity(text), 0, ""
+}
+
+func normalizeSeverity(s string) string {
+    switch strings.ToUpper(strings.TrimSpace(s)) {
+    case "CRITICAL":
+        return "CRITICAL"
+    case "HIGH", "IMPORTANT":
+        return "HIGH"
+    case "MEDIUM", "MODERATE":
+        return "MEDIUM"
+    case "LOW", "NEGLIGIBLE", "UNIMPORTANT":
+        return "LOW"
+    }
+    return "UNKNOWN"
+}
+
+func union(a, b []string) []string {
+    out := append([]string(nil), a...)
+    for _, s := range b {
+        dup := false
+        for _, t := range out {
+            dup = dup || s == t
+        }
+        if !dup {
+            out = append(out, s)
+        }
+    }
+    return out
+}
@@ -0,0 +1,133 @@
+package osv
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+)
+
+// PURL is a parsed package URL, pkg:type/namespace/name@version?qualifiers.
+type PURL struct {
+    Type       string
+    Namespace  string
+    Name       string
+    Version    string
+    Qualifiers map[string]string
+}
+
+// ParsePURL reads a package URL. Subpaths are dropped.
+func ParsePURL(s string) (PURL, error) {
+    p := PURL{Qualifiers: map[string]string{}}
+    rest, ok := strings.CutPrefix(s, "pkg:")
+    if !ok {
+        return p, fmt.Errorf("invalid purl %q: no pkg: scheme", s)
+    }
+    rest, _, _ = strings.Cut(rest, "#")
+    rest, query, _ := strings.Cut(rest, "?")
+    for _, kv := range strings.Split(query, "&") {
+        if k, v, ok := strings.Cut(kv, "="); ok {
+            v, _ = url.PathUnescape(v)
+            p.Qualifiers[strings.ToLower(k)] = v
+        }
+    }
+    if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+        p.Version, _ = url.PathUnescape(rest[i+1:])
+        rest = rest[:i]
+    }
+
+    parts := strings.Split(strings.Trim(rest, "/"), "/")
+    if len(parts) < 2 {
+        return p, fmt.Errorf("invalid purl %q: no name", s)
+    }
+    p.Type = strings.ToLower(parts[0])
+    for i, part := range parts {
+        parts[i], _ = url.PathUnescape(part)
+    }
+    p.Name = parts[len(parts)-1]
+    p.Namespace = strings.Join(parts[1:len(parts)-1], "/")
+    return p, nil
+}
+
+// languageEcosystems maps purl types to OSV ecosystems.
+var languageEcosystems = map[string]string{
+    "cargo":    "crates.io",
+    "composer": "Packagist",
+    "gem":      "RubyGems",
+    "golang":   "Go",
+    "hex":      "Hex",
+    "maven":    "Maven",
+    "npm":      "npm",
+    "nuget":    "NuGet",
+    "pub":      "Pub",
+    "pypi":     "PyPI",
+}
+
+// osEcosystems maps the namespace of deb, apk and rpm purls to OSV
+// ecosystems.
+var osEcosystems = map[string]string{
+    "debian":     "Debian",
+    "ubuntu":     "Ubuntu",
+    "alpine":     "Alpine",
+    "wolfi":      "Wolfi",
+    "chainguard": "Chainguard",
+    "redhat":     "Red Hat",
+    "rocky":      "Rocky Linux",
+    "almalinux":  "AlmaLinux",
+    "opensuse":   "openSUSE",
+    "suse":       "SUSE",
+    "mageia":     "Mageia",
+}
+
+// Ecosystem returns the OSV ecosystem of the package, the release of the
+// distribution for OS packages (Debian "12", Alpine "v3.19") and the
+// name OSV knows it under. It returns "" for unsupported packages.
+func (p PURL) Ecosystem() (ecosystem, release, name string) {
+    if e, ok := languageEcosystems[p.Type]; ok {
+        name = p.Name
+        switch p.Type {
+        case "maven":
+            name = p.Namespace + ":" + p.Name
+        case "golang", "composer", "npm":
+            if p.Namespace != "" {
+                name = p.Namespace + "/" + p.Name
+            }
+        case "pypi":
+            name = strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(p.Name))
+        }
+        return e, "", name
+    }
+    switch p.Type {
+    case "deb", "apk", "rpm":
+    default:
+        return "", "", ""
+    }
+    e, ok := osEcosystems[strings.ToLower(p.Namespace)]
+    if !ok {
+        return "", "", ""
+    }
+    return e, distroRelease(e, p.Qualifiers["distro"]), p.Name
+}
+
+// distroRelease turns the distro qualifier (debian-12.5, 3.19.1,
+// redhat-9.3, ubuntu-22.04) into the release OSV ecosystems carry.
+func distroRelease(ecosystem, distro string) string {
+    if i := strings.LastIndexByte(distro, '-'); i >= 0 {
+        distro = distro[i+1:]
+    }
+    if distro == "" {
+        return ""
+    }
+    parts := strings.Split(distro, ".")
+    switch ecosystem {
+    case "Alpine":
+        if len(parts) >= 2 {
+            return "v" + parts[0] + "." + parts[1]
+        }
+        return "v" + distro
+    case "Ubuntu":
+        return distro
+    case "Wolfi", "Chainguard":
+        return ""
+    }
+    return parts[0]
+}
@@ -0,0 +1,48 @@
+package osv
+
+import "testing"
+
+func TestPURLEcosystem(t *testing.T) {
+    tests := []struct {
+        purl                     string
+        ecosystem, release, name string
+        version                  string
+    }{
+        {"pkg:npm/%40babel/core@7.24.0", "npm", "", "@babel/core", "7.24.0"},
+        {"pkg:npm/lodash@4.17.21", "npm", "", "lodash", "4.17.21"},
+        {"pkg:golang/golang.org/x/net@v0.23.0", "Go", "", "golang.org/x/net", "v0.23.0"},
+        {"pkg:golang/github.com/prometheus/client_golang@v1.19.0", "Go", "", "github.com/prometheus/client_golang", "v1.19.0"},
+        {"pkg:maven/org.apache.logging.log4j/log4j-core@2.17.1", "Maven", "", "org.apache.logging.log4j:log4j-core", "2.17.1"},
+        {"pkg:pypi/Zope.Interface@6.2", "PyPI", "", "zope-interface", "6.2"},
+        {"pkg:deb/debian/libssl3@3.0.11-1~deb12u2?arch=amd64&distro=debian-12.5", "Debian", "12", "libssl3", "3.0.11-1~deb12u2"},
+        {"pkg:deb/ubuntu/libc6@2.35-0ubuntu3.6?distro=ubuntu-22.04", "Ubuntu", "22.04", "libc6", "2.35-0ubuntu3.6"},
+        {"pkg:apk/alpine/busybox@1.36.1-r15?arch=x86_64&distro=3.19.1", "Alpine", "v3.19", "busybox", "1.36.1-r15"},
+        {"pkg:rpm/redhat/openssl-libs@3.0.7-25.el9_3?distro=redhat-9.3", "Red Hat", "9", "openssl-libs", "3.0.7-25.el9_3"},
+        {"pkg:apk/wolfi/glibc@2.39-r1?distro=20230201", "Wolfi", "", "glibc", "2.39-r1"},
+        {"pkg:oci/nginx@sha256%3Aabc", "", "", "", "sha256:abc"},
+        {"pkg:deb/unknown/foo@1.0", "", "", "", "1.0"},
+    }
+    for _, tt := range tests {
+        p, err := ParsePURL(tt.purl)
+        if err != nil {
+            t.Errorf("ParsePURL(%q): %v", tt.purl, err)
+            continue
+        }
+        if p.Version != tt.version {
+            t.Errorf("ParsePURL(%q).Version = %q, want %q", tt.purl, p.Version, tt.version)
+        }
+        ecosystem, release, name := p.Ecosystem()
+        if ecosystem != tt.ecosystem || release != tt.release || name != tt.name {
+            t.Errorf("%q: Ecosystem() = %q, %q, %q, want %q, %q, %q",
+                tt.purl, ecosystem, release, name, tt.ecosystem, tt.release, tt.name)
+        }
+    }
+}
+
+func TestParsePURLInvalid(t *testing.T) {
+    for _, s := range []string{"npm/lodash@1.0", "pkg:npm", ""} {
+        if _, err := ParsePURL(s); err == nil {
+            t.Errorf("ParsePURL(%q) did not fail", s)
+        }
+    }
+}
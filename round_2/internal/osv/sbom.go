@@ -0,0 +1,117 @@
+package osv
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// Properties trivy sets on OS packages built from a source package.
+const (
+    srcName    = "aquasecurity:trivy:SrcName"
+    srcVersion = "aquasecurity:trivy:SrcVersion"
+    srcRelease = "aquasecurity:trivy:SrcRelease"
+    srcEpoch   = "aquasecurity:trivy:SrcEpoch"
+)
+
+type cdxComponent struct {
+    Name       string `json:"name"`
+    Version    string `json:"version"`
+    PURL       string `json:"purl"`
+    Properties []struct {
+        Name  string `json:"name"`
+        Value string `json:"value"`
+    } `json:"properties"`
+    Components []cdxComponent `json:"components"`
+}
+
+type cdxDocument struct {
+    Components []cdxComponent `json:"components"`
+}
+
+// LoadSBOM returns the components of a CycloneDX SBOM the matcher knows
+// the ecosystem of.
+func LoadSBOM(path string) ([]Component, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var doc struct {
+        cdxDocument
+        BOM *cdxDocument `json:"bom"`
+    }
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("parsing sbom %s: %w", path, err)
+    }
+    d := doc.cdxDocument
+    if doc.BOM != nil && len(d.Components) == 0 {
+        d = *doc.BOM
+    }
+
+    var out []Component
+    var walk func([]cdxComponent)
+    walk = func(cs []cdxComponent) {
+        for _, c := range cs {
+            if comp, ok := component(c); ok {
+                out = append(out, comp)
+            }
+            walk(c.Components)
+        }
+    }
+    walk(d.Components)
+    return out, nil
+}
+
+func component(c cdxComponent) (Component, bool) {
+    if c.PURL == "" {
+        return Component{}, false
+    }
+    p, err := ParsePURL(c.PURL)
+    if err != nil {
+        return Component{}, false
+    }
+    ecosystem, release, name := p.Ecosystem()
+    if ecosystem == "" || p.Version == "" {
+        return Component{}, false
+    }
+
+    version := p.Version
+    if e := p.Qualifiers["epoch"]; e != "" && e != "0" && !strings.Contains(version, ":") {
+        version = e + ":" + version
+    }
+    out := Component{
+        PURL:      c.PURL,
+        Ecosystem: ecosystem,
+        Release:   release,
+        Name:      name,
+        Version:   version,
+        Package:   c.Name,
+        Installed: version,
+        Type:      p.Type,
+    }
+    if out.Package == "" {
+        out.Package = p.Name
+    }
+
+    // OS advisories are about source packages: openssl, not libssl3
+    props := map[string]string{}
+    for _, prop := range c.Properties {
+        props[prop.Name] = prop.Value
+    }
+    if p.Type == "deb" || p.Type == "apk" || p.Type == "rpm" {
+        if n := props[srcName]; n != "" {
+            out.Name = n
+        }
+        if v := props[srcVersion]; v != "" {
+            if r := props[srcRelease]; r != "" {
+                v += "-" + r
+            }
+            if e := props[srcEpoch]; e != "" && e != "0" {
+                v = e + ":" + v
+            }
+            out.Version = v
+        }
+    }
+    return out, true
+}
@@ -0,0 +1,537 @@
+package osv
+
+import (
+    "strconv"
+    "strings"
+    "unicode"
+
+    "github.com/Masterminds/semver/v3"
+)
+
+// compareFunc returns the version ordering of an ecosystem.
+func compareFunc(ecosystem string) func(a, b string) int {
+    switch ecosystem {
+    case "Debian", "Ubuntu":
+        return compareDpkg
+    case "Alpine", "Wolfi", "Chainguard":
+        return compareApk
+    case "Red Hat", "Rocky Linux", "AlmaLinux", "openSUSE", "SUSE", "Mageia":
+        return compareRpm
+    case "PyPI":
+        return comparePEP440
+    case "Go", "npm", "crates.io", "Hex", "Pub":
+        return compareSemver
+    }
+    return compareGeneric
+}
+
+func sign(n int) int {
+    switch {
+    case n < 0:
+        return -1
+    case n > 0:
+        return 1
+    }
+    return 0
+}
+
+// compareSemver orders SemVer versions, falling back to the generic
+// ordering for versions that are not.
+func compareSemver(a, b string) int {
+    va, errA := semver.NewVersion(a)
+    vb, errB := semver.NewVersion(b)
+    if errA != nil || errB != nil {
+        return compareGeneric(a, b)
+    }
+    return va.Compare(vb)
+}
+
+// Qualifiers of the generic ordering sorting after the release, or
+// naming it.
+var (
+    postQualifiers    = map[string]bool{"sp": true, "post": true, "patch": true, "pl": true, "p": true}
+    releaseQualifiers = map[string]bool{"final": true, "ga": true, "release": true}
+)
+
+// compareGeneric compares runs of digits numerically and anything else
+// lexically, enough for Maven, RubyGems or NuGet style versions. A
+// qualifier after the common part is a pre-release (1.0-beta < 1.0)
+// unless it is a patch level.
+func compareGeneric(a, b string) int {
+    ta, tb := tokens(a), tokens(b)
+    for i := 0; i < len(ta) && i < len(tb); i++ {
+        if c := compareToken(ta[i], tb[i]); c != 0 {
+            return c
+        }
+    }
+    var rest []string
+    c := 1
+    if len(ta) > len(tb) {
+        rest = ta[len(tb):]
+    } else {
+        rest, c = tb[len(ta):], -1
+    }
+    for _, t := range rest {
+        t = strings.ToLower(t)
+        switch {
+        case isDigits(t):
+            if strings.Trim(t, "0") != "" {
+                return c
+            }
+        case releaseQualifiers[t]:
+        case postQualifiers[t]:
+            return c
+        default:
+            return -c
+        }
+    }
+    return 0
+}
+
+func tokens(s string) []string {
+    var out []string
+    cur := ""
+    for _, r := range s {
+        if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+            if cur != "" {
+                out = append(out, cur)
+                cur = ""
+            }
+            continue
+        }
+        if cur != "" && unicode.IsDigit(r) != unicode.IsDigit(rune(cur[len(cur)-1])) {
+            out = append(out, cur)
+            cur = ""
+        }
+        cur += string(r)
+    }
+    if cur != "" {
+        out = append(out, cur)
+    }
+    return out
+}
+
+func compareToken(a, b string) int {
+    da, db := isDigits(a), isDigits(b)
+    switch {
+    case da && db:
+        return compareNumbers(a, b)
+    case da:
+        return 1
+    case db:
+        return -1
+    }
+    return strings.Compare(a, b)
+}
+
+func isDigits(s string) bool {
+    for _, r := range s {
+        if r < '0' || r > '9' {
+            return false
+        }
+    }
+    return s != ""
+}
+
+// compareNumbers compares digit strings of any length.
+func compareNumbers(a, b string) int {
+    a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+    if len(a) != len(b) {
+        return sign(len(a) - len(b))
+    }
+    return strings.Compare(a, b)
+}
+
+// compareDpkg follows dpkg --compare-versions: epoch, then upstream
+// version and Debian revision with "~" sorting before anything.
+func compareDpkg(a, b string) int {
+    ea, ua, ra := splitDpkg(a)
+    eb, ub, rb := splitDpkg(b)
+    if c := compareNumbers(ea, eb); c != 0 {
+        return c
+    }
+    if c := verrevcmp(ua, ub); c != 0 {
+        return c
+    }
+    return verrevcmp(ra, rb)
+}
+
+func splitDpkg(v string) (epoch, upstream, revision string) {
+    epoch = "0"
+    if i := strings.IndexByte(v, ':'); i >= 0 {
+        epoch, v = v[:i], v[i+1:]
+    }
+    if i := strings.LastIndexByte(v, '-'); i >= 0 {
+        return epoch, v[:i], v[i+1:]
+    }
+    return epoch, v, ""
+}
+
+func dpkgOrder(c byte) int {
+    switch {
+    case c >= '0' && c <= '9':
+        return 0
+    case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+        return int(c)
+    case c == '~':
+        return -1
+    case c == 0:
+        return 0
+    }
+    return int(c) + 256
+}
+
+func verrevcmp(a, b string) int {
+    at := func(s string, i int) byte {
+        if i < len(s) {
+            return s[i]
+        }
+        return 0
+    }
+    i, j := 0, 0
+    for i < len(a) || j < len(b) {
+        for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+            ac, bc := dpkgOrder(at(a, i)), dpkgOrder(at(b, j))
+            if i < len(a) && isDigit(a[i]) {
+                ac = 0
+            }
+            if j < len(b) && isDigit(b[j]) {
+                bc = 0
+            }
+            if ac != bc {
+                return sign(ac - bc)
+            }
+            i++
+            j++
+        }
+        si := i
+        for i < len(a) && isDigit(a[i]) {
+            i++
+        }
+        sj := j
+        for j < len(b) && isDigit(b[j]) {
+            j++
+        }
+        if c := compareNumbers(a[si:i], b[sj:j]); c != 0 {
+            return c
+        }
+    }
+    return 0
+}
+
+func isDigit(c byte) bool {
+    return c >= '0' && c <= '9'
+}
+
+// compareRpm follows rpmvercmp on epoch, version and release.
+func compareRpm(a, b string) int {
+    ea, va, ra := splitRpm(a)
+    eb, vb, rb := splitRpm(b)
+    if c := compareNumbers(ea, eb); c != 0 {
+        return c
+    }
+    if c := rpmvercmp(va, vb); c != 0 {
+        return c
+    }
+    if ra == "" || rb == "" {
+        return 0
+    }
+    return rpmvercmp(ra, rb)
+}
+
+func splitRpm(v string) (epoch, version, release string) {
+    epoch = "0"
+    if i := strings.IndexByte(v, ':'); i >= 0 {
+        epoch, v = v[:i], v[i+1:]
+    }
+    if i := strings.LastIndexByte(v, '-'); i >= 0 {
+        return epoch, v[:i], v[i+1:]
+    }
+    return epoch, v, ""
+}
+
+func rpmvercmp(a, b string) int {
+    if a == b {
+        return 0
+    }
+    isAlnum := func(c byte) bool { return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+    i, j := 0, 0
+    for i < len(a) || j < len(b) {
+        for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+            i++
+        }
+        for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+            j++
+        }
+        // Tilde sorts before anything, even the end of the version.
+        at, bt := i < len(a) && a[i] == '~', j < len(b) && b[j] == '~'
+        if at || bt {
+            if !at {
+                return 1
+            }
+            if !bt {
+                return -1
+            }
+            i++
+            j++
+            continue
+        }
+        // Caret sorts after the end of the version, before anything else.
+        ac, bc := i < len(a) && a[i] == '^', j < len(b) && b[j] == '^'
+        if ac || bc {
+            switch {
+            case i >= len(a):
+                return -1
+            case j >= len(b):
+                return 1
+            case !ac:
+                return 1
+            case !bc:
+                return -1
+            }
+            i++
+            j++
+            continue
+        }
+        if i >= len(a) || j >= len(b) {
+            break
+        }
+
+        si, sj := i, j
+        numeric := isDigit(a[i])
+        in := func(c byte) bool {
+            if numeric {
+                return isDigit(c)
+            }
+            return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+        }
+        for i < len(a) && in(a[i]) {
+            i++
+        }
+        for j < len(b) && in(b[j]) {
+            j++
+        }
+        if sj == j {
+            // Segments of different types, numbers are newer.
+            if numeric {
+                return 1
+            }
+            return -1
+        }
+        var c int
+        if numeric {
+            c = compareNumbers(a[si:i], b[sj:j])
+        } else {
+            c = strings.Compare(a[si:i], b[sj:j])
+        }
+        if c != 0 {
+            return c
+        }
+    }
+    switch {
+    case i >= len(a) && j >= len(b):
+        return 0
+    case i >= len(a):
+        return -1
+    }
+    return 1
+}
+
+// apk suffixes, before and after the release.
+var apkSuffixes = map[string]int{
+    "alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+    "cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+type apkVersion struct {
+    numbers  []string
+    letter   byte
+    suffixes [][2]string // name, number
+    revision string
+}
+
+func parseApk(v string) apkVersion {
+    var out apkVersion
+    if i := strings.LastIndex(v, "-r"); i >= 0 {
+        v, out.revision = v[:i], v[i+2:]
+    }
+    parts := strings.Split(v, "_")
+    head := parts[0]
+    for _, s := range parts[1:] {
+        name := strings.TrimRightFunc(s, unicode.IsDigit)
+        out.suffixes = append(out.suffixes, [2]string{name, s[len(name):]})
+    }
+    if n := len(head); n > 0 && !isDigit(head[n-1]) {
+        out.letter, head = head[n-1], head[:n-1]
+    }
+    out.numbers = strings.Split(head, ".")
+    return out
+}
+
+// compareApk follows apk version ordering: numbers, a letter, suffixes
+// (_rc before the release, _p after) and the -r revision.
+func compareApk(a, b string) int {
+    va, vb := parseApk(a), parseApk(b)
+    for i := 0; i < len(va.numbers) && i < len(vb.numbers); i++ {
+        na, nb := va.numbers[i], vb.numbers[i]
+        var c int
+        // Later components with a leading zero compare as fractions.
+        if i > 0 && (strings.HasPrefix(na, "0") || strings.HasPrefix(nb, "0")) {
+            c = strings.Compare(na, nb)
+        } else {
+            c = compareNumbers(na, nb)
+        }
+        if c != 0 {
+            return c
+        }
+    }
+    if c := sign(len(va.numbers) - len(vb.numbers)); c != 0 {
+        return c
+    }
+    if c := sign(int(va.letter) - int(vb.letter)); c != 0 {
+        return c
+    }
+    for i := 0; i < len(va.suffixes) || i < len(vb.suffixes); i++ {
+        var sa, sb [2]string
+        if i < len(va.suffixes) {
+            sa = va.suffixes[i]
+        }
+        if i < len(vb.suffixes) {
+            sb = vb.suffixes[i]
+        }
+        if c := sign(apkSuffixes[sa[0]] - apkSuffixes[sb[0]]); c != 0 {
+            return c
+        }
+        if c := compareNumbers(sa[1], sb[1]); c != 0 {
+            return c
+        }
+    }
+    return compareNumbers(va.revision, vb.revision)
+}
+
+// pep440 is a parsed Python version, as compared by packaging.
+type pep440 struct {
+    epoch   int
+    release []int
+    pre     [2]int // phase (-3 a, -2 b, -1 rc, 0 none) and number
+    post    int    // -1 without post release
+    dev     int    // -1 without dev release
+}
+
+var pep440Pre = map[string]int{
+    "a": -3, "alpha": -3,
+    "b": -2, "beta": -2,
+    "rc": -1, "c": -1, "pre": -1, "preview": -1,
+}
+
+func parsePEP440(v string) pep440 {
+    p := pep440{post: -1, dev: -1}
+    v = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(v), "v")))
+    v, _, _ = strings.Cut(v, "+") // local versions do not order public ones
+    if i := strings.IndexByte(v, '!'); i >= 0 {
+        p.epoch, _ = strconv.Atoi(v[:i])
+        v = v[i+1:]
+    }
+
+    i := 0
+    num := func() int {
+        s := i
+        for i < len(v) && isDigit(v[i]) {
+            i++
+        }
+        n, _ := strconv.Atoi(v[s:i])
+        return n
+    }
+    for i < len(v) && isDigit(v[i]) {
+        p.release = append(p.release, num())
+        if i < len(v) && v[i] == '.' && i+1 < len(v) && isDigit(v[i+1]) {
+            i++
+            continue
+        }
+        break
+    }
+
+    word := func() string {
+        for i < len(v) && (v[i] == '.' || v[i] == '-' || v[i] == '_') {
+            i++
+        }
+        s := i
+        for i < len(v) && v[i] >= 'a' && v[i] <= 'z' {
+            i++
+        }
+        return v[s:i]
+    }
+    for i < len(v) {
+        start := i
+        w := word()
+        for i < len(v) && (v[i] == '.' || v[i] == '-' || v[i] == '_') {
+            i++
+        }
+        switch {
+        case pep440Pre[w] != 0:
+            p.pre = [2]int{pep440Pre[w], num()}
+        case w == "post" || w == "rev" || w == "r" || (w == "" && v[start] == '-'):
+            p.post = num()
+        case w == "dev":
+            p.dev = num()
+        default:
+            return p
+        }
+        if i == start {
+            return p
+        }
+    }
+    return p
+}
+
+// comparePEP440 orders Python versions: epoch, release, then dev
+// releases before pre releases before the release before post releases.
+func comparePEP440(a, b string) int {
+    pa, pb := parsePEP440(a), parsePEP440(b)
+    if c := sign(pa.epoch - pb.epoch); c != 0 {
+        return c
+    }
+    for i := 0; i < len(pa.release) || i < len(pb.release); i++ {
+        var x, y int
+        if i < len(pa.release) {
+            x = pa.release[i]
+        }
+        if i < len(pb.release) {
+            y = pb.release[i]
+        }
+        if c := sign(x - y); c != 0 {
+            return c
+        }
+    }
+    for _, pair := range [][2][]int{
+        {pa.preKey(), pb.preKey()},
+        {{pa.post}, {pb.post}},
+        {pa.devKey(), pb.devKey()},
+    } {
+        for i := range pair[0] {
+            if c := sign(pair[0][i] - pair[1][i]); c != 0 {
+                return c
+            }
+        }
+    }
+    return 0
+}
+
+// preKey sorts a bare dev release before any pre release and a release
+// without pre release after them.
+func (p pep440) preKey() []int {
+    switch {
+    case p.pre[0] == 0 && p.post < 0 && p.dev >= 0:
+        return []int{-4, 0}
+    case p.pre[0] == 0:
+        return []int{1, 0}
+    }
+    return []int{p.pre[0], p.pre[1]}
+}
+
+func (p pep440) devKey() []int {
+    if p.dev < 0 {
+        return []int{1 << 30}
+    }
+    return []int{p.dev}
+}
@@ -0,0 +1,67 @@
+package osv
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+    tests := []struct {
+        ecosystem string
+        a, b      string
+        want      int
+    }{
+        // dpkg: ~ sorts before anything, even the end of the version
+        {"Debian", "1.0~rc1", "1.0", -1},
+        {"Debian", "1.0~~", "1.0~", -1},
+        {"Debian", "1.0~rc1", "1.0~rc2", -1},
+        {"Debian", "1.0a", "1.0", 1},
+        {"Debian", "1:1.0", "2.0", 1},
+        {"Debian", "0:1.0", "1.0", 0},
+        {"Debian", "1.0-1", "1.0-2", -1},
+        {"Debian", "3.0.11-1~deb12u2", "3.0.11-1", -1},
+        {"Debian", "2.36-9+deb12u4", "2.36-9+deb12u10", -1},
+        {"Ubuntu", "1.2.10", "1.2.9", 1},
+
+        // rpm
+        {"Red Hat", "1:1.0-1.el9", "2.0-1.el9", 1},
+        {"Red Hat", "1.2.3-1.el9", "1.2.10-1.el9", -1},
+        {"Red Hat", "1.0~rc1-1", "1.0-1", -1},
+        {"Rocky Linux", "1.0-1.el9_2", "1.0-1.el9_2", 0},
+
+        // apk: _rc before the release, _p after, then -r revisions
+        {"Alpine", "1.2.3_rc1", "1.2.3", -1},
+        {"Alpine", "1.2.3_alpha", "1.2.3_beta", -1},
+        {"Alpine", "1.2.3_p1", "1.2.3", 1},
+        {"Alpine", "1.2.3_p1", "1.2.3_p2", -1},
+        {"Alpine", "1.2.3-r1", "1.2.3-r10", -1},
+        {"Alpine", "1.2.3-r5", "1.2.3_p1-r0", -1},
+        {"Alpine", "1.2.3a", "1.2.3", 1},
+        {"Wolfi", "3.1.4-r0", "3.1.4-r0", 0},
+
+        // PEP 440: dev, pre, release, post; epochs first
+        {"PyPI", "1.0.dev1", "1.0a1", -1},
+        {"PyPI", "1.0a1", "1.0b1", -1},
+        {"PyPI", "1.0rc1", "1.0", -1},
+        {"PyPI", "1.0", "1.0.post1", -1},
+        {"PyPI", "1.0.post1.dev1", "1.0.post1", -1},
+        {"PyPI", "1.0", "1.0.0", 0},
+        {"PyPI", "1!0.5", "2.0", 1},
+        {"PyPI", "1.0-1", "1.0.post1", 0},
+
+        // SemVer
+        {"npm", "1.0.0-alpha", "1.0.0", -1},
+        {"Go", "v1.2.9", "v1.2.10", -1},
+        {"crates.io", "0.10.0", "0.9.9", 1},
+
+        // generic
+        {"Maven", "1.0-beta", "1.0", -1},
+        {"Maven", "2.17.1", "2.17.10", -1},
+    }
+    for _, tt := range tests {
+        cmp := compareFunc(tt.ecosystem)
+        if got := cmp(tt.a, tt.b); got != tt.want {
+            t.Errorf("%s: compare(%q, %q) = %d, want %d", tt.ecosystem, tt.a, tt.b, got, tt.want)
+        }
+        if got := cmp(tt.b, tt.a); got != -tt.want {
+            t.Errorf("%s: compare(%q, %q) = %d, want %d", tt.ecosystem, tt.b, tt.a, got, -tt.want)
+        }
+    }
+}
@@ -0,0 +1,217 @@
+package policy
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/google/go-containerregistry/pkg/name"
+)
+
+// Rule identifiers used in gate results.
+const (
+    RuleMisconfigurations = "misconfigurations"
+    RuleVulnerabilities   = "vulnerabilities"
+    RuleSignatures        = "signatures"
+    RuleSLSA              = "slsa_level"
+    RuleBannedRegistries  = "banned_registries"
+    RuleImageAge          = "max_image_age"
+)
+
+// Input is what the gate is evaluated against.
+type Input struct {
+    // Misconfigurations per severity across the chart.
+    Misconfigurations map[string]int
+    Images            []Image
+}
+
+// Image is the per image evidence gathered by the aggregator jobs.
+type Image struct {
+    Name     string
+    Vulns    map[string]int // per severity, nil when the scan is missing
+    Signed   bool
+    SignedBy []string
+    // SLSALevel is 0 when no provenance attestation was verified.
+    SLSALevel int
+    // Created is zero when the image config could not be read.
+    Created time.Time
+}
+
+// RuleResult is the outcome of one rule against one target.
+type RuleResult struct {
+    Rule    string `json:"rule"`
+    Target  string `json:"target"` // "chart" or an image reference
+    Passed  bool   `json:"passed"`
+    Skipped bool   `json:"skipped,omitempty"` // not enough evidence to decide
+    Reason  string `json:"reason"`
+}
+
+// Result is the gate decision with every rule evaluated.
+type Result struct {
+    Passed    bool         `json:"passed"`
+    Policy    *Policy      `json:"policy"`
+    Rules     []RuleResult `json:"rules"`
+    Failures  []string     `json:"failures"` // why the gate failed
+    Evaluated time.Time    `json:"evaluated"`
+}
+
+// Evaluate applies p to in. now is used for the image age rule.
+func Evaluate(p *Policy, in Input, now time.Time) *Result {
+    res := &Result{Policy: p, Evaluated: now, Rules: []RuleResult{}, Failures: []string{}}
+
+    if len(p.Misconfigurations) > 0 {
+        res.add(thresholdRule(RuleMisconfigurations, "chart", p.Misconfigurations, in.Misconfigurations))
+    }
+
+    for _, img := range in.Images {
+        if len(p.Vulnerabilities) > 0 {
+            if img.Vulns == nil {
+                res.add(missingEvidence(p, RuleVulnerabilities, img.Name, "no vulnerability report"))
+            } else {
+                res.add(thresholdRule(RuleVulnerabilities, img.Name, p.Vulnerabilities, img.Vulns))
+            }
+        }
+        if p.Signatures.Required {
+            res.add(signatureRule(p, img))
+        }
+        if p.SLSALevel > 0 {
+            res.add(slsaRule(p, img))
+        }
+        if len(p.BannedRegistries) > 0 {
+            res.add(registryRule(p, img))
+        }
+        if p.MaxImageAgeDays > 0 {
+            res.add(ageRule(p, img, now))
+        }
+    }
+
+    res.Passed = len(res.Failures) == 0
+    return res
+}
+
+func (r *Result) add(rr RuleResult) {
+    r.Rules = append(r.Rules, rr)
+    if !rr.Passed {
+        r.Failures = append(r.Failures, fmt.Sprintf("%s [%s]: %s", rr.Rule, rr.Target, rr.Reason))
+    }
+}
+
+// missingEvidence decides a rule the image lacks the evidence for,
+// failing unless the policy skips such rules.
+func missingEvidence(p *Policy, rule, target, reason string) RuleResult {
+    r := RuleResult{Rule: rule, Target: target, Skipped: true, Reason: reason}
+    if p.OnMissingEvidence == "skip" {
+        r.Passed = true
+    }
+    return r
+}
+
+func thresholdRule(rule, target string, limits Thresholds, counts map[string]int) RuleResult {
+    var exceeded, within []string
+    for _, sev := range Severities {
+        max, ok := limits[sev]
+        if !ok {
+            continue
+        }
+        if n := counts[sev]; n > max {
+            exceeded = append(exceeded, fmt.Sprintf("%d %s (max %d)", n, sev, max))
+        } else {
+            within = append(within, fmt.Sprintf("%d %s (max %d)", n, sev, max))
+        }
+    }
+
+    if len(exceeded) > 0 {
+        return RuleResult{Rule: rule, Target: target, Reason: "exceeded: " + strings.Join(exceeded, ", ")}
+    }
+    return RuleResult{Rule: rule, Target: target, Passed: true, Reason: strings.Join(within, ", ")}
+}
+
+func signatureRule(p *Policy, img Image) RuleResult {
+    r := RuleResult{Rule: RuleSignatures, Target: img.Name}
+    if !img.Signed {
+        r.Reason = "image has no verified signature"
+        return r
+    }
+    if len(p.Signatures.Schemes) == 0 {
+        r.Passed = true
+        r.Reason = "signed with " + strings.Join(img.SignedBy, ", ")
+        return r
+    }
+    for _, want := range p.Signatures.Schemes {
+        for _, have := range img.SignedBy {
+            if strings.EqualFold(want, have) {
+                r.Passed = true
+                r.Reason = "signed with " + have
+                return r
+            }
+        }
+    }
+    r.Reason = fmt.Sprintf("signed with %s, policy accepts %s",
+        strings.Join(img.SignedBy, ", "), strings.Join(p.Signatures.Schemes, ", "))
+    return r
+}
+
+func slsaRule(p *Policy, img Image) RuleResult {
+    r := RuleResult{Rule: RuleSLSA, Target: img.Name}
+    if img.SLSALevel >= p.SLSALevel {
+        r.Passed = true
+        r.Reason = fmt.Sprintf("SLSA level %d", img.SLSALevel)
+        return r
+    }
+    if img.SLSALevel == 0 {
+        r.Reason = fmt.Sprintf("no verified SLSA provenance, level %d required", p.SLSALevel)
+    } else {
+        r.Reason = fmt.Sprintf("SLSA level %d below required %d", img.SLSALevel, p.SLSALevel)
+    }
+    return r
+}
+
+func registryRule(p *Policy, img Image) RuleResult {
+    r := RuleResult{Rule: RuleBannedRegistries, Target: img.Name}
+
+    ref, err := name.ParseReference(img.Name)
+    if err != nil {
+        r.Reason = fmt.Sprintf("unparseable image reference: %v", err)
+        return r
+    }
+    repo := ref.Context().Name()
+
+    for _, banned := range p.BannedRegistries {
+        b := normalizeRegistry(banned)
+        if repo == b || strings.HasPrefix(repo, b+"/") {
+            r.Reason = fmt.Sprintf("pulled from banned registry %s", banned)
+            return r
+        }
+    }
+    r.Passed = true
+    r.Reason = "pulled from " + ref.Context().RegistryStr()
+    return r
+}
+
+// normalizeRegistry maps the Docker Hub aliases to the name
+// go-containerregistry resolves them to.
+func normalizeRegistry(reg string) string {
+    reg = strings.TrimSuffix(reg, "/")
+    for _, alias := range []string{"docker.io", "registry-1.docker.io"} {
+        if reg == alias || strings.HasPrefix(reg, alias+"/") {
+            return name.DefaultRegistry + strings.TrimPrefix(reg, alias)
+        }
+    }
+    return reg
+}
+
+func ageRule(p *Policy, img Image, now time.Time) RuleResult {
+    r := RuleResult{Rule: RuleImageAge, Target: img.Name}
+    if img.Created.IsZero() {
+        return missingEvidence(p, RuleImageAge, img.Name, "image creation time unknown")
+    }
+
+    age := int(now.Sub(img.Created).Hours() / 24)
+    if age > p.MaxImageAgeDays {
+        r.Reason = fmt.Sprintf("built %d days ago (%s), max %d", age, img.Created.Format("2006-01-02"), p.MaxImageAgeDays)
+        return r
+    }
+    r.Passed = true
+    r.Reason = fmt.Sprintf("built %d days ago", age)
+    return r
+}
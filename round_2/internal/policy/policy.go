@@ -0,0 +1,132 @@
+package policy
+
+import (
+    "bytes"
+    "fmt"
+    "os"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// Severities in decreasing order, as reported by Trivy.
+var Severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// Thresholds is the maximum number of findings allowed per severity.
+// Severities left out are not limited.
+type Thresholds map[string]int
+
+// Policy is the declarative gate definition, loaded from YAML:
+//
+//	misconfigurations:
+//	  CRITICAL: 0
+//	vulnerabilities:
+//	  CRITICAL: 0
+//	  HIGH: 20
+//	signatures:
+//	  required: true
+//	  schemes: [cosign]
+//	slsa_level: 2
+//	banned_registries: [docker.io]
+//	max_image_age_days: 365
+//	on_missing_evidence: fail
+type Policy struct {
+    // Misconfigurations limits Trivy config findings for the whole chart.
+    Misconfigurations Thresholds `yaml:"misconfigurations" json:"misconfigurations,omitempty"`
+    // Vulnerabilities limits CVEs per image.
+    Vulnerabilities Thresholds `yaml:"vulnerabilities" json:"vulnerabilities,omitempty"`
+
+    Signatures struct {
+        Required bool `yaml:"required" json:"required"`
+        // Schemes accepted as proof of signing, any when empty.
+        Schemes []string `yaml:"schemes" json:"schemes,omitempty"`
+    } `yaml:"signatures" json:"signatures"`
+
+    // SLSALevel is the minimum SLSA build level required per image.
+    SLSALevel int `yaml:"slsa_level" json:"slsa_level,omitempty"`
+
+    // BannedRegistries lists registries, or registry/repository prefixes,
+    // images must not be pulled from.
+    BannedRegistries []string `yaml:"banned_registries" json:"banned_registries,omitempty"`
+
+    // MaxImageAgeDays rejects images built longer ago than this.
+    MaxImageAgeDays int `yaml:"max_image_age_days" json:"max_image_age_days,omitempty"`
+
+    // OnMissingEvidence decides rules an image has no evidence for, such
+    // as a failed scan: "fail" (the default) or "skip".
+    OnMissingEvidence string `yaml:"on_missing_evidence" json:"on_missing_evidence,omitempty"`
+}
+
+// Default keeps the historical behaviour of the auditor: fail on any
+// critical misconfiguration.
+func Default() *Policy {
+    return &Policy{
+        Misconfigurations: Thresholds{"CRITICAL": 0},
+    }
+}
+
+// Load reads a policy file.
+func Load(path string) (*Policy, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("reading policy: %w", err)
+    }
+
+    p := &Policy{}
+    dec := yaml.NewDecoder(bytes.NewReader(data))
+    dec.KnownFields(true)
+    if err := dec.Decode(p); err != nil {
+        return nil, fmt.Errorf("parsing policy %s: %w", path, err)
+    }
+    if err := p.validate(); err != nil {
+        return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+    }
+    return p, nil
+}
+
+func (p *Policy) validate() error {
+    var err error
+    if p.Misconfigurations, err = normalize(p.Misconfigurations); err != nil {
+        return fmt.Errorf("misconfigurations: %w", err)
+    }
+    if p.Vulnerabilities, err = normalize(p.Vulnerabilities); err != nil {
+        return fmt.Errorf("vulnerabilities: %w", err)
+    }
+    if p.SLSALevel < 0 || p.SLSALevel > 4 {
+        return fmt.Errorf("slsa_level must be between 0 and 4")
+    }
+    if p.MaxImageAgeDays < 0 {
+        return fmt.Errorf("max_image_age_days must not be negative")
+    }
+    switch p.OnMissingEvidence {
+    case "", "fail", "skip":
+    default:
+        return fmt.Errorf("on_missing_evidence must be fail or skip")
+    }
+    return nil
+}
+
+// normalize upper cases severities and rejects unknown ones.
+func normalize(t Thresholds) (Thresholds, error) {
+    out := Thresholds{}
+    for sev, max := range t {
+        sev = strings.ToUpper(sev)
+        if !isSeverity(sev) {
+            return nil, fmt.Errorf("unknown severity %q", sev)
+        }
+        if max < 0 {
+            return nil, fmt.Errorf("negative threshold for %s", sev)
+        }
+        out[sev] = max
+    }
+    return out, nil
+}
+
+func isSeverity(s string) bool {
+    for _, sev := range Severities {
+        if s == sev {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,74 @@
+package provenance
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/google/go-containerregistry/pkg/name"
+    "github.com/sigstore/cosign/v2/pkg/cosign"
+    "github.com/sigstore/cosign/v2/pkg/oci"
+    "helm-auditor/internal/types"
+)
+
+const schemeCosign = "cosign"
+
+// cosignVerifier verifies cosign signatures stored under the
+// sha256-<digest>.sig tag and checks their Rekor entries.
+type cosignVerifier struct {
+    cfg  Config
+    keys *cosign.TrustedTransparencyLogPubKeys
+}
+
+func (v *cosignVerifier) Scheme() string {
+    return schemeCosign
+}
+
+func (v *cosignVerifier) Verify(ctx context.Context, ref name.Reference) ([]types.SignatureResult, []string, error) {
+    opts := &cosign.CheckOpts{RekorPubKeys: v.keys}
+    sigs, bundle, err := cosign.VerifyImageSignatures(ctx, ref, opts)
+    if err != nil {
+        return nil, nil, err
+    }
+    fmt.Printf("[provenance] Signatures verified: %d, bundle verified: %t\n", len(sigs), bundle)
+
+    var results []types.SignatureResult
+    var warnings []string
+    for i, s := range sigs {
+        b64, _ := s.Base64Signature()
+
+        signer, err := signerIdentity(s)
+        if err != nil {
+            fmt.Printf("[provenance] WARNING: signer of signature %d unknown: %v\n", i, err)
+        }
+
+        tlog := checkTlog(ctx, s, v.keys, v.cfg)
+        if !tlog.Present {
+            warnings = append(warnings, fmt.Sprintf("signature %d has no transparency log entry", i))
+        } else if tlog.Error != "" {
+            warnings = append(warnings, fmt.Sprintf("signature %d tlog entry %d: %s", i, tlog.LogIndex, tlog.Error))
+        }
+
+        results = append(results, types.SignatureResult{
+            Scheme:    schemeCosign,
+            Signature: b64,
+            Signer:    signer,
+            Tlog:      tlog,
+        })
+    }
+
+    return results, warnings, nil
+}
+
+// verifyAttestationsSafe wraps cosign attestation verification and never
+// panics. Returns nil if verification fails.
+func verifyAttestationsSafe(ctx context.Context, ref name.Reference, keys *cosign.TrustedTransparencyLogPubKeys) []oci.Signature {
+    opts := &cosign.CheckOpts{RekorPubKeys: keys}
+    attes, attBundle, err := cosign.VerifyImageAttestations(ctx, ref, opts)
+    if err != nil {
+        fmt.Printf("[provenance] WARNING: attestations not verified for %s: %v\n", ref, err)
+        return nil
+    }
+    fmt.Printf("[provenance] Attestations verified: %d, bundle verified: %t\n", len(attes), attBundle)
+
+    return attes
+}
@@ -0,0 +1,316 @@
+package provenance
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/google/go-containerregistry/pkg/name"
+    "github.com/google/go-containerregistry/pkg/v1/remote"
+    "helm-auditor/internal/types"
+)
+
+const (
+    schemeNotation = "notation"
+
+    notationArtifactType  = "application/vnd.cncf.notary.signature"
+    notationJWSMediaType  = "application/jose+json"
+    notationCOSEMediaType = "application/cose"
+)
+
+// notationVerifier verifies Notary Project signatures discovered through
+// the OCI referrers API against an X.509 trust store.
+type notationVerifier struct {
+    // trustStore is a directory of PEM encoded root certificates.
+    trustStore string
+}
+
+// jwsEnvelope is the JWS JSON serialization Notation stores as the
+// signature layer.
+type jwsEnvelope struct {
+    Payload   string `json:"payload"`
+    Protected string `json:"protected"`
+    Header    struct {
+        CertChain [][]byte `json:"x5c"`
+    } `json:"header"`
+    Signature string `json:"signature"`
+}
+
+type jwsProtectedHeader struct {
+    Algorithm   string     `json:"alg"`
+    ContentType string     `json:"cty"`
+    SigningTime *time.Time `json:"io.cncf.notary.signingTime,omitempty"`
+    Expiry      *time.Time `json:"io.cncf.notary.expiry,omitempty"`
+}
+
+type notationPayload struct {
+    TargetArtifact struct {
+        MediaType string `json:"mediaType"`
+        Digest    string `json:"digest"`
+        Size      int64  `json:"size"`
+    } `json:"targetArtifact"`
+}
+
+func (v *notationVerifier) Scheme() string {
+    return schemeNotation
+}
+
+func (v *notationVerifier) Verify(ctx context.Context, ref name.Reference) ([]types.SignatureResult, []string, error) {
+    opts := remoteOptions(ctx)
+
+    desc, err := remote.Head(ref, opts...)
+    if err != nil {
+        return nil, nil, fmt.Errorf("resolving digest: %w", err)
+    }
+    digest := ref.Context().Digest(desc.Digest.String())
+
+    index, err := remote.Referrers(digest, append(opts, remote.WithFilter("artifactType", notationArtifactType))...)
+    if err != nil {
+        return nil, nil, fmt.Errorf("listing referrers: %w", err)
+    }
+    manifest, err := index.IndexManifest()
+    if err != nil {
+        return nil, nil, fmt.Errorf("reading referrers: %w", err)
+    }
+
+    var roots *x509.CertPool
+    var warnings []string
+    var results []types.SignatureResult
+    for _, m := range manifest.Manifests {
+        if m.ArtifactType != notationArtifactType {
+            continue
+        }
+        if roots == nil {
+            if roots, err = loadTrustStore(v.trustStore); err != nil {
+                return nil, []string{fmt.Sprintf("notation signature %s found but not verified: %v", m.Digest, err)}, nil
+            }
+        }
+
+        res, err := v.verifySignature(digest, m.Digest.String(), desc.Digest.String(), roots, opts)
+        if err != nil {
+            warnings = append(warnings, fmt.Sprintf("notation signature %s rejected: %v", m.Digest, err))
+            continue
+        }
+        results = append(results, *res)
+    }
+
+    return results, warnings, nil
+}
+
+// verifySignature fetches one signature manifest and verifies its
+// envelope against the image digest.
+func (v *notationVerifier) verifySignature(image name.Digest, sigDigest, want string, roots *x509.CertPool, opts []remote.Option) (*types.SignatureResult, error) {
+    img, err := remote.Image(image.Context().Digest(sigDigest), opts...)
+    if err != nil {
+        return nil, fmt.Errorf("fetching signature manifest: %w", err)
+    }
+    layers, err := img.Layers()
+    if err != nil || len(layers) == 0 {
+        return nil, errors.New("signature manifest has no envelope")
+    }
+    mt, err := layers[0].MediaType()
+    if err != nil {
+        return nil, err
+    }
+    switch mt {
+    case notationJWSMediaType:
+    case notationCOSEMediaType:
+        return nil, errors.New("COSE envelopes are not supported")
+    default:
+        return nil, fmt.Errorf("unknown envelope type %s", mt)
+    }
+
+    rc, err := layers[0].Compressed()
+    if err != nil {
+        return nil, err
+    }
+    defer rc.Close()
+    raw, err := io.ReadAll(rc)
+    if err != nil {
+        return nil, err
+    }
+
+    var env jwsEnvelope
+    if err := json.Unmarshal(raw, &env); err != nil {
+        return nil, fmt.Errorf("decoding envelope: %w", err)
+    }
+    leaf, err := verifyJWS(env, want, roots)
+    if err != nil {
+        return nil, err
+    }
+
+    return &types.SignatureResult{
+        Scheme:    schemeNotation,
+        Signature: env.Signature,
+        Signer:    identityFromCert(leaf),
+    }, nil
+}
+
+// verifyJWS checks the certificate chain, the envelope signature and that
+// the signed payload targets the expected digest. Returns the signing cert.
+func verifyJWS(env jwsEnvelope, digest string, roots *x509.CertPool) (*x509.Certificate, error) {
+    if len(env.Header.CertChain) == 0 {
+        return nil, errors.New("envelope has no certificate chain")
+    }
+
+    protectedRaw, err := base64.RawURLEncoding.DecodeString(env.Protected)
+    if err != nil {
+        return nil, fmt.Errorf("decoding protected header: %w", err)
+    }
+    var hdr jwsProtectedHeader
+    if err := json.Unmarshal(protectedRaw, &hdr); err != nil {
+        return nil, fmt.Errorf("parsing protected header: %w", err)
+    }
+
+    var certs []*x509.Certificate
+    for _, der := range env.Header.CertChain {
+        c, err := x509.ParseCertificate(der)
+        if err != nil {
+            return nil, fmt.Errorf("parsing certificate: %w", err)
+        }
+        certs = append(certs, c)
+    }
+    leaf := certs[0]
+
+    intermediates := x509.NewCertPool()
+    for _, c := range certs[1:] {
+        intermediates.AddCert(c)
+    }
+    // The signing time is chosen by the signer, without a timestamp
+    // countersignature the chain must be valid now.
+    if _, err := leaf.Verify(x509.VerifyOptions{
+        Roots:         roots,
+        Intermediates: intermediates,
+        CurrentTime:   time.Now(),
+        KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+    }); err != nil {
+        return nil, fmt.Errorf("untrusted certificate chain: %w", err)
+    }
+    if hdr.Expiry != nil && time.Now().After(*hdr.Expiry) {
+        return nil, fmt.Errorf("signature expired at %s", hdr.Expiry)
+    }
+
+    sig, err := base64.RawURLEncoding.DecodeString(env.Signature)
+    if err != nil {
+        return nil, fmt.Errorf("decoding signature: %w", err)
+    }
+    signingInput := []byte(env.Protected + "." + env.Payload)
+    if err := verifyJWSSignature(hdr.Algorithm, leaf.PublicKey, signingInput, sig); err != nil {
+        return nil, err
+    }
+
+    payloadRaw, err := base64.RawURLEncoding.DecodeString(env.Payload)
+    if err != nil {
+        return nil, fmt.Errorf("decoding payload: %w", err)
+    }
+    var payload notationPayload
+    if err := json.Unmarshal(payloadRaw, &payload); err != nil {
+        return nil, fmt.Errorf("parsing payload: %w", err)
+    }
+    if payload.TargetArtifact.Digest != digest {
+        return nil, fmt.Errorf("signature targets %s, not %s", payload.TargetArtifact.Digest, digest)
+    }
+
+    return leaf, nil
+}
+
+// verifyJWSSignature supports the algorithms allowed by the Notary Project
+// signature specification.
+func verifyJWSSignature(alg string, pub crypto.PublicKey, input, sig []byte) error {
+    var h crypto.Hash
+    var curve elliptic.Curve
+    switch alg {
+    case "PS256", "ES256":
+        h, curve = crypto.SHA256, elliptic.P256()
+    case "PS384", "ES384":
+        h, curve = crypto.SHA384, elliptic.P384()
+    case "PS512", "ES512":
+        h, curve = crypto.SHA512, elliptic.P521()
+    default:
+        return fmt.Errorf("unsupported algorithm %q", alg)
+    }
+    hasher := h.New()
+    hasher.Write(input)
+    digest := hasher.Sum(nil)
+
+    switch key := pub.(type) {
+    case *rsa.PublicKey:
+        if alg[0] != 'P' {
+            return fmt.Errorf("algorithm %s does not match RSA key", alg)
+        }
+        if err := rsa.VerifyPSS(key, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+            return fmt.Errorf("invalid signature: %w", err)
+        }
+    case *ecdsa.PublicKey:
+        if alg[0] != 'E' || key.Curve != curve {
+            return fmt.Errorf("algorithm %s does not match ECDSA key", alg)
+        }
+        if size := (curve.Params().BitSize + 7) / 8; len(sig) != 2*size {
+            return fmt.Errorf("invalid %s signature length %d", alg, len(sig))
+        }
+        r := new(big.Int).SetBytes(sig[:len(sig)/2])
+        s := new(big.Int).SetBytes(sig[len(sig)/2:])
+        if !ecdsa.Verify(key, digest, r, s) {
+            return errors.New("invalid signature")
+        }
+    default:
+        return fmt.Errorf("unsupported key type %T", pub)
+    }
+    return nil
+}
+
+// loadTrustStore reads every PEM certificate found in dir.
+func loadTrustStore(dir string) (*x509.CertPool, error) {
+    if dir == "" {
+        return nil, errors.New("no notation trust store configured")
+    }
+
+    pool := x509.NewCertPool()
+    found := 0
+    err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+        if err != nil || d.IsDir() {
+            return err
+        }
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return err
+        }
+        for {
+            var block *pem.Block
+            block, data = pem.Decode(data)
+            if block == nil {
+                break
+            }
+            if block.Type != "CERTIFICATE" {
+                continue
+            }
+            c, err := x509.ParseCertificate(block.Bytes)
+            if err != nil {
+                return fmt.Errorf("%s: %w", path, err)
+            }
+            pool.AddCert(c)
+            found++
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("reading trust store: %w", err)
+    }
+    if found == 0 {
+        return nil, fmt.Errorf("trust store %s has no certificates", dir)
+    }
+    return pool, nil
+}
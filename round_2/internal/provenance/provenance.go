@@ -6,32 +6,86 @@ import (
     "fmt"
     "os"
     "path/filepath"
+    "time"
 
-    "github.com/sigstore/cosign/v2/pkg/cosign"
-    "github.com/sigstore/cosign/v2/pkg/oci"
     "github.com/google/go-containerregistry/pkg/name"
+    "github.com/google/go-containerregistry/pkg/v1/remote"
+    "github.com/sigstore/cosign/v2/pkg/oci"
     "helm-auditor/internal/types"
 )
 
+// Config tunes how the provenor verifies images.
+type Config struct {
+    // RekorURL is the Rekor compatible log queried for inclusion proofs.
+    // Empty skips the online check and only the bundled SET is verified.
+    RekorURL string
+    // RekorPublicKey is a PEM file with the log public key. Empty falls
+    // back to the keys distributed through the sigstore TUF root.
+    RekorPublicKey string
+    // NotationTrustStore is a directory of PEM root certificates trusted
+    // for Notation signatures.
+    NotationTrustStore string
+}
+
 // Run executes verification and writes reports to reportDir
-func Run(imageRef, reportDir string) error {
+func Run(imageRef, reportDir string, cfg Config) error {
     ctx := context.Background()
 
-    sigs, attes := verifyImageSafe(ctx, imageRef)
+    keys, err := rekorKeys(ctx, cfg)
+    if err != nil {
+        fmt.Printf("[provenance] WARNING: rekor keys unavailable: %v\n", err)
+    }
 
     if err := os.MkdirAll(reportDir, 0o755); err != nil {
         return fmt.Errorf("creating report dir: %w", err)
     }
 
+    result := types.ProvenanceResult{
+        Image:      imageRef,
+        Signatures: []types.SignatureResult{},
+        VerifiedBy: []string{},
+        Artifacts:  []types.ReferrerArtifact{},
+    }
+
+    var attes []oci.Signature
+    ref, err := name.ParseReference(imageRef)
+    if err != nil {
+        fmt.Printf("[provenance] WARNING: parsing reference failed: %v\n", err)
+    } else {
+        for _, v := range verifiers(cfg, keys) {
+            sigs, warnings, err := v.Verify(ctx, ref)
+            if err != nil {
+                fmt.Printf("[provenance] WARNING: %s signatures not verified for %s: %v\n", v.Scheme(), imageRef, err)
+                continue
+            }
+            result.Warnings = append(result.Warnings, warnings...)
+            if len(sigs) > 0 {
+                result.VerifiedBy = append(result.VerifiedBy, v.Scheme())
+                result.Signatures = append(result.Signatures, sigs...)
+            }
+        }
+        attes = verifyAttestationsSafe(ctx, ref, keys)
+
+        digest, artifacts, warnings, err := discoverArtifacts(ctx, ref)
+        result.Warnings = append(result.Warnings, warnings...)
+        if err != nil {
+            fmt.Printf("[provenance] WARNING: artifact discovery failed for %s: %v\n", imageRef, err)
+            result.Warnings = append(result.Warnings, fmt.Sprintf("artifact discovery failed: %v", err))
+        }
+        result.Digest = digest
+        if artifacts != nil {
+            result.Artifacts = artifacts
+        }
+        result.Created = imageCreated(ctx, ref)
+        result.SLSA = slsaProvenance(attes)
+    }
+    result.Signed = len(result.VerifiedBy) > 0
+
     // Save signatures
     sigFile := filepath.Join(reportDir, "signatures.json")
     sigStrings := []string{}
-    if sigs != nil {
-        sigStrings = make([]string, len(sigs))
-        for i, s := range sigs {
-            b, _ := s.Base64Signature()
-            sigStrings[i] = string(b)
-        }
+    for _, s := range result.Signatures {
+        sigStrings = append(sigStrings, s.Signature)
     }
     sigBytes, _ := json.MarshalIndent(sigStrings, "", "  ")
     if err := os.WriteFile(sigFile, sigBytes, 0o644); err != nil {
@@ -69,36 +123,27 @@ func Run(imageRef, reportDir string) error {
         return fmt.Errorf("writing attestations: %w", err)
     }
 
+    result.Attestations = attResults
+    resBytes, _ := json.MarshalIndent(result, "", "  ")
+    resFile := filepath.Join(reportDir, "provenance.json")
+    if err := os.WriteFile(resFile, resBytes, 0o644); err != nil {
+        return fmt.Errorf("writing provenance result: %w", err)
+    }
+
     fmt.Printf("[provenance] Reports written to: %s\n", reportDir)
     return nil
 }
 
-// verifyImageSafe wraps cosign verification and never panics.
-// Returns nil slices if verification fails.
-func verifyImageSafe(ctx context.Context, imageRef string) ([]oci.Signature, []oci.Signature) {
-    ref, err := name.ParseReference(imageRef)
-    if err != nil {
-        fmt.Printf("[provenance] WARNING: parsing reference failed: %v\n", err)
-        return nil, nil
-    }
-
-    opts := &cosign.CheckOpts{} // default, safe
-    sigs, bundle, err := cosign.VerifyImageSignatures(ctx, ref, opts)
+// imageCreated reads the creation time from the image config. Returns the
+// zero time when the image cannot be fetched.
+func imageCreated(ctx context.Context, ref name.Reference) time.Time {
+    img, err := remote.Image(ref, remoteOptions(ctx)...)
     if err != nil {
-        fmt.Printf("[provenance] WARNING: signatures not verified for %s: %v\n", imageRef, err)
-        sigs = nil
-    } else {
-        fmt.Printf("[provenance] Signatures verified: %v, bundle: %v\n", sigs, bundle)
+        return time.Time{}
     }
-
-    attes, attBundle, err := cosign.VerifyImageAttestations(ctx, ref, opts)
+    cfg, err := img.ConfigFile()
     if err != nil {
-        fmt.Printf("[provenance] WARNING: attestations not verified for %s: %v\n", imageRef, err)
-        attes = nil
-    } else {
-        fmt.Printf("[provenance] Attestations verified: %v, bundle: %v\n", attes, attBundle)
+        return time.Time{}
     }
-
-    return sigs, attes
+    return cfg.Created.Time
 }
-
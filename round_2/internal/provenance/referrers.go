@@ -0,0 +1,128 @@
+package provenance
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/google/go-containerregistry/pkg/name"
+    v1 "github.com/google/go-containerregistry/pkg/v1"
+    "github.com/google/go-containerregistry/pkg/v1/remote"
+    "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+    "helm-auditor/internal/types"
+)
+
+// Artifact kinds reported for referrers.
+const (
+    ArtifactSignature   = "signature"
+    ArtifactAttestation = "attestation"
+    ArtifactSBOM        = "sbom"
+    ArtifactVEX         = "vex"
+    ArtifactScanResult  = "scan-result"
+    ArtifactOther       = "other"
+)
+
+// artifactKinds maps known artifact (or config) media types to a kind.
+// Media type parameters such as ;version=0.2 are ignored.
+var artifactKinds = map[string]string{
+    "application/vnd.cncf.notary.signature":              ArtifactSignature,
+    "application/vnd.dev.cosign.artifact.sig.v1+json":    ArtifactSignature,
+    "application/vnd.dev.cosign.simplesigning.v1+json":   ArtifactSignature,
+    "application/vnd.dev.sigstore.bundle":                ArtifactSignature,
+    "application/vnd.dev.sigstore.bundle.v0.3+json":      ArtifactSignature,
+    "application/vnd.in-toto+json":                       ArtifactAttestation,
+    "application/vnd.dsse.envelope.v1+json":              ArtifactAttestation,
+    "application/vnd.dev.cosign.attestation.v1+json":     ArtifactAttestation,
+    "application/spdx+json":                              ArtifactSBOM,
+    "text/spdx":                                          ArtifactSBOM,
+    "text/spdx+json":                                     ArtifactSBOM,
+    "application/vnd.cyclonedx+json":                     ArtifactSBOM,
+    "application/vnd.cyclonedx+xml":                      ArtifactSBOM,
+    "application/vnd.syft+json":                          ArtifactSBOM,
+    "application/vnd.openvex+json":                       ArtifactVEX,
+    "application/csaf+json":                              ArtifactVEX,
+    "application/sarif+json":                             ArtifactScanResult,
+    "application/vnd.aquasec.trivy.report+json":          ArtifactScanResult,
+    "application/vnd.security.vulnerability.report+json": ArtifactScanResult,
+}
+
+// cosignTagSuffixes are the tags cosign attaches next to an image when the
+// registry has no referrers support.
+var cosignTagSuffixes = []struct{ suffix, kind string }{
+    {".sig", ArtifactSignature},
+    {".att", ArtifactAttestation},
+    {".sbom", ArtifactSBOM},
+}
+
+// artifactKind classifies an artifact type.
+func artifactKind(artifactType string) string {
+    mt := strings.TrimSpace(strings.SplitN(artifactType, ";", 2)[0])
+    if k, ok := artifactKinds[mt]; ok {
+        return k
+    }
+    return ArtifactOther
+}
+
+// discoverArtifacts lists everything attached to the image digest: OCI 1.1
+// referrers (the library falls back to the sha256-<hex> tag schema when the
+// registry lacks the API) plus cosign's tag convention. Lookups that fail
+// for another reason than a missing artifact are returned as warnings.
+func discoverArtifacts(ctx context.Context, ref name.Reference) (string, []types.ReferrerArtifact, []string, error) {
+    opts := remoteOptions(ctx)
+
+    desc, err := remote.Head(ref, opts...)
+    if err != nil {
+        return "", nil, nil, fmt.Errorf("resolving digest: %w", err)
+    }
+    digest := ref.Context().Digest(desc.Digest.String())
+
+    artifacts := []types.ReferrerArtifact{}
+    var warnings []string
+
+    index, err := remote.Referrers(digest, opts...)
+    var manifest *v1.IndexManifest
+    if err == nil {
+        manifest, err = index.IndexManifest()
+    }
+    if err != nil {
+        fmt.Printf("[provenance] WARNING: listing referrers for %s: %v\n", digest, err)
+        warnings = append(warnings, fmt.Sprintf("listing referrers: %v", err))
+    } else {
+        for _, m := range manifest.Manifests {
+            artifactType := m.ArtifactType
+            if artifactType == "" {
+                artifactType = string(m.MediaType)
+            }
+            artifacts = append(artifacts, types.ReferrerArtifact{
+                Digest:       m.Digest.String(),
+                ArtifactType: artifactType,
+                Kind:         artifactKind(artifactType),
+                Source:       "referrers",
+                Annotations:  m.Annotations,
+            })
+        }
+    }
+
+    prefix := strings.Replace(desc.Digest.String(), ":", "-", 1)
+    for _, c := range cosignTagSuffixes {
+        tag := ref.Context().Tag(prefix + c.suffix)
+        d, err := remote.Head(tag, opts...)
+        if err != nil {
+            var terr *transport.Error
+            if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+                warnings = append(warnings, fmt.Sprintf("looking up %s: %v", tag, err))
+            }
+            continue
+        }
+        artifacts = append(artifacts, types.ReferrerArtifact{
+            Digest:       d.Digest.String(),
+            ArtifactType: string(d.MediaType),
+            Kind:         c.kind,
+            Source:       "tag:" + tag.TagStr(),
+        })
+    }
+
+    return desc.Digest.String(), artifacts, warnings, nil
+}
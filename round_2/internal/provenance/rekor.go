@@ -0,0 +1,127 @@
+package provenance
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/sigstore/cosign/v2/pkg/cosign"
+    "github.com/sigstore/cosign/v2/pkg/oci"
+    "github.com/sigstore/rekor/pkg/generated/models"
+    "github.com/sigstore/sigstore/pkg/tuf"
+    "helm-auditor/internal/types"
+)
+
+// rekorKeys loads the log public keys the SETs and checkpoints are
+// verified against.
+func rekorKeys(ctx context.Context, cfg Config) (*cosign.TrustedTransparencyLogPubKeys, error) {
+    if cfg.RekorPublicKey == "" {
+        return cosign.GetRekorPubs(ctx)
+    }
+
+    pem, err := os.ReadFile(cfg.RekorPublicKey)
+    if err != nil {
+        return nil, fmt.Errorf("reading rekor public key: %w", err)
+    }
+    keys := cosign.NewTrustedTransparencyLogPubKeys()
+    if err := keys.AddTransparencyLogPubKey(pem, tuf.Active); err != nil {
+        return nil, fmt.Errorf("parsing rekor public key: %w", err)
+    }
+    return &keys, nil
+}
+
+// checkTlog inspects the Rekor bundle attached to sig. Signatures without a
+// bundle are reported with Present set to false so they can be flagged.
+func checkTlog(ctx context.Context, sig oci.Signature, keys *cosign.TrustedTransparencyLogPubKeys, cfg Config) *types.TransparencyLogEntry {
+    entry := &types.TransparencyLogEntry{}
+
+    b, err := sig.Bundle()
+    if err != nil {
+        entry.Error = fmt.Sprintf("reading bundle: %v", err)
+        return entry
+    }
+    if b == nil {
+        return entry
+    }
+
+    entry.Present = true
+    entry.LogIndex = b.Payload.LogIndex
+    entry.LogID = b.Payload.LogID
+    entry.IntegratedTime = time.Unix(b.Payload.IntegratedTime, 0).UTC()
+
+    if keys == nil {
+        entry.Error = "no rekor public key available"
+        return entry
+    }
+
+    pub, ok := keys.Keys[b.Payload.LogID]
+    if !ok {
+        entry.Error = fmt.Sprintf("log %s is not trusted", b.Payload.LogID)
+        return entry
+    }
+    ecPub, ok := pub.PubKey.(*ecdsa.PublicKey)
+    if !ok {
+        entry.Error = fmt.Sprintf("log %s key is not ECDSA", b.Payload.LogID)
+        return entry
+    }
+    if err := cosign.VerifySET(b.Payload, b.SignedEntryTimestamp, ecPub); err != nil {
+        entry.Error = fmt.Sprintf("verifying SET: %v", err)
+        return entry
+    }
+    entry.SETVerified = true
+
+    if cfg.RekorURL == "" {
+        return entry
+    }
+
+    logged, err := fetchLogEntry(ctx, cfg.RekorURL, b.Payload.LogIndex)
+    if err != nil {
+        entry.Error = fmt.Sprintf("fetching log entry: %v", err)
+        return entry
+    }
+    if body, _ := logged.Body.(string); body != b.Payload.Body {
+        entry.Error = "log entry body does not match the bundle"
+        return entry
+    }
+    if err := cosign.VerifyTLogEntryOffline(ctx, logged, keys); err != nil {
+        entry.Error = err.Error()
+        return entry
+    }
+    entry.InclusionVerified = true
+
+    return entry
+}
+
+// fetchLogEntry retrieves the entry at logIndex, inclusion proof included,
+// through the Rekor REST API.
+func fetchLogEntry(ctx context.Context, rekorURL string, logIndex int64) (*models.LogEntryAnon, error) {
+    url := fmt.Sprintf("%s/api/v1/log/entries?logIndex=%d", strings.TrimSuffix(rekorURL, "/"), logIndex)
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("rekor returned %s", resp.Status)
+    }
+
+    var entries models.LogEntry
+    if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+        return nil, fmt.Errorf("decoding log entry: %w", err)
+    }
+    for _, e := range entries {
+        return &e, nil
+    }
+    return nil, fmt.Errorf("no entry at index %d", logIndex)
+}
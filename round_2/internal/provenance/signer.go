@@ -0,0 +1,113 @@
+package provenance
+
+import (
+    "crypto/x509"
+    "encoding/asn1"
+    "fmt"
+    "strings"
+
+    "github.com/sigstore/cosign/v2/pkg/oci"
+    "helm-auditor/internal/types"
+)
+
+// Fulcio certificate extensions, see
+// https://github.com/sigstore/fulcio/blob/main/docs/oid-info.md
+// The 1.1-1.6 extensions hold raw strings, 1.8 onwards are DER encoded.
+var (
+    oidIssuerV1            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+    oidWorkflowTrigger     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 2}
+    oidWorkflowSha         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 3}
+    oidWorkflowName        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 4}
+    oidWorkflowRepository  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 5}
+    oidWorkflowRef         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 6}
+    oidIssuerV2            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+    oidBuildSignerURI      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 9}
+    oidSourceRepositoryURI = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+    oidSourceRepositorySha = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 13}
+    oidSourceRepositoryRef = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 14}
+    oidBuildTrigger        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 20}
+)
+
+// signerIdentity extracts the signer from the certificate attached to sig.
+// Returns nil when the signature was made with a plain key.
+func signerIdentity(sig oci.Signature) (*types.SignerIdentity, error) {
+    cert, err := sig.Cert()
+    if err != nil {
+        return nil, fmt.Errorf("reading certificate: %w", err)
+    }
+    if cert == nil {
+        return nil, nil
+    }
+    return identityFromCert(cert), nil
+}
+
+func identityFromCert(cert *x509.Certificate) *types.SignerIdentity {
+    id := &types.SignerIdentity{
+        SubjectAlternativeName: subjectAltName(cert),
+        Subject:                cert.Subject.String(),
+        CertificateIssuer:      cert.Issuer.CommonName,
+        SerialNumber:           cert.SerialNumber.String(),
+        NotBefore:              cert.NotBefore,
+        NotAfter:               cert.NotAfter,
+    }
+
+    v1 := map[string]string{}
+    v2 := map[string]string{}
+    for _, ext := range cert.Extensions {
+        if !strings.HasPrefix(ext.Id.String(), "1.3.6.1.4.1.57264.1.") {
+            continue
+        }
+        if isLegacyExtension(ext.Id) {
+            v1[ext.Id.String()] = string(ext.Value)
+            continue
+        }
+        var s string
+        if _, err := asn1.Unmarshal(ext.Value, &s); err == nil {
+            v2[ext.Id.String()] = s
+        }
+    }
+
+    // Prefer the DER encoded extensions, fall back to the legacy ones
+    pick := func(newer, older asn1.ObjectIdentifier) string {
+        if newer != nil {
+            if v := v2[newer.String()]; v != "" {
+                return v
+            }
+        }
+        return v1[older.String()]
+    }
+
+    id.Issuer = pick(oidIssuerV2, oidIssuerV1)
+    id.WorkflowTrigger = pick(oidBuildTrigger, oidWorkflowTrigger)
+    id.WorkflowName = pick(nil, oidWorkflowName)
+    id.WorkflowRef = pick(oidSourceRepositoryRef, oidWorkflowRef)
+    id.WorkflowRepository = pick(oidSourceRepositoryURI, oidWorkflowRepository)
+    id.WorkflowCommit = pick(oidSourceRepositorySha, oidWorkflowSha)
+    id.BuildSignerURI = v2[oidBuildSignerURI.String()]
+
+    return id
+}
+
+func isLegacyExtension(oid asn1.ObjectIdentifier) bool {
+    for _, l := range []asn1.ObjectIdentifier{
+        oidIssuerV1, oidWorkflowTrigger, oidWorkflowSha,
+        oidWorkflowName, oidWorkflowRepository, oidWorkflowRef,
+    } {
+        if oid.Equal(l) {
+            return true
+        }
+    }
+    return false
+}
+
+// subjectAltName returns the identity Fulcio bound to the certificate:
+// an email for human signers, a URI for workloads such as CI pipelines.
+func subjectAltName(cert *x509.Certificate) string {
+    if len(cert.URIs) > 0 {
+        return cert.URIs[0].String()
+    }
+    if len(cert.EmailAddresses) > 0 {
+        return cert.EmailAddresses[0]
+    }
+    return ""
+}
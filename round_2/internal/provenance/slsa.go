@@ -0,0 +1,111 @@
+package provenance
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "strings"
+
+    "github.com/sigstore/cosign/v2/pkg/oci"
+    "helm-auditor/internal/types"
+)
+
+const githubActionsIssuer = "https://token.actions.githubusercontent.com"
+
+// slsaL3Builders are hosted builders known to meet SLSA build level 3
+// (isolated, non falsifiable provenance). The builder id is self
+// declared, so it only counts when the Fulcio certificate of the
+// attestation was issued to that same workflow. Matched on prefix.
+var slsaL3Builders = []struct {
+    id, issuer string
+}{
+    {"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_container_slsa3.yml", githubActionsIssuer},
+    {"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml", githubActionsIssuer},
+    {"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/builder_go_slsa3.yml", githubActionsIssuer},
+}
+
+// inTotoStatement covers the SLSA provenance v0.2 and v1 predicates.
+type inTotoStatement struct {
+    PredicateType string `json:"predicateType"`
+    Predicate     struct {
+        Builder struct {
+            ID string `json:"id"`
+        } `json:"builder"`
+        RunDetails struct {
+            Builder struct {
+                ID string `json:"id"`
+            } `json:"builder"`
+        } `json:"runDetails"`
+    } `json:"predicate"`
+}
+
+// slsaProvenance derives the SLSA build level from the verified
+// attestations. A provenance attestation signed by a Fulcio identity is
+// level 2, level 3 when that identity is a builder known to meet the
+// isolation requirements. Attestations without a signer identity prove
+// nothing about their origin and stay at level 0.
+func slsaProvenance(attes []oci.Signature) *types.SLSAProvenance {
+    var best *types.SLSAProvenance
+    for _, a := range attes {
+        payload, err := a.Payload()
+        if err != nil {
+            continue
+        }
+        st, ok := decodeStatement(payload)
+        if !ok || !strings.HasPrefix(st.PredicateType, "https://slsa.dev/provenance/") {
+            continue
+        }
+
+        builder := st.Predicate.Builder.ID
+        if builder == "" {
+            builder = st.Predicate.RunDetails.Builder.ID
+        }
+        p := &types.SLSAProvenance{
+            PredicateType: st.PredicateType,
+            BuilderID:     builder,
+        }
+        if id, _ := signerIdentity(a); id != nil && id.SubjectAlternativeName != "" {
+            p.Level = 2
+            p.Signer = id.SubjectAlternativeName
+            if signedByBuilder(builder, id) {
+                p.Level = 3
+            }
+        }
+        if best == nil || p.Level > best.Level {
+            best = p
+        }
+    }
+    return best
+}
+
+// signedByBuilder tells whether the attestation signer is the level 3
+// builder the provenance names.
+func signedByBuilder(builder string, id *types.SignerIdentity) bool {
+    for _, b := range slsaL3Builders {
+        if strings.HasPrefix(builder, b.id) &&
+            (id.SubjectAlternativeName == b.id || strings.HasPrefix(id.SubjectAlternativeName, b.id+"@")) &&
+            id.Issuer == b.issuer {
+            return true
+        }
+    }
+    return false
+}
+
+// decodeStatement unwraps the DSSE envelope cosign stores attestations in.
+func decodeStatement(payload []byte) (*inTotoStatement, bool) {
+    var env struct {
+        Payload string `json:"payload"`
+    }
+    if err := json.Unmarshal(payload, &env); err != nil || env.Payload == "" {
+        return nil, false
+    }
+    raw, err := base64.StdEncoding.DecodeString(env.Payload)
+    if err != nil {
+        return nil, false
+    }
+
+    var st inTotoStatement
+    if err := json.Unmarshal(raw, &st); err != nil {
+        return nil, false
+    }
+    return &st, true
+}
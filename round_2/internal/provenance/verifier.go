@@ -0,0 +1,38 @@
+package provenance
+
+import (
+    "context"
+
+    "github.com/google/go-containerregistry/pkg/authn"
+    "github.com/google/go-containerregistry/pkg/name"
+    "github.com/google/go-containerregistry/pkg/v1/remote"
+    "github.com/sigstore/cosign/v2/pkg/cosign"
+    "helm-auditor/internal/types"
+)
+
+// Verifier checks the signatures a single signing scheme attached to an
+// image. Cosign and Notation are supported.
+type Verifier interface {
+    // Scheme names the signing scheme, e.g. "cosign" or "notation".
+    Scheme() string
+    // Verify returns the signatures that verified. Signatures found but
+    // rejected are explained in the returned warnings, so an image signed
+    // with an untrusted key is not mistaken for an unsigned one.
+    Verify(ctx context.Context, ref name.Reference) ([]types.SignatureResult, []string, error)
+}
+
+// verifiers returns every scheme the provenor checks, in report order.
+func verifiers(cfg Config, keys *cosign.TrustedTransparencyLogPubKeys) []Verifier {
+    return []Verifier{
+        &cosignVerifier{cfg: cfg, keys: keys},
+        &notationVerifier{trustStore: cfg.NotationTrustStore},
+    }
+}
+
+// remoteOptions are the registry options shared by the verifiers.
+func remoteOptions(ctx context.Context) []remote.Option {
+    return []remote.Option{
+        remote.WithContext(ctx),
+        remote.WithAuthFromKeychain(authn.DefaultKeychain),
+    }
+}
@@ -0,0 +1,92 @@
+package remediation
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+
+    "helm-auditor/internal/trivy"
+    "helm-auditor/internal/types"
+)
+
+// baseNameLabel is the OCI annotation naming the base image. Trivy
+// copies image labels into the SBOM as component properties.
+const baseNameLabel = "org.opencontainers.image.base.name"
+
+type cdxProperty struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+type cdxComponent struct {
+    Type       string        `json:"type"`
+    Name       string        `json:"name"`
+    Version    string        `json:"version"`
+    Properties []cdxProperty `json:"properties"`
+}
+
+type cdxDocument struct {
+    Metadata struct {
+        Component cdxComponent `json:"component"`
+    } `json:"metadata"`
+    Components []cdxComponent `json:"components"`
+}
+
+// DetectBase identifies the base of an image from its CycloneDX SBOM,
+// completed with the OS details of the vulnerability report. Either may
+// be missing; nil is returned when neither tells anything.
+func DetectBase(sbomPath string, report *trivy.Report) *types.BaseImage {
+    base := &types.BaseImage{}
+    if b, err := baseFromSBOM(sbomPath); err == nil {
+        base = b
+    }
+
+    if report != nil && report.Metadata.OS != nil {
+        if base.OSFamily == "" {
+            base.OSFamily = report.Metadata.OS.Family
+            base.OSVersion = report.Metadata.OS.Name
+        }
+        base.EOSL = report.Metadata.OS.EOSL
+    }
+
+    if *base == (types.BaseImage{}) {
+        return nil
+    }
+    return base
+}
+
+func baseFromSBOM(path string) (*types.BaseImage, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    // Some SBOMs wrap the document in a bom object.
+    var doc struct {
+        cdxDocument
+        BOM *cdxDocument `json:"bom"`
+    }
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("parsing sbom %s: %w", path, err)
+    }
+    d := doc.cdxDocument
+    if doc.BOM != nil && len(d.Components) == 0 {
+        d = *doc.BOM
+    }
+
+    base := &types.BaseImage{}
+    for _, p := range d.Metadata.Component.Properties {
+        if strings.HasSuffix(p.Name, baseNameLabel) {
+            base.Name = p.Value
+        }
+    }
+    for _, c := range d.Components {
+        if c.Type == "operating-system" {
+            base.OSFamily = c.Name
+            base.OSVersion = c.Version
+            break
+        }
+    }
+    return base, nil
+}
@@ -0,0 +1,125 @@
+package remediation
+
+import (
+    "fmt"
+    "strings"
+
+    "helm-auditor/internal/types"
+)
+
+// How a CVE goes away.
+const (
+    FixPackage   = "package"    // bump the dependency in the application
+    FixBaseImage = "base-image" // rebuild on a newer base image
+    FixNone      = "none"       // no fixed version published yet
+)
+
+// hintSeverities are the severities worth a rebuild recommendation.
+var hintSeverities = []string{"CRITICAL", "HIGH"}
+
+// maxPackages caps the packages named in a single hint.
+const maxPackages = 5
+
+// Classify decides how v can be fixed. OS packages come with the base
+// image, so a fixed version there means rebuilding on an updated base;
+// language packages are dependencies of the application itself.
+func Classify(v types.Vulnerability) string {
+    switch {
+    case v.FixedVersion == "":
+        return FixNone
+    case v.Class == "os-pkgs":
+        return FixBaseImage
+    default:
+        return FixPackage
+    }
+}
+
+// Annotate sets the Fix field of every vulnerability.
+func Annotate(vulns []types.Vulnerability) {
+    for i := range vulns {
+        vulns[i].Fix = Classify(vulns[i])
+    }
+}
+
+// Analyze counts how the CVEs of an image can be fixed and turns the
+// counts into rebuild hints.
+func Analyze(vulns []types.Vulnerability, base *types.BaseImage) *types.Remediation {
+    rem := &types.Remediation{Base: base, BySeverity: map[string]types.FixCounts{}}
+
+    packages := map[string][]string{} // severity -> packages fixable in place
+    for _, v := range vulns {
+        c := rem.BySeverity[v.Severity]
+        switch Classify(v) {
+        case FixNone:
+            c.None++
+        case FixBaseImage:
+            c.BaseImage++
+        case FixPackage:
+            c.Package++
+            if !contains(packages[v.Severity], v.Package) {
+                packages[v.Severity] = append(packages[v.Severity], v.Package)
+            }
+        }
+        rem.BySeverity[v.Severity] = c
+    }
+
+    if base != nil && base.EOSL {
+        rem.Hints = append(rem.Hints, fmt.Sprintf(
+            "%s is end of life and gets no more fixes: move to a supported release", osName(base)))
+    }
+    for _, sev := range hintSeverities {
+        c, ok := rem.BySeverity[sev]
+        if !ok {
+            continue
+        }
+        total := c.Package + c.BaseImage + c.None
+        if c.BaseImage > 0 {
+            rem.Hints = append(rem.Hints, fmt.Sprintf(
+                "rebuild on a newer %s resolves %d of %d %s CVEs", baseName(base), c.BaseImage, total, sev))
+        }
+        if c.Package > 0 {
+            rem.Hints = append(rem.Hints, fmt.Sprintf(
+                "upgrading %s resolves %d of %d %s CVEs", listPackages(packages[sev]), c.Package, total, sev))
+        }
+        switch {
+        case c.None == total && total == 1:
+            rem.Hints = append(rem.Hints, fmt.Sprintf("the %s CVE has no fix yet", sev))
+        case c.None == total:
+            rem.Hints = append(rem.Hints, fmt.Sprintf("none of the %d %s CVEs has a fix yet", total, sev))
+        }
+    }
+    return rem
+}
+
+func baseName(base *types.BaseImage) string {
+    switch {
+    case base == nil:
+        return "base image"
+    case base.Name != "":
+        return base.Name + " base"
+    case base.OSFamily != "":
+        return osName(base) + " base"
+    default:
+        return "base image"
+    }
+}
+
+func osName(base *types.BaseImage) string {
+    return strings.TrimSpace(base.OSFamily + " " + base.OSVersion)
+}
+
+func listPackages(pkgs []string) string {
+    if len(pkgs) <= maxPackages {
+        return strings.Join(pkgs, ", ")
+    }
+    return fmt.Sprintf("%s and %d more packages", strings.Join(pkgs[:maxPackages], ", "), len(pkgs)-maxPackages)
+}
+
+func contains(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
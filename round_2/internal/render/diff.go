@@ -0,0 +1,183 @@
+package render
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "helm-auditor/internal/diff"
+    "helm-auditor/internal/reports"
+    "helm-auditor/internal/types"
+)
+
+// DiffMarkdown renders the comparison of two audits, sized like the PR
+// summary.
+func DiffMarkdown(r *diff.Report, opts MarkdownOptions) string {
+    if opts.MaxRows <= 0 {
+        opts.MaxRows = DefaultMarkdownOptions().MaxRows
+    }
+
+    var head strings.Builder
+    fmt.Fprintf(&head, "## Helm audit diff: %s %s → %s\n\n", r.To.Chart, r.From.Version, r.To.Version)
+    if r.Empty() {
+        head.WriteString("No security relevant changes.\n")
+        return head.String()
+    }
+    fmt.Fprintf(&head, "| Images | CVEs | Misconfigurations | Findings | RBAC changes | Signature changes |\n")
+    fmt.Fprintf(&head, "|---|---|---|---|---|---|\n")
+    fmt.Fprintf(&head, "| +%d -%d ~%d | +%d -%d | +%d -%d | +%d -%d | %d | %d |\n\n",
+        len(r.AddedImages), len(r.RemovedImages), len(r.ChangedImages),
+        len(r.NewCVEs), len(r.FixedCVEs),
+        len(r.NewMisconfigurations), len(r.ResolvedMisconfigurations),
+        len(r.NewFindings), len(r.ResolvedFindings),
+        len(r.RBAC), len(r.Signatures))
+
+    sections := []string{
+        diffSignatures(r, opts),
+        diffRBAC(r, opts),
+        diffCVEs("New CVEs", true, r.NewCVEs, opts),
+        diffImages(r, opts),
+        misconfigSection("New misconfigurations", true, r.NewMisconfigurations, opts),
+        findingSection("New findings", true, r.NewFindings, opts),
+        diffCVEs("Fixed CVEs", false, r.FixedCVEs, opts),
+        misconfigSection("Resolved misconfigurations", false, r.ResolvedMisconfigurations, opts),
+        findingSection("Resolved findings", false, r.ResolvedFindings, opts),
+    }
+
+    var out strings.Builder
+    out.WriteString(head.String())
+    dropped := 0
+    for _, s := range sections {
+        if s == "" {
+            continue
+        }
+        if opts.MaxBytes > 0 && out.Len()+len(s)+128 > opts.MaxBytes {
+            dropped++
+            continue
+        }
+        out.WriteString(s)
+    }
+    if dropped > 0 {
+        fmt.Fprintf(&out, "\n> %d section(s) omitted to stay under the comment size limit.\n", dropped)
+    }
+    return out.String()
+}
+
+// WriteDiffMarkdown renders the comparison to path.
+func WriteDiffMarkdown(path string, r *diff.Report, opts MarkdownOptions) error {
+    return os.WriteFile(path, []byte(DiffMarkdown(r, opts)), 0o644)
+}
+
+func diffImages(r *diff.Report, opts MarkdownOptions) string {
+    var rows []string
+    for _, img := range r.AddedImages {
+        rows = append(rows, fmt.Sprintf("| added | `%s` | %s |", img.Name, signedText(img.Signed)))
+    }
+    for _, img := range r.RemovedImages {
+        rows = append(rows, fmt.Sprintf("| removed | `%s` | |", img.Name))
+    }
+    for _, c := range r.ChangedImages {
+        change := fmt.Sprintf("`%s` → `%s`", c.From, c.To)
+        if c.SameTag() {
+            change = fmt.Sprintf("`%s` **digest changed**", c.To)
+        }
+        rows = append(rows, fmt.Sprintf("| changed | %s | %s |", change, digestChange(c)))
+    }
+    if len(rows) == 0 {
+        return ""
+    }
+    return details(fmt.Sprintf("Images (%d)", len(rows)), true,
+        "| Change | Image | Details |\n|---|---|---|", rows, opts.MaxRows)
+}
+
+func digestChange(c diff.ImageChange) string {
+    if c.FromDigest == "" || c.ToDigest == "" || c.FromDigest == c.ToDigest {
+        return ""
+    }
+    return fmt.Sprintf("`%s` → `%s`", shortDigest(c.FromDigest), shortDigest(c.ToDigest))
+}
+
+func signedText(signed bool) string {
+    if signed {
+        return "signed"
+    }
+    return "unsigned"
+}
+
+func diffSignatures(r *diff.Report, opts MarkdownOptions) string {
+    var rows []string
+    for _, c := range r.Signatures {
+        to := mdEscape(c.To.String())
+        if c.Lost() {
+            to = "**" + to + "**"
+        }
+        rows = append(rows, fmt.Sprintf("| `%s` | %s | %s |", c.Repository, mdEscape(c.From.String()), to))
+    }
+    if len(rows) == 0 {
+        return ""
+    }
+    return details(fmt.Sprintf("Signature changes (%d)", len(rows)), true,
+        "| Image | Before | After |\n|---|---|---|", rows, opts.MaxRows)
+}
+
+func diffRBAC(r *diff.Report, opts MarkdownOptions) string {
+    var rows []string
+    for _, c := range r.RBAC {
+        rows = append(rows, fmt.Sprintf("| `%s` | %s | %s | %s |",
+            c.Workload, c.Scope, grantList(c.Added), grantList(c.Removed)))
+    }
+    if len(rows) == 0 {
+        return ""
+    }
+    return details(fmt.Sprintf("RBAC changes (%d)", len(rows)), true,
+        "| Workload | Scope | Granted | Revoked |\n|---|---|---|---|", rows, opts.MaxRows)
+}
+
+func grantList(grants []string) string {
+    if len(grants) == 0 {
+        return ""
+    }
+    return "`" + strings.Join(grants, "`<br>`") + "`"
+}
+
+func diffCVEs(title string, open bool, cves []diff.CVE, opts MarkdownOptions) string {
+    if len(cves) == 0 {
+        return ""
+    }
+    rows := make([]string, 0, len(cves))
+    for _, c := range cves {
+        fixed := c.FixedVersion
+        if fixed == "" {
+            fixed = "_none_"
+        }
+        rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s | %s |",
+            c.Severity, c.ID, c.Package, fixed, mdImages(c.Images, 3)))
+    }
+    return details(fmt.Sprintf("%s (%d)", title, len(cves)), open,
+        "| Severity | CVE | Package | Fixed in | Images |\n|---|---|---|---|---|", rows, opts.MaxRows)
+}
+
+func misconfigSection(title string, open bool, ms []reports.Misconfiguration, opts MarkdownOptions) string {
+    if len(ms) == 0 {
+        return ""
+    }
+    return details(fmt.Sprintf("%s (%d)", title, len(ms)), open,
+        "| Severity | Check | Resource | Location |\n|---|---|---|---|", misconfigRows(ms), opts.MaxRows)
+}
+
+func findingSection(title string, open bool, fs []types.Finding, opts MarkdownOptions) string {
+    if len(fs) == 0 {
+        return ""
+    }
+    rows := make([]string, 0, len(fs))
+    for _, f := range fs {
+        field := ""
+        if f.Path != "" {
+            field = "`" + f.Path + "`"
+        }
+        rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s |",
+            f.Severity, mdEscape(f.RuleID+" "+f.Title), f.Resource, field))
+    }
+    return details(fmt.Sprintf("%s (%d)", title, len(fs)), open,
+        "| Severity | Rule | Resource | Field |\n|---|---|---|---|", rows, opts.MaxRows)
+}
@@ -0,0 +1,211 @@
+package render
+
+import (
+    "bytes"
+    "embed"
+    "fmt"
+    "html/template"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "helm-auditor/internal/policy"
+    "helm-auditor/internal/reports"
+    "helm-auditor/internal/types"
+)
+
+//go:embed templates/*.tmpl
+var templatesFS embed.FS
+
+var funcs = template.FuncMap{
+    "short":     shortDigest,
+    "anchor":    anchor,
+    "lower":     strings.ToLower,
+    "date":      func(t time.Time) string { return t.Format("2006-01-02") },
+    "join":      strings.Join,
+    "severity":  func(m map[string]int, s string) int { return m[s] },
+    "sortVulns": sortVulns,
+}
+
+var htmlTemplate = template.Must(template.New("report.html.tmpl").Funcs(funcs).ParseFS(templatesFS, "templates/report.html.tmpl"))
+
+// workloadGroup is the misconfigurations found on one resource.
+type workloadGroup struct {
+    Resource string
+    Findings []reports.Misconfiguration
+}
+
+// findingGroup is the native findings on one resource.
+type findingGroup struct {
+    Resource string
+    Findings []types.Finding
+}
+
+// subchart is a row of the flattened dependency tree.
+type subchart struct {
+    *types.ChartNode
+    Depth int
+}
+
+type htmlView struct {
+    Audit      *reports.ExtendedAudit
+    Severities []string
+    Workloads  []workloadGroup
+    Checks     []findingGroup
+    Subcharts  []subchart
+    Generated  time.Time
+}
+
+// HTML renders audit as a single self contained page: styles are inlined
+// and nothing is fetched when the file is opened.
+func HTML(audit *reports.ExtendedAudit) ([]byte, error) {
+    view := htmlView{
+        Audit:      audit,
+        Severities: policy.Severities,
+        Workloads:  groupByWorkload(audit.Misconfigurations),
+        Generated:  time.Now().UTC(),
+    }
+
+    if audit.Manifests != nil {
+        view.Checks = groupFindings(audit.Manifests.Findings)
+        view.Subcharts = flattenTree(audit.Manifests.Dependencies, 0, nil)
+    }
+
+    var buf bytes.Buffer
+    if err := htmlTemplate.Execute(&buf, view); err != nil {
+        return nil, fmt.Errorf("rendering html report: %w", err)
+    }
+    return buf.Bytes(), nil
+}
+
+// WriteHTML renders audit to path.
+func WriteHTML(path string, audit *reports.ExtendedAudit) error {
+    data, err := HTML(audit)
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, data, 0o644)
+}
+
+// flattenTree lists the dependency tree depth first.
+func flattenTree(n *types.ChartNode, depth int, out []subchart) []subchart {
+    if n == nil {
+        return out
+    }
+    out = append(out, subchart{ChartNode: n, Depth: depth})
+    for _, d := range n.Dependencies {
+        out = flattenTree(d, depth+1, out)
+    }
+    return out
+}
+
+// groupByWorkload groups findings by resource, falling back to the
+// template file, most severe groups first.
+func groupByWorkload(ms []reports.Misconfiguration) []workloadGroup {
+    idx := map[string]int{}
+    var groups []workloadGroup
+    for _, m := range ms {
+        key := m.Resource
+        if key == "" {
+            key = m.File
+        }
+        i, ok := idx[key]
+        if !ok {
+            i = len(groups)
+            idx[key] = i
+            groups = append(groups, workloadGroup{Resource: key})
+        }
+        groups[i].Findings = append(groups[i].Findings, m)
+    }
+
+    for _, g := range groups {
+        sort.SliceStable(g.Findings, func(i, j int) bool {
+            return severityRank(g.Findings[i].Severity) < severityRank(g.Findings[j].Severity)
+        })
+    }
+    sort.SliceStable(groups, func(i, j int) bool {
+        ri := severityRank(groups[i].Findings[0].Severity)
+        rj := severityRank(groups[j].Findings[0].Severity)
+        if ri != rj {
+            return ri < rj
+        }
+        return groups[i].Resource < groups[j].Resource
+    })
+    return groups
+}
+
+// groupFindings groups native findings by resource, most severe first.
+func groupFindings(fs []types.Finding) []findingGroup {
+    idx := map[string]int{}
+    var groups []findingGroup
+    for _, f := range fs {
+        i, ok := idx[f.Resource]
+        if !ok {
+            i = len(groups)
+            idx[f.Resource] = i
+            groups = append(groups, findingGroup{Resource: f.Resource})
+        }
+        groups[i].Findings = append(groups[i].Findings, f)
+    }
+
+    for _, g := range groups {
+        sort.SliceStable(g.Findings, func(i, j int) bool {
+            return severityRank(g.Findings[i].Severity) < severityRank(g.Findings[j].Severity)
+        })
+    }
+    sort.SliceStable(groups, func(i, j int) bool {
+        ri := severityRank(groups[i].Findings[0].Severity)
+        rj := severityRank(groups[j].Findings[0].Severity)
+        if ri != rj {
+            return ri < rj
+        }
+        return groups[i].Resource < groups[j].Resource
+    })
+    return groups
+}
+
+// severityRank orders severities from most to least severe.
+func severityRank(s string) int {
+    for i, sev := range policy.Severities {
+        if strings.EqualFold(s, sev) {
+            return i
+        }
+    }
+    return len(policy.Severities)
+}
+
+// sortVulns orders a copy of vulns by severity, then CVSS score.
+func sortVulns(vulns []types.Vulnerability) []types.Vulnerability {
+    out := append([]types.Vulnerability{}, vulns...)
+    sort.SliceStable(out, func(i, j int) bool {
+        ri, rj := severityRank(out[i].Severity), severityRank(out[j].Severity)
+        if ri != rj {
+            return ri < rj
+        }
+        return out[i].CVSSScore > out[j].CVSSScore
+    })
+    return out
+}
+
+func shortDigest(d string) string {
+    if i := strings.Index(d, ":"); i >= 0 && len(d) > i+13 {
+        return d[:i+13]
+    }
+    return d
+}
+
+// anchor turns a name into an id usable in links.
+func anchor(prefix, s string) string {
+    var b strings.Builder
+    b.WriteString(prefix)
+    b.WriteByte('-')
+    for _, r := range strings.ToLower(s) {
+        if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+            b.WriteRune(r)
+        } else {
+            b.WriteByte('-')
+        }
+    }
+    return b.String()
+}
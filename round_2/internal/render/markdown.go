@@ -0,0 +1,330 @@
+package render
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+
+    "github.com/google/go-containerregistry/pkg/name"
+
+    "helm-auditor/internal/reports"
+)
+
+// GitHub rejects comments above 65536 characters.
+const DefaultMaxBytes = 65000
+
+// MarkdownOptions bounds the size of the PR summary.
+type MarkdownOptions struct {
+    MaxBytes int // whole document, sections that do not fit are dropped
+    MaxRows  int // rows per table, the rest is counted but not listed
+    TopCVEs  int // critical CVEs listed in the summary
+}
+
+// DefaultMarkdownOptions fits a single GitHub or GitLab comment.
+func DefaultMarkdownOptions() MarkdownOptions {
+    return MarkdownOptions{MaxBytes: DefaultMaxBytes, MaxRows: 50, TopCVEs: 10}
+}
+
+// criticalCVE is a critical vulnerability and the images it affects.
+type criticalCVE struct {
+    ID      string
+    Package string
+    Fixed   string
+    Images  []string
+}
+
+// Markdown renders a PR comment for audit. When prev is the audit of the
+// base branch, unsigned images and misconfigurations are reported as
+// deltas against it.
+func Markdown(audit, prev *reports.ExtendedAudit, opts MarkdownOptions) string {
+    if opts.MaxRows <= 0 {
+        opts.MaxRows = DefaultMarkdownOptions().MaxRows
+    }
+    if opts.TopCVEs <= 0 {
+        opts.TopCVEs = DefaultMarkdownOptions().TopCVEs
+    }
+
+    var head strings.Builder
+    fmt.Fprintf(&head, "## Helm audit: %s %s\n\n", audit.Chart.Name, audit.Chart.Version)
+    head.WriteString(mdGate(audit))
+    fmt.Fprintf(&head, "| Images | Vulnerabilities | Misconfigurations | Critical misconfigs | High misconfigs |\n")
+    fmt.Fprintf(&head, "|---:|---:|---:|---:|---:|\n")
+    fmt.Fprintf(&head, "| %d | %d | %d%s | %d | %d |\n\n",
+        audit.ImagesSummary.Total, audit.Vulns, audit.TotalMisconfigs,
+        misconfigDelta(audit, prev), audit.Criticals, audit.Highs)
+
+    sections := []string{
+        mdGateFailures(audit, opts),
+        mdCriticalCVEs(audit, opts),
+        mdUnsigned(audit, prev, opts),
+        mdRebuildHints(audit, opts),
+        mdMisconfigDeltas(audit, prev, opts),
+    }
+
+    footer := "\n_Full details in `audit-report.html` and `audit.sarif`._\n"
+    var out strings.Builder
+    out.WriteString(head.String())
+    dropped := 0
+    for _, s := range sections {
+        if s == "" {
+            continue
+        }
+        if opts.MaxBytes > 0 && out.Len()+len(s)+len(footer)+128 > opts.MaxBytes {
+            dropped++
+            continue
+        }
+        out.WriteString(s)
+    }
+    if dropped > 0 {
+        fmt.Fprintf(&out, "\n> %d section(s) omitted to stay under the comment size limit.\n", dropped)
+    }
+    out.WriteString(footer)
+    return out.String()
+}
+
+// WriteMarkdown renders the summary to path.
+func WriteMarkdown(path string, audit, prev *reports.ExtendedAudit, opts MarkdownOptions) error {
+    return os.WriteFile(path, []byte(Markdown(audit, prev, opts)), 0o644)
+}
+
+func mdGate(audit *reports.ExtendedAudit) string {
+    g := audit.Gate
+    switch {
+    case g == nil:
+        return "**Policy gate:** not evaluated\n\n"
+    case g.Passed:
+        return fmt.Sprintf("**Policy gate:** :white_check_mark: passed (%d rules)\n\n", len(g.Rules))
+    default:
+        return fmt.Sprintf("**Policy gate:** :x: failed, %d of %d rules\n\n", len(g.Failures), len(g.Rules))
+    }
+}
+
+func mdGateFailures(audit *reports.ExtendedAudit, opts MarkdownOptions) string {
+    if audit.Gate == nil || audit.Gate.Passed {
+        return ""
+    }
+    var rows []string
+    for _, r := range audit.Gate.Rules {
+        if r.Passed {
+            continue
+        }
+        rows = append(rows, fmt.Sprintf("| %s | `%s` | %s |", r.Rule, r.Target, mdEscape(r.Reason)))
+    }
+    return details(fmt.Sprintf("Gate failures (%d)", len(rows)), true,
+        "| Rule | Target | Reason |\n|---|---|---|", rows, opts.MaxRows)
+}
+
+func mdCriticalCVEs(audit *reports.ExtendedAudit, opts MarkdownOptions) string {
+    idx := map[string]*criticalCVE{}
+    var cves []*criticalCVE
+    for _, img := range audit.ImagesSummary.Images {
+        for _, v := range img.CVEs {
+            if !strings.EqualFold(v.Severity, "CRITICAL") {
+                continue
+            }
+            c, ok := idx[v.ID]
+            if !ok {
+                c = &criticalCVE{ID: v.ID, Package: v.Package, Fixed: v.FixedVersion}
+                idx[v.ID] = c
+                cves = append(cves, c)
+            }
+            if len(c.Images) == 0 || c.Images[len(c.Images)-1] != img.Name {
+                c.Images = append(c.Images, img.Name)
+            }
+        }
+    }
+    if len(cves) == 0 {
+        return ""
+    }
+
+    // Most widespread first, fixable before unfixable.
+    sort.SliceStable(cves, func(i, j int) bool {
+        if len(cves[i].Images) != len(cves[j].Images) {
+            return len(cves[i].Images) > len(cves[j].Images)
+        }
+        if (cves[i].Fixed != "") != (cves[j].Fixed != "") {
+            return cves[i].Fixed != ""
+        }
+        return cves[i].ID < cves[j].ID
+    })
+
+    rows := make([]string, 0, len(cves))
+    for _, c := range cves {
+        fixed := c.Fixed
+        if fixed == "" {
+            fixed = "_none_"
+        }
+        rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s |",
+            c.ID, c.Package, fixed, mdImages(c.Images, 3)))
+    }
+    limit := opts.TopCVEs
+    if opts.MaxRows < limit {
+        limit = opts.MaxRows
+    }
+    return details(fmt.Sprintf("Critical CVEs (%d)", len(cves)), true,
+        "| CVE | Package | Fixed in | Images |\n|---|---|---|---|", rows, limit)
+}
+
+func mdRebuildHints(audit *reports.ExtendedAudit, opts MarkdownOptions) string {
+    var rows []string
+    for _, img := range audit.ImagesSummary.Images {
+        if img.Remediation == nil || len(img.Remediation.Hints) == 0 {
+            continue
+        }
+        rows = append(rows, fmt.Sprintf("| `%s` | %s |", img.Name, strings.Join(img.Remediation.Hints, "<br>")))
+    }
+    if len(rows) == 0 {
+        return ""
+    }
+    return details(fmt.Sprintf("Rebuild hints (%d images)", len(rows)), false,
+        "| Image | Recommendation |\n|---|---|", rows, opts.MaxRows)
+}
+
+func mdUnsigned(audit, prev *reports.ExtendedAudit, opts MarkdownOptions) string {
+    before := map[string]bool{} // repository -> signed in the base audit
+    if prev != nil {
+        for _, img := range prev.ImagesSummary.Images {
+            before[repository(img.Name)] = img.Signed
+        }
+    }
+
+    var rows []string
+    for _, img := range audit.ImagesSummary.Images {
+        if img.Signed {
+            continue
+        }
+        signed, known := before[repository(img.Name)]
+        switch {
+        case prev == nil:
+            rows = append(rows, fmt.Sprintf("| `%s` | unsigned |", img.Name))
+        case !known:
+            rows = append(rows, fmt.Sprintf("| `%s` | new image, unsigned |", img.Name))
+        case signed:
+            rows = append(rows, fmt.Sprintf("| `%s` | **signature lost** |", img.Name))
+        }
+    }
+    if len(rows) == 0 {
+        return ""
+    }
+    title := "Unsigned images"
+    if prev != nil {
+        title = "Newly unsigned images"
+    }
+    return details(fmt.Sprintf("%s (%d)", title, len(rows)), prev != nil,
+        "| Image | Status |\n|---|---|", rows, opts.MaxRows)
+}
+
+func mdMisconfigDeltas(audit, prev *reports.ExtendedAudit, opts MarkdownOptions) string {
+    if prev == nil {
+        return ""
+    }
+    key := func(m reports.Misconfiguration) string { return m.ID + "\x00" + m.Resource }
+    before := map[string]bool{}
+    for _, m := range prev.Misconfigurations {
+        before[key(m)] = true
+    }
+    after := map[string]bool{}
+    for _, m := range audit.Misconfigurations {
+        after[key(m)] = true
+    }
+
+    var added, resolved []reports.Misconfiguration
+    for _, m := range audit.Misconfigurations {
+        if !before[key(m)] {
+            added = append(added, m)
+        }
+    }
+    for _, m := range prev.Misconfigurations {
+        if !after[key(m)] {
+            resolved = append(resolved, m)
+        }
+    }
+    sortBySeverity := func(ms []reports.Misconfiguration) {
+        sort.SliceStable(ms, func(i, j int) bool {
+            return severityRank(ms[i].Severity) < severityRank(ms[j].Severity)
+        })
+    }
+    sortBySeverity(added)
+    sortBySeverity(resolved)
+
+    header := "| Severity | Check | Resource | Location |\n|---|---|---|---|"
+    var b strings.Builder
+    if len(added) > 0 {
+        b.WriteString(details(fmt.Sprintf("New misconfigurations (%d)", len(added)), true,
+            header, misconfigRows(added), opts.MaxRows))
+    }
+    if len(resolved) > 0 {
+        b.WriteString(details(fmt.Sprintf("Resolved misconfigurations (%d)", len(resolved)), false,
+            header, misconfigRows(resolved), opts.MaxRows))
+    }
+    return b.String()
+}
+
+func misconfigRows(ms []reports.Misconfiguration) []string {
+    rows := make([]string, 0, len(ms))
+    for _, m := range ms {
+        loc := m.File
+        if m.StartLine > 0 {
+            loc = fmt.Sprintf("%s:%d", m.File, m.StartLine)
+        }
+        rows = append(rows, fmt.Sprintf("| %s | %s | %s | `%s` |",
+            m.Severity, mdEscape(m.ID+" "+m.Title), m.Resource, loc))
+    }
+    return rows
+}
+
+// misconfigDelta formats the change in misconfigurations against prev.
+func misconfigDelta(audit, prev *reports.ExtendedAudit) string {
+    if prev == nil {
+        return ""
+    }
+    d := audit.TotalMisconfigs - prev.TotalMisconfigs
+    if d == 0 {
+        return ""
+    }
+    return fmt.Sprintf(" (%+d)", d)
+}
+
+// details wraps a table in a collapsible block, listing at most limit rows.
+func details(summary string, open bool, header string, rows []string, limit int) string {
+    var b strings.Builder
+    if open {
+        b.WriteString("<details open>\n")
+    } else {
+        b.WriteString("<details>\n")
+    }
+    fmt.Fprintf(&b, "<summary><b>%s</b></summary>\n\n%s\n", summary, header)
+    for i, r := range rows {
+        if i == limit {
+            fmt.Fprintf(&b, "\n_...and %d more._\n", len(rows)-limit)
+            break
+        }
+        b.WriteString(r)
+        b.WriteByte('\n')
+    }
+    b.WriteString("\n</details>\n\n")
+    return b.String()
+}
+
+func mdImages(images []string, limit int) string {
+    if len(images) <= limit {
+        return "`" + strings.Join(images, "`, `") + "`"
+    }
+    return fmt.Sprintf("`%s` +%d", strings.Join(images[:limit], "`, `"), len(images)-limit)
+}
+
+// mdEscape keeps free text from breaking table rows.
+func mdEscape(s string) string {
+    s = strings.ReplaceAll(s, "|", "\\|")
+    return strings.Join(strings.Fields(s), " ")
+}
+
+// repository strips the tag and digest so images match across version bumps.
+func repository(image string) string {
+    ref, err := name.ParseReference(image)
+    if err != nil {
+        return image
+    }
+    return ref.Context().Name()
+}
@@ -0,0 +1,221 @@
+package reports
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "helm-auditor/internal/policy"
+    "helm-auditor/internal/types"
+)
+
+// ImageSummary is the per image section of audit-images.json.
+type ImageSummary struct {
+    Name            string `json:"name"`
+    Digest          string `json:"digest"`
+    Signed          bool   `json:"signed"`
+    Components      int    `json:"components"`
+    Vulnerabilities int    `json:"vulnerabilities"`
+
+    // Vulnerability counts keyed by severity
+    VulnsBySeverity map[string]int        `json:"vulns_by_severity,omitempty"`
+    CVEs            []types.Vulnerability `json:"cves,omitempty"`
+
+    // Charts of the dependency tree deploying the image
+    Charts []string `json:"charts,omitempty"`
+
+    // How the CVEs can be fixed and what to rebuild
+    Remediation *types.Remediation `json:"remediation,omitempty"`
+
+    // Embedded OSV matcher results, when OSV_DB is set
+    OSV *types.OSVScan `json:"osv,omitempty"`
+
+    SignedBy []string               `json:"signed_by,omitempty"` // cosign, notation
+    Signers  []types.SignerIdentity `json:"signers,omitempty"`
+
+    // Signatures without a Rekor entry backing them
+    UnloggedSignatures int `json:"unlogged_signatures,omitempty"`
+
+    // Signatures, SBOMs, attestations, VEX... attached to the digest
+    Artifacts []types.ReferrerArtifact `json:"artifacts,omitempty"`
+
+    SLSA    *types.SLSAProvenance `json:"slsa,omitempty"`
+    Created time.Time             `json:"created,omitzero"`
+}
+
+// Misconfiguration is a failed Trivy config check.
+type Misconfiguration struct {
+    ID         string `json:"id"`
+    Title      string `json:"title"`
+    Severity   string `json:"severity"`
+    Message    string `json:"message"`
+    Resolution string `json:"resolution,omitempty"`
+    URL        string `json:"url,omitempty"`
+    Resource   string `json:"resource"` // workload the check failed on
+    File       string `json:"file"`
+    StartLine  int    `json:"start_line,omitempty"`
+
+    // new or existing since the last audit of the chart
+    Baseline  string    `json:"baseline,omitempty"`
+    FirstSeen time.Time `json:"first_seen,omitzero"`
+}
+
+// ExtendedAudit is audit-images.json, the consolidated report.
+type ExtendedAudit struct {
+    Chart struct {
+        Name    string `json:"name"`
+        URL     string `json:"url"`
+        Version string `json:"version"`
+
+        // Chart.yaml and chart tree, from the manifest audit
+        Metadata *types.ChartMetadata `json:"metadata,omitempty"`
+    } `json:"chart"`
+
+    ImagesSummary struct {
+        Total  int            `json:"total_images"`
+        Images []ImageSummary `json:"images"`
+    } `json:"images_summary"`
+
+    TotalMisconfigs int `json:"total_misconfigs"`
+    TotalFailures   int `json:"total_failures"`
+    TotalSuccesses  int `json:"total_successes"`
+    Criticals       int `json:"criticals"`
+    Highs           int `json:"highs"`
+    Components      int `json:"components"`
+    Vulns           int `json:"vulns"`
+
+    Misconfigurations []Misconfiguration `json:"misconfigurations,omitempty"`
+
+    // Gate is the policy decision of the auditor stage, when available
+    Gate *policy.Result `json:"gate,omitempty"`
+
+    // Manifests is the native analysis of the rendered templates
+    Manifests *ManifestAudit `json:"manifests,omitempty"`
+
+    // History compares the audit with the previous ones of the chart
+    History *types.AuditHistory `json:"history,omitempty"`
+
+    // ScanCache tells which image scans were reused
+    ScanCache *types.ScanCacheStats `json:"scan_cache,omitempty"`
+}
+
+// ManifestAudit is manifest-audit.json, written by the auditor from the
+// rendered templates.
+type ManifestAudit struct {
+    Findings []types.Finding `json:"findings"`
+
+    // Effective RBAC permissions of every workload
+    RBAC []types.WorkloadPermissions `json:"rbac,omitempty"`
+
+    // NetworkPolicy coverage and external exposure
+    Network *types.NetworkReport `json:"network,omitempty"`
+
+    // Pod Security Standards level of every workload
+    PSS *types.PSSReport `json:"pss,omitempty"`
+
+    // Chart.yaml and chart tree of the audited chart
+    Chart *types.ChartMetadata `json:"chart,omitempty"`
+
+    // Subcharts with what each of them rendered
+    Dependencies *types.ChartNode `json:"dependencies,omitempty"`
+
+    KubeVersion string `json:"kube_version,omitempty"` // target of the API version checks
+
+    Unvalidated []string `json:"unvalidated,omitempty"` // resources without a known schema
+
+    Warnings []string `json:"warnings,omitempty"` // templates that failed to parse
+}
+
+// LoadManifestAudit reads manifest-audit.json written by the auditor.
+func LoadManifestAudit(reportsPath string) (*ManifestAudit, error) {
+    data, err := os.ReadFile(filepath.Join(reportsPath, "manifest-audit.json"))
+    if err != nil {
+        return nil, err
+    }
+
+    var m ManifestAudit
+    if err := json.Unmarshal(data, &m); err != nil {
+        return nil, fmt.Errorf("parsing manifest audit: %w", err)
+    }
+    return &m, nil
+}
+
+// LoadAudit reads an audit-images.json written by a previous run.
+func LoadAudit(path string) (*ExtendedAudit, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var a ExtendedAudit
+    if err := json.Unmarshal(data, &a); err != nil {
+        return nil, fmt.Errorf("parsing audit %s: %w", path, err)
+    }
+    return &a, nil
+}
+
+// ArchivePath is where the reporter keeps a copy of audit-images.json
+// for every chart version audited, so versions can be compared later.
+func ArchivePath(reportsPath, version string) string {
+    return filepath.Join(reportsPath, "audits", version+".json")
+}
+
+// LoadScanCache reads scan-cache.json written by the aggregator.
+func LoadScanCache(reportsPath string) (*types.ScanCacheStats, error) {
+    data, err := os.ReadFile(filepath.Join(reportsPath, "scan-cache.json"))
+    if err != nil {
+        return nil, err
+    }
+
+    var s types.ScanCacheStats
+    if err := json.Unmarshal(data, &s); err != nil {
+        return nil, fmt.Errorf("parsing scan cache stats: %w", err)
+    }
+    return &s, nil
+}
+
+// LoadGate reads gate-result.json written by the auditor.
+func LoadGate(reportsPath string) (*policy.Result, error) {
+    data, err := os.ReadFile(filepath.Join(reportsPath, "gate-result.json"))
+    if err != nil {
+        return nil, err
+    }
+
+    var g policy.Result
+    if err := json.Unmarshal(data, &g); err != nil {
+        return nil, fmt.Errorf("parsing gate result: %w", err)
+    }
+    return &g, nil
+}
+
+// auditorDone is written by the auditor once manifest-audit.json and
+// gate-result.json are complete, holding the run they belong to.
+const auditorDone = "auditor.done"
+
+// MarkAuditorDone records that the auditor of run wrote its outputs.
+func MarkAuditorDone(reportsPath, run string) error {
+    return os.WriteFile(filepath.Join(reportsPath, auditorDone), []byte(run), 0644)
+}
+
+// WaitAuditor waits until the auditor of run wrote its outputs, so the
+// reporter running next to it does not read those of an earlier run.
+// Without a run it does not wait.
+func WaitAuditor(reportsPath, run string, timeout time.Duration) error {
+    if run == "" {
+        return nil
+    }
+    deadline := time.Now().Add(timeout)
+    for {
+        data, err := os.ReadFile(filepath.Join(reportsPath, auditorDone))
+        if err == nil && strings.TrimSpace(string(data)) == run {
+            return nil
+        }
+        if time.Now().After(deadline) {
+            return fmt.Errorf("the auditor of run %s did not finish within %s", run, timeout)
+        }
+        time.Sleep(2 * time.Second)
+    }
+}
@@ -0,0 +1,95 @@
+package reports
+
+import (
+    "crypto/sha256"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "helm-auditor/internal/trivy"
+    "helm-auditor/internal/types"
+)
+
+// ImagePaths are the per image files the aggregator jobs write.
+type ImagePaths struct {
+    SBOM       string // CycloneDX from trivy image
+    Vulns      string // trivy sbom JSON report
+    Provenance string // provenor output folder
+}
+
+// ImageHash is the sha256 of the image reference, used to name per image
+// report files.
+func ImageHash(img string) string {
+    return fmt.Sprintf("%x", sha256.Sum256([]byte(img)))
+}
+
+// PathsFor returns where the aggregator stores the reports for img, as
+// <reports>/<sha256(img)>.* with reportsPath the chart folder
+// (OUTPUT_FOLDER) on the reports volume.
+func PathsFor(reportsPath, img string) ImagePaths {
+    base := filepath.Join(reportsPath, ImageHash(img))
+    return ImagePaths{
+        SBOM:       base + ".cdx.json",
+        Vulns:      base + ".vulns.json",
+        Provenance: base + ".prov.json",
+    }
+}
+
+// Root is where the reports volume is mounted.
+const Root = "/reports"
+
+// TrivyConfigPath is where the trivy init container writes the config scan
+// of the rendered templates.
+func TrivyConfigPath(chart string) string {
+    return filepath.Join(Root, chart+".report.trivy.json")
+}
+
+// ReadImages loads images.txt as written by the runner.
+func ReadImages(reportsPath string) ([]string, error) {
+    data, err := os.ReadFile(filepath.Join(reportsPath, "images.txt"))
+    if err != nil {
+        return nil, err
+    }
+
+    var images []string
+    for _, l := range strings.Split(string(data), "\n") {
+        if l = strings.TrimSpace(l); l != "" {
+            images = append(images, l)
+        }
+    }
+    return images, nil
+}
+
+// LoadProvenance reads the provenor result for an image.
+func LoadProvenance(p ImagePaths) (*types.ProvenanceResult, error) {
+    data, err := os.ReadFile(filepath.Join(p.Provenance, "provenance.json"))
+    if err != nil {
+        return nil, err
+    }
+
+    var prov types.ProvenanceResult
+    if err := json.Unmarshal(data, &prov); err != nil {
+        return nil, fmt.Errorf("parsing provenance: %w", err)
+    }
+    return &prov, nil
+}
+
+// LoadVulnerabilities reads the vulnerabilities of a trivy JSON report.
+func LoadVulnerabilities(path string) ([]types.Vulnerability, error) {
+    r, err := trivy.Load(path)
+    if err != nil {
+        return nil, err
+    }
+    return r.Vulnerabilities(), nil
+}
+
+// CountBySeverity counts vulns per severity.
+func CountBySeverity(vulns []types.Vulnerability) map[string]int {
+    counts := map[string]int{}
+    for _, v := range vulns {
+        counts[v.Severity]++
+    }
+    return counts
+}
@@ -0,0 +1,231 @@
+package sarif
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "strings"
+
+    "helm-auditor/internal/audit"
+    "helm-auditor/internal/trivy"
+    "helm-auditor/internal/types"
+)
+
+// fingerprintKey names the partial fingerprint the auditor computes. The
+// value only depends on what the finding is about, not on line numbers, so
+// dashboards can track a finding across chart versions.
+const fingerprintKey = "helmAuditorFinding/v1"
+
+// Level maps a Trivy severity to a SARIF result level.
+func Level(severity string) string {
+    switch strings.ToUpper(severity) {
+    case "CRITICAL", "HIGH":
+        return "error"
+    case "MEDIUM":
+        return "warning"
+    default:
+        return "note"
+    }
+}
+
+// securitySeverity is the numeric score code scanning dashboards sort on.
+func securitySeverity(severity string) string {
+    switch strings.ToUpper(severity) {
+    case "CRITICAL":
+        return "9.5"
+    case "HIGH":
+        return "8.0"
+    case "MEDIUM":
+        return "5.5"
+    case "LOW":
+        return "2.0"
+    default:
+        return "0.0"
+    }
+}
+
+func fingerprint(parts ...string) map[string]string {
+    sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+    return map[string]string{fingerprintKey: fmt.Sprintf("%x", sum)}
+}
+
+// AddMisconfigurations adds the failed checks of a trivy config report,
+// located in the rendered template files they were found in.
+func AddMisconfigurations(run *Run, report *trivy.Report) {
+    for _, r := range report.Results {
+        for _, m := range r.Misconfigurations {
+            if m.Status != "" && m.Status != "FAIL" {
+                continue
+            }
+
+            help := m.Resolution
+            if m.PrimaryURL != "" {
+                help = strings.TrimSpace(help + "\n" + m.PrimaryURL)
+            }
+            run.AddRule(&Rule{
+                ID:                   m.ID,
+                Name:                 m.Title,
+                ShortDescription:     &Message{Text: m.Title},
+                FullDescription:      &Message{Text: m.Description},
+                Help:                 &Message{Text: help},
+                HelpURI:              m.PrimaryURL,
+                DefaultConfiguration: &Configuration{Level: Level(m.Severity)},
+                Properties: map[string]any{
+                    "tags":              []string{"security", "misconfiguration", strings.ToLower(m.Type)},
+                    "security-severity": securitySeverity(m.Severity),
+                },
+            })
+
+            loc := Location{
+                PhysicalLocation: &PhysicalLocation{
+                    ArtifactLocation: ArtifactLocation{URI: r.Target, URIBaseID: "TEMPLATES"},
+                },
+            }
+            if m.CauseMetadata.StartLine > 0 {
+                loc.PhysicalLocation.Region = &Region{
+                    StartLine: m.CauseMetadata.StartLine,
+                    EndLine:   m.CauseMetadata.EndLine,
+                }
+            }
+            if m.CauseMetadata.Resource != "" {
+                loc.LogicalLocations = []LogicalLocation{{Name: m.CauseMetadata.Resource, Kind: "resource"}}
+            }
+
+            run.AddResult(&Result{
+                RuleID:              m.ID,
+                Level:               Level(m.Severity),
+                Message:             Message{Text: m.Message},
+                Locations:           []Location{loc},
+                PartialFingerprints: fingerprint(m.ID, r.Target, m.CauseMetadata.Resource, m.Message),
+                Properties:          map[string]any{"severity": m.Severity},
+            })
+        }
+    }
+}
+
+// AddFindings adds the findings of the native manifest analyzers.
+func AddFindings(run *Run, findings []types.Finding) {
+    for _, f := range findings {
+        run.AddRule(&Rule{
+            ID:                   f.RuleID,
+            Name:                 f.Title,
+            ShortDescription:     &Message{Text: f.Title},
+            Help:                 &Message{Text: firstNonEmpty(f.Resolution, f.Title)},
+            DefaultConfiguration: &Configuration{Level: Level(f.Severity)},
+            Properties: map[string]any{
+                "tags":              []string{"security", "misconfiguration", "kubernetes"},
+                "security-severity": securitySeverity(f.Severity),
+            },
+        })
+
+        name := f.Name
+        if f.Container != "" {
+            name = f.Name + "/" + f.Container
+        }
+        loc := Location{
+            PhysicalLocation: &PhysicalLocation{
+                ArtifactLocation: ArtifactLocation{URI: f.File, URIBaseID: "TEMPLATES"},
+            },
+            LogicalLocations: []LogicalLocation{{Name: name, FullyQualifiedName: f.Resource, Kind: "resource"}},
+        }
+        if f.Line > 0 {
+            loc.PhysicalLocation.Region = &Region{StartLine: f.Line}
+        }
+
+        run.AddResult(&Result{
+            RuleID:              f.RuleID,
+            Level:               Level(f.Severity),
+            Message:             Message{Text: f.Message},
+            Locations:           []Location{loc},
+            PartialFingerprints: fingerprint(f.RuleID, f.Resource, f.Container, f.Path),
+            Properties:          map[string]any{"severity": f.Severity},
+        })
+    }
+}
+
+// AddVulnerabilities adds the CVEs of image, one result per workload
+// referencing it, located at the container's image field.
+func AddVulnerabilities(run *Run, image string, report *trivy.Report, users []*audit.Workload) {
+    for _, r := range report.Results {
+        for _, v := range r.Vulnerabilities {
+            score := securitySeverity(v.Severity)
+            if cvss, _ := v.Score(); cvss > 0 {
+                score = fmt.Sprintf("%.1f", cvss)
+            }
+            run.AddRule(&Rule{
+                ID:                   v.VulnerabilityID,
+                Name:                 v.VulnerabilityID,
+                ShortDescription:     &Message{Text: firstNonEmpty(v.Title, v.VulnerabilityID)},
+                FullDescription:      &Message{Text: firstNonEmpty(v.Description, v.Title, v.VulnerabilityID)},
+                Help:                 &Message{Text: firstNonEmpty(v.PrimaryURL, v.VulnerabilityID)},
+                HelpURI:              v.PrimaryURL,
+                DefaultConfiguration: &Configuration{Level: Level(v.Severity)},
+                Properties: map[string]any{
+                    "tags":              []string{"security", "vulnerability"},
+                    "security-severity": score,
+                },
+            })
+
+            text := fmt.Sprintf("%s in %s %s of image %s", v.VulnerabilityID, v.PkgName, v.InstalledVersion, image)
+            if v.FixedVersion != "" {
+                text += fmt.Sprintf(", fixed in %s", v.FixedVersion)
+            }
+            props := map[string]any{
+                "severity":         v.Severity,
+                "image":            image,
+                "package":          v.PkgName,
+                "installedVersion": v.InstalledVersion,
+                "fixedVersion":     v.FixedVersion,
+            }
+
+            if len(users) == 0 {
+                run.AddResult(&Result{
+                    RuleID:              v.VulnerabilityID,
+                    Level:               Level(v.Severity),
+                    Message:             Message{Text: text},
+                    Locations:           []Location{{LogicalLocations: []LogicalLocation{{Name: image, Kind: "image"}}}},
+                    PartialFingerprints: fingerprint(v.VulnerabilityID, v.PkgName, v.InstalledVersion, image),
+                    Properties:          props,
+                })
+                continue
+            }
+
+            for _, w := range users {
+                run.AddResult(&Result{
+                    RuleID:              v.VulnerabilityID,
+                    Level:               Level(v.Severity),
+                    Message:             Message{Text: text + ", used by " + w.ID()},
+                    Locations:           []Location{workloadLocation(w, image)},
+                    PartialFingerprints: fingerprint(v.VulnerabilityID, v.PkgName, v.InstalledVersion, image, w.ID()),
+                    Properties:          props,
+                })
+            }
+        }
+    }
+}
+
+// workloadLocation points at the first container of w running image.
+func workloadLocation(w *audit.Workload, image string) Location {
+    line := w.Line
+    for _, c := range w.Containers {
+        if c.Image == image {
+            line = w.LineOf(append(append([]string{}, c.Path...), "image")...)
+            break
+        }
+    }
+    return Location{
+        PhysicalLocation: &PhysicalLocation{
+            ArtifactLocation: ArtifactLocation{URI: w.File, URIBaseID: "TEMPLATES"},
+            Region:           &Region{StartLine: line},
+        },
+        LogicalLocations: []LogicalLocation{{Name: w.Name(), FullyQualifiedName: w.ID(), Kind: "resource"}},
+    }
+}
+
+func firstNonEmpty(values ...string) string {
+    for _, v := range values {
+        if v != "" {
+            return v
+        }
+    }
+    return ""
+}
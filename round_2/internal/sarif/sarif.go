@@ -0,0 +1,134 @@
+package sarif
+
+import (
+    "encoding/json"
+    "os"
+)
+
+const (
+    Version = "2.1.0"
+    Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Log is a SARIF 2.1.0 document, limited to what the auditor emits.
+type Log struct {
+    Version string `json:"version"`
+    Schema  string `json:"$schema"`
+    Runs    []*Run `json:"runs"`
+}
+
+type Run struct {
+    Tool    Tool      `json:"tool"`
+    Results []*Result `json:"results"`
+
+    rules map[string]int
+}
+
+type Tool struct {
+    Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+    Name           string  `json:"name"`
+    Version        string  `json:"version,omitempty"`
+    InformationURI string  `json:"informationUri,omitempty"`
+    Rules          []*Rule `json:"rules"`
+}
+
+type Rule struct {
+    ID                   string         `json:"id"`
+    Name                 string         `json:"name,omitempty"`
+    ShortDescription     *Message       `json:"shortDescription,omitempty"`
+    FullDescription      *Message       `json:"fullDescription,omitempty"`
+    Help                 *Message       `json:"help,omitempty"`
+    HelpURI              string         `json:"helpUri,omitempty"`
+    DefaultConfiguration *Configuration `json:"defaultConfiguration,omitempty"`
+    Properties           map[string]any `json:"properties,omitempty"`
+}
+
+type Configuration struct {
+    Level string `json:"level"`
+}
+
+type Message struct {
+    Text     string `json:"text"`
+    Markdown string `json:"markdown,omitempty"`
+}
+
+type Result struct {
+    RuleID              string            `json:"ruleId"`
+    RuleIndex           int               `json:"ruleIndex"`
+    Level               string            `json:"level"`
+    Message             Message           `json:"message"`
+    Locations           []Location        `json:"locations,omitempty"`
+    PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+    Properties          map[string]any    `json:"properties,omitempty"`
+}
+
+type Location struct {
+    PhysicalLocation *PhysicalLocation `json:"physicalLocation,omitempty"`
+    LogicalLocations []LogicalLocation `json:"logicalLocations,omitempty"`
+    Message          *Message          `json:"message,omitempty"`
+}
+
+type PhysicalLocation struct {
+    ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+    Region           *Region          `json:"region,omitempty"`
+}
+
+type ArtifactLocation struct {
+    URI       string `json:"uri"`
+    URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type Region struct {
+    StartLine int `json:"startLine"`
+    EndLine   int `json:"endLine,omitempty"`
+}
+
+type LogicalLocation struct {
+    Name               string `json:"name,omitempty"`
+    FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+    Kind               string `json:"kind,omitempty"`
+}
+
+// NewLog returns an empty log.
+func NewLog() *Log {
+    return &Log{Version: Version, Schema: Schema, Runs: []*Run{}}
+}
+
+// AddRun starts a run for the named tool.
+func (l *Log) AddRun(tool, version, uri string) *Run {
+    r := &Run{
+        Tool:    Tool{Driver: Driver{Name: tool, Version: version, InformationURI: uri, Rules: []*Rule{}}},
+        Results: []*Result{},
+        rules:   map[string]int{},
+    }
+    l.Runs = append(l.Runs, r)
+    return r
+}
+
+// AddRule registers rule once and returns its index in the driver.
+func (r *Run) AddRule(rule *Rule) int {
+    if i, ok := r.rules[rule.ID]; ok {
+        return i
+    }
+    r.Tool.Driver.Rules = append(r.Tool.Driver.Rules, rule)
+    r.rules[rule.ID] = len(r.Tool.Driver.Rules) - 1
+    return r.rules[rule.ID]
+}
+
+// AddResult appends res, linking it to an already registered rule.
+func (r *Run) AddResult(res *Result) {
+    res.RuleIndex = r.rules[res.RuleID]
+    r.Results = append(r.Results, res)
+}
+
+// Write stores the log as indented JSON.
+func (l *Log) Write(path string) error {
+    data, err := json.MarshalIndent(l, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,175 @@
+package trivy
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "time"
+
+    "helm-auditor/internal/types"
+)
+
+// Report is the subset of the trivy JSON output (config, image and sbom
+// scans share the layout) the auditor consumes.
+type Report struct {
+    ArtifactName string   `json:"ArtifactName"`
+    Metadata     Metadata `json:"Metadata"`
+    Results      []Result `json:"Results"`
+}
+
+// Metadata describes the scanned artifact, image scans only.
+type Metadata struct {
+    OS *struct {
+        Family string `json:"Family"`
+        Name   string `json:"Name"`
+        EOSL   bool   `json:"EOSL"` // end of service life, no more fixes
+    } `json:"OS"`
+}
+
+type Result struct {
+    Target         string `json:"Target"`
+    Class          string `json:"Class"`
+    Type           string `json:"Type"`
+    MisconfSummary struct {
+        Successes int `json:"Successes"`
+        Failures  int `json:"Failures"`
+    } `json:"MisconfSummary"`
+    Misconfigurations []Misconfiguration `json:"Misconfigurations"`
+    Vulnerabilities   []Vulnerability    `json:"Vulnerabilities"`
+}
+
+type Misconfiguration struct {
+    ID            string   `json:"ID"`
+    AVDID         string   `json:"AVDID"`
+    Type          string   `json:"Type"`
+    Title         string   `json:"Title"`
+    Description   string   `json:"Description"`
+    Message       string   `json:"Message"`
+    Resolution    string   `json:"Resolution"`
+    Severity      string   `json:"Severity"`
+    PrimaryURL    string   `json:"PrimaryURL"`
+    References    []string `json:"References"`
+    Status        string   `json:"Status"`
+    CauseMetadata struct {
+        Resource  string `json:"Resource"`
+        Provider  string `json:"Provider"`
+        Service   string `json:"Service"`
+        StartLine int    `json:"StartLine"`
+        EndLine   int    `json:"EndLine"`
+    } `json:"CauseMetadata"`
+}
+
+type Vulnerability struct {
+    VulnerabilityID  string          `json:"VulnerabilityID"`
+    PkgName          string          `json:"PkgName"`
+    PkgPath          string          `json:"PkgPath"`
+    InstalledVersion string          `json:"InstalledVersion"`
+    FixedVersion     string          `json:"FixedVersion"`
+    Status           string          `json:"Status"`
+    Severity         string          `json:"Severity"`
+    SeveritySource   string          `json:"SeveritySource"`
+    Title            string          `json:"Title"`
+    Description      string          `json:"Description"`
+    PrimaryURL       string          `json:"PrimaryURL"`
+    DataSource       *DataSource     `json:"DataSource"`
+    CVSS             map[string]CVSS `json:"CVSS"` // keyed by vendor: nvd, redhat, ghsa...
+    PublishedDate    *time.Time      `json:"PublishedDate"`
+    LastModifiedDate *time.Time      `json:"LastModifiedDate"`
+}
+
+type DataSource struct {
+    ID   string `json:"ID"`
+    Name string `json:"Name"`
+    URL  string `json:"URL"`
+}
+
+type CVSS struct {
+    V2Vector string  `json:"V2Vector"`
+    V3Vector string  `json:"V3Vector"`
+    V2Score  float64 `json:"V2Score"`
+    V3Score  float64 `json:"V3Score"`
+}
+
+// Score picks the CVSS score of the vendor trivy took the severity from,
+// falling back to NVD and then to the highest score reported. v3 is
+// preferred over v2.
+func (v Vulnerability) Score() (float64, string) {
+    for _, vendor := range []string{v.SeveritySource, "nvd"} {
+        if c, ok := v.CVSS[vendor]; ok {
+            if score, vector := c.best(); score > 0 {
+                return score, vector
+            }
+        }
+    }
+
+    vendors := make([]string, 0, len(v.CVSS))
+    for vendor := range v.CVSS {
+        vendors = append(vendors, vendor)
+    }
+    sort.Strings(vendors)
+
+    var score float64
+    var vector string
+    for _, vendor := range vendors {
+        if s, vec := v.CVSS[vendor].best(); s > score {
+            score, vector = s, vec
+        }
+    }
+    return score, vector
+}
+
+func (c CVSS) best() (float64, string) {
+    if c.V3Score > 0 {
+        return c.V3Score, c.V3Vector
+    }
+    return c.V2Score, c.V2Vector
+}
+
+// Load reads a trivy JSON report.
+func Load(path string) (*Report, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var r Report
+    if err := json.Unmarshal(data, &r); err != nil {
+        return nil, fmt.Errorf("parsing trivy report %s: %w", path, err)
+    }
+    return &r, nil
+}
+
+// Vulnerabilities flattens the vulnerabilities of every result.
+func (r *Report) Vulnerabilities() []types.Vulnerability {
+    out := []types.Vulnerability{}
+    for _, res := range r.Results {
+        for _, v := range res.Vulnerabilities {
+            score, vector := v.Score()
+            tv := types.Vulnerability{
+                ID:               v.VulnerabilityID,
+                Package:          v.PkgName,
+                PackagePath:      v.PkgPath,
+                InstalledVersion: v.InstalledVersion,
+                FixedVersion:     v.FixedVersion,
+                Status:           v.Status,
+                Severity:         v.Severity,
+                CVSSScore:        score,
+                CVSSVector:       vector,
+                Title:            v.Title,
+                URL:              v.PrimaryURL,
+                Target:           res.Target,
+                Class:            res.Class,
+                Type:             res.Type,
+            }
+            if v.DataSource != nil {
+                tv.DataSource = v.DataSource.Name
+            }
+            if v.PublishedDate != nil {
+                tv.Published = *v.PublishedDate
+            }
+            out = append(out, tv)
+        }
+    }
+    return out
+}
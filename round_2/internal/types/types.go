@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 //import "github.com/sigstore/cosign/v2/pkg/oci"
 
 // AttestationResult wraps la attestation y su payload
@@ -20,3 +22,385 @@ type AuditResult struct {
     Attestations []AttestationResult `json:"attestations,omitempty"` // payloads de attestations
 }
 
+
+// SignerIdentity describes who produced a keyless signature, as recorded in
+// the Fulcio certificate attached to it.
+type SignerIdentity struct {
+    SubjectAlternativeName string    `json:"san"`
+    Subject                string    `json:"subject,omitempty"`
+    Issuer                 string    `json:"issuer,omitempty"`      // OIDC issuer that vouched for the SAN
+    CertificateIssuer      string    `json:"cert_issuer,omitempty"` // CA that issued the certificate
+    SerialNumber           string    `json:"serial_number,omitempty"`
+    NotBefore              time.Time `json:"not_before"`
+    NotAfter               time.Time `json:"not_after"`
+    WorkflowTrigger        string    `json:"workflow_trigger,omitempty"`
+    WorkflowName           string    `json:"workflow_name,omitempty"`
+    WorkflowRef            string    `json:"workflow_ref,omitempty"`
+    WorkflowRepository     string    `json:"workflow_repository,omitempty"`
+    WorkflowCommit         string    `json:"workflow_commit,omitempty"`
+    BuildSignerURI         string    `json:"build_signer_uri,omitempty"`
+}
+
+// TransparencyLogEntry is the Rekor record backing a signature.
+type TransparencyLogEntry struct {
+    Present           bool      `json:"present"`
+    LogIndex          int64     `json:"log_index,omitempty"`
+    LogID             string    `json:"log_id,omitempty"`
+    IntegratedTime    time.Time `json:"integrated_time,omitzero"`
+    SETVerified       bool      `json:"set_verified"`       // signed entry timestamp checked against the log key
+    InclusionVerified bool      `json:"inclusion_verified"` // inclusion proof checked against the log
+    Error             string    `json:"error,omitempty"`
+}
+
+// SignatureResult is a verified signature together with its signer, when
+// the signature carries a certificate.
+type SignatureResult struct {
+    Scheme    string                `json:"scheme"` // cosign or notation
+    Signature string                `json:"signature"`
+    Signer    *SignerIdentity       `json:"signer,omitempty"`
+    Tlog      *TransparencyLogEntry `json:"tlog,omitempty"` // cosign only
+}
+
+// ReferrerArtifact is an artifact attached to an image digest, found via
+// the OCI referrers API or a tag convention.
+type ReferrerArtifact struct {
+    Digest       string            `json:"digest"`
+    ArtifactType string            `json:"artifact_type"`
+    Kind         string            `json:"kind"`   // signature, attestation, sbom, vex, scan-result, other
+    Source       string            `json:"source"` // referrers or tag:<tag>
+    Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// SLSAProvenance summarizes the best SLSA provenance attestation found.
+type SLSAProvenance struct {
+    Level         int    `json:"level"`
+    PredicateType string `json:"predicate_type"`
+    BuilderID     string `json:"builder_id,omitempty"`
+    Signer        string `json:"signer,omitempty"` // SAN of the attestation certificate
+}
+
+// ProvenanceResult is everything the provenor learned about one image.
+type ProvenanceResult struct {
+    Image        string              `json:"image"`
+    Digest       string              `json:"digest,omitempty"`
+    Created      time.Time           `json:"created,omitzero"` // from the image config
+    Signed       bool                `json:"signed"`
+    VerifiedBy   []string            `json:"verified_by"` // schemes with at least one valid signature
+    Signatures   []SignatureResult   `json:"signatures"`
+    Attestations []AttestationResult `json:"attestations"`
+    Artifacts    []ReferrerArtifact  `json:"artifacts"`
+    SLSA         *SLSAProvenance     `json:"slsa,omitempty"`
+    Warnings     []string            `json:"warnings,omitempty"`
+}
+
+// Vulnerability is one CVE affecting a package of an image.
+type Vulnerability struct {
+    ID               string `json:"id"`
+    Package          string `json:"package"`
+    PackagePath      string `json:"package_path,omitempty"` // language packages only
+    InstalledVersion string `json:"installed_version"`
+    FixedVersion     string `json:"fixed_version,omitempty"`
+    Status           string `json:"status,omitempty"` // fixed, affected, will_not_fix...
+    Severity         string `json:"severity"`
+
+    CVSSScore  float64   `json:"cvss_score,omitempty"`
+    CVSSVector string    `json:"cvss_vector,omitempty"`
+    DataSource string    `json:"data_source,omitempty"`
+    Published  time.Time `json:"published,omitzero"`
+    Title      string    `json:"title,omitempty"`
+    URL        string    `json:"url,omitempty"`
+
+    // Where trivy found the package: target, os-pkgs or lang-pkgs, and
+    // the package type (debian, alpine, gobinary, jar...)
+    Target string `json:"target,omitempty"`
+    Class  string `json:"class,omitempty"`
+    Type   string `json:"type,omitempty"`
+
+    // How the CVE goes away: package, base-image or none
+    Fix string `json:"fix,omitempty"`
+
+    // new or existing since the last audit of the chart
+    Baseline  string    `json:"baseline,omitempty"`
+    FirstSeen time.Time `json:"first_seen,omitzero"`
+}
+
+// BaseImage is what an image was built on, as far as the SBOM tells.
+type BaseImage struct {
+    Name      string `json:"name,omitempty"` // org.opencontainers.image.base.name
+    OSFamily  string `json:"os_family,omitempty"`
+    OSVersion string `json:"os_version,omitempty"`
+    EOSL      bool   `json:"eosl,omitempty"`
+}
+
+// FixCounts splits the CVEs of one severity by how they can be fixed.
+type FixCounts struct {
+    Package   int `json:"package"`
+    BaseImage int `json:"base_image"`
+    None      int `json:"none"`
+}
+
+// Remediation is the rebuild advice for an image.
+type Remediation struct {
+    Base       *BaseImage           `json:"base,omitempty"`
+    BySeverity map[string]FixCounts `json:"by_severity"`
+    Hints      []string             `json:"hints,omitempty"`
+}
+
+// Finding is a failed check of the native manifest analyzers.
+type Finding struct {
+    RuleID     string `json:"rule_id"`
+    Title      string `json:"title"`
+    Severity   string `json:"severity"`
+    Message    string `json:"message"`
+    Resolution string `json:"resolution,omitempty"`
+
+    Resource  string `json:"resource"` // Kind/namespace/name
+    Kind      string `json:"kind"`
+    Name      string `json:"name"`
+    Namespace string `json:"namespace,omitempty"`
+    Container string `json:"container,omitempty"`
+
+    File string `json:"file"`           // rendered template, relative to the templates root
+    Line int    `json:"line,omitempty"` // line of the offending field
+    Path string `json:"path,omitempty"` // e.g. spec.template.spec.containers[0].securityContext
+
+    Chart string `json:"chart,omitempty"` // chart or subchart that produced it, e.g. parent/grafana
+
+    // Redacted excerpt of the offending value, for leaked credentials
+    Snippet string `json:"snippet,omitempty"`
+
+    // new or existing since the last audit of the chart
+    Baseline  string    `json:"baseline,omitempty"`
+    FirstSeen time.Time `json:"first_seen,omitzero"`
+}
+
+// Permission is one RBAC rule granted to a service account.
+type Permission struct {
+    Role            string   `json:"role"`    // Kind/name of the role
+    Binding         string   `json:"binding"` // Kind/namespace/name of the binding
+    Scope           string   `json:"scope"`   // namespace, or "cluster"
+    APIGroups       []string `json:"api_groups,omitempty"`
+    Resources       []string `json:"resources,omitempty"`
+    ResourceNames   []string `json:"resource_names,omitempty"`
+    NonResourceURLs []string `json:"non_resource_urls,omitempty"`
+    Verbs           []string `json:"verbs"`
+    Flags           []string `json:"flags,omitempty"`    // rule IDs of dangerous grants
+    External        bool     `json:"external,omitempty"` // role not rendered by the chart
+}
+
+// WorkloadPermissions is what a workload can do through its service
+// account.
+type WorkloadPermissions struct {
+    Workload       string       `json:"workload"`
+    ServiceAccount string       `json:"service_account"` // namespace/name
+    Permissions    []Permission `json:"permissions"`
+}
+
+// WorkloadNetwork is the network exposure of a workload: which
+// NetworkPolicies select it and how reachable it is.
+type WorkloadNetwork struct {
+    Workload string   `json:"workload"`
+    Ingress  string   `json:"ingress"` // default-allow, allow-all, restricted or isolated
+    Egress   string   `json:"egress"`
+    Policies []string `json:"policies,omitempty"`
+    Exposed  []string `json:"exposed,omitempty"` // Services and Ingress hosts reaching it from outside
+}
+
+// ExposedService is a LoadBalancer or NodePort Service.
+type ExposedService struct {
+    Service      string   `json:"service"`
+    Type         string   `json:"type"`
+    Ports        []string `json:"ports"`
+    SourceRanges []string `json:"source_ranges,omitempty"`
+    Workloads    []string `json:"workloads,omitempty"`
+}
+
+// IngressHost is a host served by an Ingress of the chart.
+type IngressHost struct {
+    Ingress  string   `json:"ingress"`
+    Host     string   `json:"host"` // * when the rule has no host
+    TLS      bool     `json:"tls"`
+    Services []string `json:"services,omitempty"`
+}
+
+// NetworkReport is the network exposure of a chart.
+type NetworkReport struct {
+    Workloads []WorkloadNetwork `json:"workloads"`
+    Services  []ExposedService  `json:"services,omitempty"`
+    Ingresses []IngressHost     `json:"ingresses,omitempty"`
+}
+
+// PSSViolation is a pod template field breaking a Pod Security Standard.
+type PSSViolation struct {
+    Level     string `json:"level"` // baseline or restricted
+    Check     string `json:"check"` // name of the control in the standard
+    Container string `json:"container,omitempty"`
+    Field     string `json:"field"`
+    Line      int    `json:"line,omitempty"`
+    Detail    string `json:"detail"`
+}
+
+// PodSecurity is the highest Pod Security Standard a workload satisfies.
+type PodSecurity struct {
+    Workload   string         `json:"workload"`
+    Namespace  string         `json:"namespace,omitempty"`
+    Level      string         `json:"level"` // privileged, baseline or restricted
+    Violations []PSSViolation `json:"violations,omitempty"`
+}
+
+// NamespaceAdmission tells how Pod Security Admission treats the chart in
+// one namespace.
+type NamespaceAdmission struct {
+    Namespace string   `json:"namespace"`         // empty for the release namespace
+    Enforce   string   `json:"enforce,omitempty"` // pod-security.kubernetes.io/enforce of a rendered Namespace
+    Required  string   `json:"required"`          // least strict level admitting every workload
+    Rejected  []string `json:"rejected,omitempty"`
+}
+
+// PSSReport is the Pod Security Standards evaluation of a chart.
+type PSSReport struct {
+    Required   string               `json:"required"` // for the whole chart
+    Workloads  []PodSecurity        `json:"workloads"`
+    Namespaces []NamespaceAdmission `json:"namespaces"`
+}
+
+// Maintainer is a chart maintainer from Chart.yaml.
+type Maintainer struct {
+    Name  string `json:"name"`
+    Email string `json:"email,omitempty"`
+    URL   string `json:"url,omitempty"`
+}
+
+// ChartDependency is an entry of the dependencies in Chart.yaml.
+type ChartDependency struct {
+    Name       string `json:"name"`
+    Version    string `json:"version"`
+    Repository string `json:"repository,omitempty"`
+    Condition  string `json:"condition,omitempty"`
+    Alias      string `json:"alias,omitempty"`
+}
+
+// ChartMetadata is what Chart.yaml and the chart tree tell about a chart.
+type ChartMetadata struct {
+    APIVersion   string            `json:"api_version"`
+    Name         string            `json:"name"`
+    Version      string            `json:"version"`
+    AppVersion   string            `json:"app_version,omitempty"`
+    Description  string            `json:"description,omitempty"`
+    Type         string            `json:"type,omitempty"`
+    KubeVersion  string            `json:"kube_version,omitempty"` // constraint on the cluster version
+    Home         string            `json:"home,omitempty"`
+    Sources      []string          `json:"sources,omitempty"`
+    Maintainers  []Maintainer      `json:"maintainers,omitempty"`
+    Dependencies []ChartDependency `json:"dependencies,omitempty"`
+    Deprecated   bool              `json:"deprecated,omitempty"`
+
+    // Chart tree
+    ValuesSchema bool     `json:"values_schema"`
+    Notes        bool     `json:"notes"`
+    Readme       bool     `json:"readme"`
+    Tests        []string `json:"tests,omitempty"` // templates under templates/tests
+    CRDs         int      `json:"crds,omitempty"`  // files under crds/
+}
+
+// ChartNode is a chart in the dependency tree of the audited chart.
+type ChartNode struct {
+    ID         string `json:"id"` // parent/subchart/... path in the tree
+    Name       string `json:"name"`
+    Version    string `json:"version,omitempty"`
+    AppVersion string `json:"app_version,omitempty"`
+
+    // As declared by the parent chart
+    Constraint string `json:"constraint,omitempty"`
+    Repository string `json:"repository,omitempty"`
+    Alias      string `json:"alias,omitempty"`
+    Condition  string `json:"condition,omitempty"`
+    Locked     string `json:"locked,omitempty"` // version in the parent Chart.lock
+    Latest     string `json:"latest,omitempty"` // newest version in the repository index
+
+    Vendored bool `json:"vendored"` // shipped under charts/
+    Pinned   bool `json:"pinned"`
+    Outdated bool `json:"outdated,omitempty"`
+
+    // What the chart rendered
+    Images    []string `json:"images,omitempty"`
+    Resources []string `json:"resources,omitempty"`
+    Findings  int      `json:"findings,omitempty"`
+
+    Dependencies []*ChartNode `json:"dependencies,omitempty"`
+}
+
+// ResolvedIssue is a CVE, misconfiguration or finding of the last audit
+// gone from the current one.
+type ResolvedIssue struct {
+    Kind      string    `json:"kind"` // cve, misconfiguration or finding
+    ID        string    `json:"id"`
+    Severity  string    `json:"severity"`
+    Target    string    `json:"target"` // image repository or resource
+    FirstSeen time.Time `json:"first_seen"`
+}
+
+// TrendPoint sums up one audit of the history.
+type TrendPoint struct {
+    Time              time.Time      `json:"time"`
+    Version           string         `json:"version"`
+    Vulns             map[string]int `json:"vulns"` // by severity
+    Misconfigurations int            `json:"misconfigurations"`
+    Findings          int            `json:"findings"`
+}
+
+// AuditHistory compares an audit with the previous audits of the same
+// chart and values variant.
+type AuditHistory struct {
+    Variant  string      `json:"variant"`
+    Previous *TrendPoint `json:"previous,omitempty"`
+
+    New      int             `json:"new"`
+    Existing int             `json:"existing"`
+    Resolved []ResolvedIssue `json:"resolved,omitempty"`
+
+    Trend []TrendPoint `json:"trend"`
+
+    // Mean days from first seen to resolved, by severity
+    TimeToFix map[string]float64 `json:"time_to_fix_days,omitempty"`
+}
+
+// CachedImage is how the scan of an image used the scan cache.
+type CachedImage struct {
+    Image      string `json:"image"`
+    Digest     string `json:"digest,omitempty"`
+    Scan       string `json:"scan"`       // hit, rescan (SBOM reused), miss or uncached
+    Provenance string `json:"provenance"` // hit or miss
+}
+
+// ScanCacheStats sums up the scan cache use of a run, written by the
+// aggregator as scan-cache.json.
+type ScanCacheStats struct {
+    DBUpdated      time.Time     `json:"db_updated,omitzero"` // trivy DB the images were matched against
+    Hits           int           `json:"hits"`
+    Rescans        int           `json:"rescans"`
+    Misses         int           `json:"misses"`
+    Uncached       int           `json:"uncached"`
+    ProvenanceHits int           `json:"provenance_hits"`
+    Images         []CachedImage `json:"images"`
+}
+
+// VulnRef points at a CVE of a package.
+type VulnRef struct {
+    ID               string `json:"id"`
+    Package          string `json:"package"`
+    InstalledVersion string `json:"installed_version"`
+}
+
+// OSVScan is what the embedded OSV matcher found in an image SBOM,
+// compared with trivy when trivy scanned the image too.
+type OSVScan struct {
+    Database string `json:"database"` // OSV export path
+    Matched  int    `json:"matched"`
+
+    // false when the CVEs of the image come from the matcher alone
+    TrivyScanned bool      `json:"trivy_scanned"`
+    Both         int       `json:"both,omitempty"`
+    OSVOnly      []VulnRef `json:"osv_only,omitempty"`
+    TrivyOnly    []VulnRef `json:"trivy_only,omitempty"`
+}
@@ -0,0 +1,149 @@
+package values
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+
+    "helm-auditor/internal/types"
+)
+
+// Infer builds a JSON schema from the defaults of a values.yaml. Every
+// key becomes a property typed after its default, null defaults stay
+// untyped and objects stay open: charts commonly accept keys they do not
+// default.
+func Infer(values map[string]any) map[string]any {
+    s := infer(values)
+    s["$schema"] = "http://json-schema.org/draft-07/schema#"
+    return s
+}
+
+func infer(value any) map[string]any {
+    switch v := value.(type) {
+    case nil:
+        return map[string]any{}
+    case map[string]any:
+        props := map[string]any{}
+        for k, e := range v {
+            props[k] = infer(e)
+        }
+        s := map[string]any{"type": "object"}
+        if len(props) > 0 {
+            s["properties"] = props
+        }
+        return s
+    case []any:
+        s := map[string]any{"type": "array"}
+        if len(v) > 0 {
+            s["items"] = infer(v[0])
+        }
+        return s
+    default:
+        return map[string]any{"type": typeOf(v)}
+    }
+}
+
+// Change is a difference between the inferred schemas of two chart
+// versions.
+type Change struct {
+    Path []string
+    Kind string // "type" or "removed"
+    Old  string
+    New  string
+}
+
+func (c Change) String() string {
+    if c.Kind == "removed" {
+        return fmt.Sprintf("%s was removed (was %s)", FieldPath(c.Path), c.Old)
+    }
+    return fmt.Sprintf("%s changed from %s to %s", FieldPath(c.Path), c.Old, c.New)
+}
+
+// Drift lists the keys of old whose type changed or that are gone in
+// cur. Values overrides written for the old chart break on the first and
+// are silently ignored on the second. Widening integer to number is not
+// a change.
+func Drift(old, cur map[string]any) []Change {
+    var out []Change
+    drift(old, cur, nil, &out)
+    return out
+}
+
+func drift(old, cur map[string]any, path []string, out *[]Change) {
+    ot, ct := schemaType(old), schemaType(cur)
+    if ot != "" && ct != "" && ot != ct && !(ot == "integer" && ct == "number") {
+        *out = append(*out, Change{Path: path, Kind: "type", Old: ot, New: ct})
+        return
+    }
+
+    oldProps, _ := old["properties"].(map[string]any)
+    curProps, _ := cur["properties"].(map[string]any)
+    keys := make([]string, 0, len(oldProps))
+    for k := range oldProps {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        child := append(append([]string(nil), path...), k)
+        o, _ := oldProps[k].(map[string]any)
+        c, ok := curProps[k].(map[string]any)
+        if !ok {
+            // Open objects without defaults may still accept the key.
+            if len(curProps) > 0 {
+                *out = append(*out, Change{Path: child, Kind: "removed", Old: typeName(o)})
+            }
+            continue
+        }
+        drift(o, c, child, out)
+    }
+
+    oi, _ := old["items"].(map[string]any)
+    ci, _ := cur["items"].(map[string]any)
+    if oi != nil && ci != nil {
+        drift(oi, ci, append(append([]string(nil), path...), strconv.Itoa(0)), out)
+    }
+}
+
+func schemaType(s map[string]any) string {
+    t, _ := s["type"].(string)
+    return t
+}
+
+func typeName(s map[string]any) string {
+    if t := schemaType(s); t != "" {
+        return t
+    }
+    return "null"
+}
+
+// DriftFindings reports the changes since the values of chart version
+// from, located in the values file f of the new version.
+func DriftFindings(changes []Change, f *File, chart, from string) []types.Finding {
+    var out []types.Finding
+    for _, c := range changes {
+        finding := types.Finding{
+            RuleID:     "HA901",
+            Title:      "Values type drift",
+            Severity:   "MEDIUM",
+            Message:    fmt.Sprintf("since %s %s: %s", chart, from, c),
+            Resolution: "Review values overrides written for the previous chart version, they no longer fit the chart.",
+            Resource:   "Chart/" + chart,
+            Kind:       "Chart",
+            Name:       chart,
+            File:       "values.yaml",
+            Line:       f.LineOf(c.Path),
+            Path:       FieldPath(c.Path),
+        }
+        if c.Kind == "removed" {
+            finding.RuleID = "HA902"
+            finding.Title = "Value removed"
+            finding.Severity = "LOW"
+            finding.Resolution = "Drop or migrate overrides of the key, Helm silently ignores them."
+            for p := c.Path; len(p) > 0 && finding.Line == 0; p = p[:len(p)-1] {
+                finding.Line = f.LineOf(p)
+            }
+        }
+        out = append(out, finding)
+    }
+    return out
+}
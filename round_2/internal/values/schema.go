@@ -0,0 +1,329 @@
+package values
+
+import (
+    "fmt"
+    "math"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Error is a value breaking the schema.
+type Error struct {
+    Path    []string
+    Message string
+}
+
+func (e Error) Error() string {
+    if len(e.Path) == 0 {
+        return e.Message
+    }
+    return FieldPath(e.Path) + ": " + e.Message
+}
+
+// Validate checks values against a JSON schema (draft 7 subset used by
+// Helm charts): $ref to local definitions, type, enum, const,
+// properties, patternProperties, additionalProperties, required, items,
+// size and range limits, pattern, allOf, anyOf and oneOf.
+func Validate(schema, values map[string]any) []Error {
+    v := &validator{root: schema}
+    v.check(schema, values, nil)
+    return v.errs
+}
+
+type validator struct {
+    root map[string]any
+    errs []Error
+}
+
+func (v *validator) fail(path []string, format string, args ...any) {
+    v.errs = append(v.errs, Error{Path: append([]string(nil), path...), Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows a local $ref such as #/definitions/image.
+func (v *validator) resolve(s map[string]any) map[string]any {
+    for i := 0; i < 32; i++ {
+        ref, ok := s["$ref"].(string)
+        if !ok || !strings.HasPrefix(ref, "#") {
+            return s
+        }
+        var cur any = v.root
+        for _, p := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+            if p == "" {
+                continue
+            }
+            p = strings.NewReplacer("~1", "/", "~0", "~").Replace(p)
+            m, _ := cur.(map[string]any)
+            cur = m[p]
+        }
+        next, ok := cur.(map[string]any)
+        if !ok {
+            return s
+        }
+        s = next
+    }
+    return s
+}
+
+func (v *validator) check(schema map[string]any, value any, path []string) {
+    if schema == nil {
+        return
+    }
+    s := v.resolve(schema)
+
+    if allowed := typesOf(s); len(allowed) > 0 && !hasType(value, allowed) {
+        v.fail(path, "got %s, want %s", typeOf(value), strings.Join(allowed, " or "))
+        return
+    }
+    if enum, ok := s["enum"].([]any); ok && !inList(enum, value) {
+        v.fail(path, "%s is not one of %s", show(value), showList(enum))
+    }
+    if c, ok := s["const"]; ok && !equal(c, value) {
+        v.fail(path, "must be %s", show(c))
+    }
+    for _, sub := range maps(s["allOf"]) {
+        v.check(sub, value, path)
+    }
+    if branches := maps(s["anyOf"]); len(branches) > 0 && v.matching(branches, value, path) == 0 {
+        v.fail(path, "does not match any of the allowed schemas")
+    }
+    if branches := maps(s["oneOf"]); len(branches) > 0 {
+        if n := v.matching(branches, value, path); n != 1 {
+            v.fail(path, "matches %d of the schemas, exactly one is allowed", n)
+        }
+    }
+
+    switch val := value.(type) {
+    case map[string]any:
+        v.object(s, val, path)
+    case []any:
+        v.array(s, val, path)
+    case string:
+        v.str(s, val, path)
+    default:
+        if n, ok := number(value); ok {
+            v.number(s, n, path)
+        }
+    }
+}
+
+// matching counts the branches value is valid against.
+func (v *validator) matching(branches []map[string]any, value any, path []string) int {
+    n := 0
+    for _, b := range branches {
+        sub := &validator{root: v.root}
+        sub.check(b, value, path)
+        if len(sub.errs) == 0 {
+            n++
+        }
+    }
+    return n
+}
+
+func (v *validator) object(s map[string]any, obj map[string]any, path []string) {
+    for _, r := range stringList(s["required"]) {
+        if _, ok := obj[r]; !ok {
+            v.fail(append(append([]string(nil), path...), r), "is required")
+        }
+    }
+    props, _ := s["properties"].(map[string]any)
+    patterns, _ := s["patternProperties"].(map[string]any)
+
+    keys := make([]string, 0, len(obj))
+    for k := range obj {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        child := append(append([]string(nil), path...), k)
+        matched := false
+        if ps, ok := props[k].(map[string]any); ok {
+            v.check(ps, obj[k], child)
+            matched = true
+        }
+        for pattern, ps := range patterns {
+            if re, err := regexp.Compile(pattern); err == nil && re.MatchString(k) {
+                m, _ := ps.(map[string]any)
+                v.check(m, obj[k], child)
+                matched = true
+            }
+        }
+        if matched {
+            continue
+        }
+        switch add := s["additionalProperties"].(type) {
+        case bool:
+            if !add {
+                v.fail(child, "is not allowed, the schema does not define it")
+            }
+        case map[string]any:
+            v.check(add, obj[k], child)
+        }
+    }
+}
+
+func (v *validator) array(s map[string]any, list []any, path []string) {
+    if n, ok := number(s["minItems"]); ok && float64(len(list)) < n {
+        v.fail(path, "has %d items, at least %v required", len(list), n)
+    }
+    if n, ok := number(s["maxItems"]); ok && float64(len(list)) > n {
+        v.fail(path, "has %d items, at most %v allowed", len(list), n)
+    }
+    items, _ := s["items"].(map[string]any)
+    for i, item := range list {
+        v.check(items, item, append(append([]string(nil), path...), strconv.Itoa(i)))
+    }
+}
+
+func (v *validator) str(s map[string]any, val string, path []string) {
+    length := float64(len([]rune(val)))
+    if n, ok := number(s["minLength"]); ok && length < n {
+        v.fail(path, "is shorter than %v characters", n)
+    }
+    if n, ok := number(s["maxLength"]); ok && length > n {
+        v.fail(path, "is longer than %v characters", n)
+    }
+    if p, ok := s["pattern"].(string); ok {
+        if re, err := regexp.Compile(p); err == nil && !re.MatchString(val) {
+            v.fail(path, "%q does not match %s", val, p)
+        }
+    }
+}
+
+func (v *validator) number(s map[string]any, val float64, path []string) {
+    if n, ok := number(s["minimum"]); ok && val < n {
+        v.fail(path, "%v is less than %v", val, n)
+    }
+    if n, ok := number(s["maximum"]); ok && val > n {
+        v.fail(path, "%v is greater than %v", val, n)
+    }
+    if n, ok := number(s["exclusiveMinimum"]); ok && val <= n {
+        v.fail(path, "%v must be greater than %v", val, n)
+    }
+    if n, ok := number(s["exclusiveMaximum"]); ok && val >= n {
+        v.fail(path, "%v must be less than %v", val, n)
+    }
+    if n, ok := number(s["multipleOf"]); ok && n > 0 && math.Mod(val, n) != 0 {
+        v.fail(path, "%v is not a multiple of %v", val, n)
+    }
+}
+
+func typesOf(s map[string]any) []string {
+    switch t := s["type"].(type) {
+    case string:
+        return []string{t}
+    case []any:
+        return stringList(t)
+    }
+    return nil
+}
+
+func hasType(value any, allowed []string) bool {
+    for _, t := range allowed {
+        switch t {
+        case "integer":
+            if n, ok := number(value); ok && n == math.Trunc(n) {
+                return true
+            }
+        case "number":
+            if _, ok := number(value); ok {
+                return true
+            }
+        default:
+            if typeOf(value) == t {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// typeOf names the JSON type of a decoded YAML value.
+func typeOf(value any) string {
+    switch value.(type) {
+    case nil:
+        return "null"
+    case map[string]any:
+        return "object"
+    case []any:
+        return "array"
+    case string:
+        return "string"
+    case bool:
+        return "boolean"
+    case int, int64, uint64:
+        return "integer"
+    case float64:
+        return "number"
+    }
+    return fmt.Sprintf("%T", value)
+}
+
+func number(v any) (float64, bool) {
+    switch n := v.(type) {
+    case int:
+        return float64(n), true
+    case int64:
+        return float64(n), true
+    case uint64:
+        return float64(n), true
+    case float64:
+        return n, true
+    }
+    return 0, false
+}
+
+func equal(a, b any) bool {
+    if x, ok := number(a); ok {
+        y, ok := number(b)
+        return ok && x == y
+    }
+    return fmt.Sprint(a) == fmt.Sprint(b) && typeOf(a) == typeOf(b)
+}
+
+func inList(list []any, value any) bool {
+    for _, e := range list {
+        if equal(e, value) {
+            return true
+        }
+    }
+    return false
+}
+
+func show(v any) string {
+    if s, ok := v.(string); ok {
+        return strconv.Quote(s)
+    }
+    return fmt.Sprint(v)
+}
+
+func showList(list []any) string {
+    parts := make([]string, len(list))
+    for i, v := range list {
+        parts[i] = show(v)
+    }
+    return strings.Join(parts, ", ")
+}
+
+func maps(v any) []map[string]any {
+    list, _ := v.([]any)
+    var out []map[string]any
+    for _, item := range list {
+        if m, ok := item.(map[string]any); ok {
+            out = append(out, m)
+        }
+    }
+    return out
+}
+
+func stringList(v any) []string {
+    list, _ := v.([]any)
+    var out []string
+    for _, item := range list {
+        if s, ok := item.(string); ok {
+            out = append(out, s)
+        }
+    }
+    return out
+}
@@ -0,0 +1,126 @@
+package values
+
+import (
+    "encoding/json"
+    "slices"
+    "testing"
+
+    "gopkg.in/yaml.v3"
+)
+
+func TestValidate(t *testing.T) {
+    tests := []struct {
+        name   string
+        schema string
+        values string
+        want   []string
+    }{
+        {
+            name:   "type mismatch",
+            schema: `{"properties": {"replicas": {"type": "integer"}, "name": {"type": "string"}}}`,
+            values: "replicas: \"3\"\nname: 5\n",
+            want:   []string{"name: got integer, want string", "replicas: got string, want integer"},
+        },
+        {
+            name:   "integer accepts whole numbers only",
+            schema: `{"properties": {"replicas": {"type": "integer"}, "ratio": {"type": "integer"}}}`,
+            values: "replicas: 3\nratio: 0.5\n",
+            want:   []string{"ratio: got number, want integer"},
+        },
+        {
+            name:   "nullable type list",
+            schema: `{"properties": {"tag": {"type": ["string", "null"]}}}`,
+            values: "tag: null\n",
+        },
+        {
+            name:   "required",
+            schema: `{"required": ["image"], "properties": {"image": {"type": "object", "required": ["repository", "tag"]}}}`,
+            values: "image:\n  repository: nginx\n",
+            want:   []string{"image.tag: is required"},
+        },
+        {
+            name:   "missing required object",
+            schema: `{"required": ["image"]}`,
+            values: "replicas: 1\n",
+            want:   []string{"image: is required"},
+        },
+        {
+            name:   "enum",
+            schema: `{"properties": {"pullPolicy": {"enum": ["Always", "IfNotPresent", "Never"]}}}`,
+            values: "pullPolicy: always\n",
+            want:   []string{`pullPolicy: "always" is not one of "Always", "IfNotPresent", "Never"`},
+        },
+        {
+            name:   "enum of numbers",
+            schema: `{"properties": {"port": {"enum": [80, 443]}}}`,
+            values: "port: 443\n",
+        },
+        {
+            name:   "additionalProperties false",
+            schema: `{"properties": {"image": {"type": "object", "properties": {"tag": {"type": "string"}}, "additionalProperties": false}}}`,
+            values: "image:\n  tag: \"1.0\"\n  tga: latest\n",
+            want:   []string{"image.tga: is not allowed, the schema does not define it"},
+        },
+        {
+            name:   "additionalProperties schema",
+            schema: `{"properties": {"labels": {"type": "object", "additionalProperties": {"type": "string"}}}}`,
+            values: "labels:\n  app: web\n  tier: 2\n",
+            want:   []string{"labels.tier: got integer, want string"},
+        },
+        {
+            name:   "patternProperties before additionalProperties",
+            schema: `{"patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": false}`,
+            values: "x-team: web\nother: 1\n",
+            want:   []string{"other: is not allowed, the schema does not define it"},
+        },
+        {
+            name: "nested $ref",
+            schema: `{
+                "definitions": {
+                    "image": {"type": "object", "required": ["repository"], "properties": {"repository": {"type": "string"}, "pullPolicy": {"$ref": "#/definitions/pullPolicy"}}},
+                    "pullPolicy": {"enum": ["Always", "IfNotPresent"]},
+                    "container": {"type": "object", "properties": {"image": {"$ref": "#/definitions/image"}}}
+                },
+                "properties": {"sidecars": {"type": "array", "items": {"$ref": "#/definitions/container"}}}
+            }`,
+            values: "sidecars:\n  - image:\n      repository: busybox\n  - image:\n      pullPolicy: Never\n",
+            want:   []string{"sidecars[1].image.repository: is required", `sidecars[1].image.pullPolicy: "Never" is not one of "Always", "IfNotPresent"`},
+        },
+        {
+            name:   "escaped $ref",
+            schema: `{"$defs": {"a/b": {"type": "boolean"}}, "properties": {"enabled": {"$ref": "#/$defs/a~1b"}}}`,
+            values: "enabled: \"yes\"\n",
+            want:   []string{"enabled: got string, want boolean"},
+        },
+        {
+            name:   "oneOf",
+            schema: `{"properties": {"port": {"oneOf": [{"type": "integer"}, {"type": "string", "pattern": "^[0-9]+$"}]}}}`,
+            values: "port: http\n",
+            want:   []string{"port: matches 0 of the schemas, exactly one is allowed"},
+        },
+        {
+            name:   "limits",
+            schema: `{"properties": {"replicas": {"type": "integer", "minimum": 1}, "name": {"type": "string", "maxLength": 3}, "hosts": {"type": "array", "minItems": 1}}}`,
+            values: "replicas: 0\nname: abcd\nhosts: []\n",
+            want:   []string{"hosts: has 0 items, at least 1 required", "name: is longer than 3 characters", "replicas: 0 is less than 1"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var schema, values map[string]any
+            if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+                t.Fatal(err)
+            }
+            if err := yaml.Unmarshal([]byte(tt.values), &values); err != nil {
+                t.Fatal(err)
+            }
+            var got []string
+            for _, err := range Validate(schema, values) {
+                got = append(got, err.Error())
+            }
+            if !slices.Equal(got, tt.want) {
+                t.Errorf("Validate() = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
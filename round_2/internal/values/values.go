@@ -0,0 +1,152 @@
+// Package values validates chart values against values.schema.json and
+// infers a schema from values.yaml to follow type drift across chart
+// versions.
+package values
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// File is a parsed values file. The node keeps line numbers for errors.
+type File struct {
+    Path   string
+    Values map[string]any
+    node   *yaml.Node
+}
+
+// Load parses a values file. An empty file holds no values.
+func Load(path string) (*File, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    f := &File{Path: path, Values: map[string]any{}}
+    var doc yaml.Node
+    if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+        if errors.Is(err, io.EOF) {
+            return f, nil
+        }
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    if len(doc.Content) == 0 {
+        return f, nil
+    }
+    f.node = doc.Content[0]
+    if err := f.node.Decode(&f.Values); err != nil {
+        return nil, fmt.Errorf("%s: values must be a map: %w", path, err)
+    }
+    if f.Values == nil {
+        f.Values = map[string]any{}
+    }
+    return f, nil
+}
+
+// LineOf returns the line setting the value at path, 0 if the file does
+// not set it.
+func (f *File) LineOf(path []string) int {
+    n := f.node
+    line := 0
+    for _, p := range path {
+        if n == nil {
+            return 0
+        }
+        var next *yaml.Node
+        switch n.Kind {
+        case yaml.MappingNode:
+            for i := 0; i+1 < len(n.Content); i += 2 {
+                if n.Content[i].Value == p {
+                    next = n.Content[i+1]
+                    line = n.Content[i].Line
+                    break
+                }
+            }
+        case yaml.SequenceNode:
+            if i, err := strconv.Atoi(p); err == nil && i < len(n.Content) {
+                next = n.Content[i]
+                line = next.Line
+            }
+        }
+        if next == nil {
+            return 0
+        }
+        n = next
+    }
+    return line
+}
+
+// LoadSchema reads a JSON schema such as values.schema.json.
+func LoadSchema(path string) (map[string]any, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var s map[string]any
+    if err := json.Unmarshal(data, &s); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return s, nil
+}
+
+// Merge overlays the values of files, in order, on base like helm does
+// with -f: maps are merged, any other value replaces the previous one and
+// null deletes the key.
+func Merge(base map[string]any, files ...*File) map[string]any {
+    out := copyMap(base)
+    for _, f := range files {
+        out = merge(out, f.Values)
+    }
+    return out
+}
+
+func merge(dst, src map[string]any) map[string]any {
+    for k, v := range src {
+        if v == nil {
+            delete(dst, k)
+            continue
+        }
+        sm, sok := v.(map[string]any)
+        dm, dok := dst[k].(map[string]any)
+        if sok && dok {
+            dst[k] = merge(dm, sm)
+            continue
+        }
+        dst[k] = v
+    }
+    return dst
+}
+
+func copyMap(m map[string]any) map[string]any {
+    out := make(map[string]any, len(m))
+    for k, v := range m {
+        if sub, ok := v.(map[string]any); ok {
+            v = copyMap(sub)
+        }
+        out[k] = v
+    }
+    return out
+}
+
+// FieldPath renders a path as image.tag or tolerations[0].key.
+func FieldPath(path []string) string {
+    var b strings.Builder
+    for _, p := range path {
+        if _, err := strconv.Atoi(p); err == nil {
+            fmt.Fprintf(&b, "[%s]", p)
+            continue
+        }
+        if b.Len() > 0 {
+            b.WriteByte('.')
+        }
+        b.WriteString(p)
+    }
+    return b.String()
+}
@@ -46,6 +46,9 @@ kubectl delete pod "$POD_NAME" --ignore-not-found || true
 # ConfigMap
 yellow "==> Recreating ConfigMap..."
 kubectl apply -f k8s/chart-config.yaml
+kubectl apply -f k8s/gate-policy.yaml
+kubectl apply -f k8s/chart-values.yaml
+kubectl apply -f k8s/rekor-key.yaml
 
 # PVC & RBAC
 yellow "==> Applying PVC..."